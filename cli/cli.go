@@ -0,0 +1,123 @@
+package cli
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/log"
+
+	"github.com/alexmk92/aws-login/core"
+	"github.com/alexmk92/aws-login/core/aws_client"
+	"github.com/alexmk92/aws-login/ui"
+)
+
+// Exit codes returned by Run, these are part of the public contract for scripts
+// and CI helpers so new codes should only ever be appended.
+const (
+	ExitOK                 = iota // Login succeeded
+	ExitError                     // Unexpected failure (or the user cancelled the TUI)
+	ExitUsage                     // Invalid flags or missing values in --no-tui mode
+	ExitMFAUnavailable            // We couldn't obtain an MFA code from the driver
+	ExitAuthFailed                // STS rejected the session token or assume role request
+	ExitECRFailed                 // The session was established but the ECR login failed
+	ExitCodeArtifactFailed        // The session was established but a CodeArtifact repository couldn't be configured
+	ExitEKSFailed                 // The session was established but an EKS cluster couldn't be added to the kubeconfig
+)
+
+// Run parses the arguments and executes the requested flow, returning the exit code
+// the process should terminate with.
+func Run(args []string) int {
+	opts, err := ParseArgs(args, os.Stderr)
+	if err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return ExitOK
+		}
+		log.Error("Invalid arguments", "error", err)
+		return ExitUsage
+	}
+
+	// The TOTP store doesn't touch the AWS files, so it must keep working before they exist
+	if opts.Command == CommandMFA {
+		store, err := newTOTPStore(core.ExecRunner{})
+		if err != nil {
+			log.Error("Unable to locate the TOTP store", "error", err)
+			return ExitError
+		}
+		return runMFA(store, opts, os.Stdin, os.Stdout)
+	}
+
+	files, err := opts.CredentialFiles()
+	if err != nil {
+		log.Error("Unable to resolve AWS files", "error", err)
+		return ExitError
+	}
+
+	// Create the core AWS service to be consumed by the UI manager
+	awsService := core.NewAWSService(opts.AttemptECRLogin, files)
+	awsService.SetAPIClient(aws_client.NewClient(opts.APIConfig()))
+	awsService.SetSessionOptions(opts.Session)
+
+	if !opts.NoCache {
+		if cacheDir, err := core.DefaultSessionCacheDir(); err == nil {
+			awsService.SetSessionCache(core.NewSessionCache(cacheDir, opts.RefreshThreshold))
+		} else {
+			log.Warn("Session cache disabled", "error", err)
+		}
+	}
+
+	awsService.SetECRTargets(opts.ECRTargets)
+	awsService.SetAttemptCodeArtifactLogin(opts.AttemptCodeArtifactLogin)
+	awsService.SetAttemptEKSLogin(opts.AttemptEKSLogin)
+	awsService.SetKubeconfigPath(opts.Kubeconfig)
+
+	switch opts.Command {
+	case CommandCredentialProcess:
+		return runCredentialProcess(awsService, opts, os.Stdout)
+	case CommandDockerCredential:
+		return runDockerCredential(awsService, opts, os.Stdin, os.Stdout)
+	case CommandEKSToken:
+		return runEKSToken(awsService, opts, os.Stdout)
+	case CommandConsole:
+		return runConsole(awsService, opts, os.Stdout)
+	}
+
+	if opts.NoTUI {
+		return runHeadless(awsService, opts)
+	}
+
+	return runTUI(awsService, opts)
+}
+
+// runTUI runs the interactive Bubble Tea flow, any value supplied via flags is used
+// to skip the matching step.
+func runTUI(awsService *core.AWSService, opts Options) int {
+	// Create the UI manager for tea to consume: https://github.com/charmbracelet/bubbletea
+	uiManager := ui.Start(awsService, opts.AuthDriverName, opts.Login)
+	uiManager.SetOfferConsole(opts.OfferConsole)
+	// Now, delegate tea to utilize our uiManager
+	p := tea.NewProgram(uiManager)
+	if _, err := p.Run(); err != nil {
+		log.Error("Error AWS login", "error", err)
+		return ExitError
+	}
+
+	// After program exits, print the final output so it persists
+	if out := uiManager.FinalOutput(); out != "" {
+		// Ensure we end with a newline for shell friendliness
+		// Im only doing this until I read the bubb;etea docs
+		// properly and can figur out why it wont print my final msg
+		fmt.Println(out)
+	}
+
+	if uiManager.Err() != nil {
+		return ExitAuthFailed
+	}
+	if !uiManager.Succeeded() {
+		return ExitError
+	}
+
+	return ExitOK
+}
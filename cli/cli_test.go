@@ -0,0 +1,19 @@
+package cli
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestRun_MFAWithoutAWSFiles(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(home, ".config"))
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", filepath.Join(home, "missing-credentials"))
+	t.Setenv("AWS_CONFIG_FILE", filepath.Join(home, "missing-config"))
+
+	// Building the AWS service would exit the process, the mfa command must be handled first
+	if code := Run([]string{"mfa"}); code != ExitUsage {
+		t.Errorf("Expected exit code %d, got %d", ExitUsage, code)
+	}
+}
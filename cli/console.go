@@ -0,0 +1,50 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/charmbracelet/log"
+
+	"github.com/alexmk92/aws-login/core"
+)
+
+// runConsole runs the headless login flow and opens the AWS console signed in as the
+// session, i.e.
+//
+//	aws-login console --profile prd --role int --destination s3
+//
+// With --print (or when no browser can be opened) the sign-in URL is written to stdout
+// instead.  The URL is as good as the credentials for 15 minutes, so take care where
+// it ends up.
+func runConsole(awsService *core.AWSService, opts Options, stdout io.Writer) int {
+	// The console is the only thing we're after, nothing should be left behind for
+	// the shell helper
+	awsService.SetSessionFilePath("")
+	opts.AttemptECRLogin = false
+	opts.AttemptCodeArtifactLogin = false
+	opts.AttemptEKSLogin = false
+
+	if exitCode := runHeadless(awsService, opts); exitCode != ExitOK {
+		return exitCode
+	}
+
+	consoleURL, err := awsService.ConsoleURL(opts.ConsoleDestination)
+	if err != nil {
+		logLoginError("Unable to create a console sign-in URL", err)
+		return ExitAuthFailed
+	}
+
+	if !opts.PrintURL {
+		err := awsService.OpenURL(consoleURL)
+		if err == nil {
+			log.Info("Opened the AWS console in your browser")
+			return ExitOK
+		}
+		log.Warn("Unable to open the browser, use the URL below instead", "error", err)
+	}
+
+	fmt.Fprintln(stdout, consoleURL)
+
+	return ExitOK
+}
@@ -0,0 +1,48 @@
+package cli
+
+import (
+	"encoding/json"
+	"io"
+
+	"github.com/charmbracelet/log"
+
+	"github.com/alexmk92/aws-login/core"
+)
+
+// runCredentialProcess runs the headless login flow and prints the session as the
+// JSON document the AWS SDKs expect from a credential_process, i.e.
+//
+//	[profile prd-session]
+//	credential_process = aws-login credential-process --profile prd --driver 1password
+//
+// stdout is reserved for the JSON document, everything else is logged to stderr which
+// the SDKs surface when the process exits with a non-zero status.
+func runCredentialProcess(awsService *core.AWSService, opts Options, stdout io.Writer) int {
+	// The SDK owns the credentials, nothing should be left behind for the shell helper
+	awsService.SetSessionFilePath("")
+
+	// ECR, CodeArtifact and EKS are side effects the SDK never asked for
+	opts.AttemptECRLogin = false
+	opts.AttemptCodeArtifactLogin = false
+	opts.AttemptEKSLogin = false
+
+	// Only surface problems, SDKs tend to print stderr verbatim
+	log.SetLevel(log.WarnLevel)
+
+	if exitCode := runHeadless(awsService, opts); exitCode != ExitOK {
+		return exitCode
+	}
+
+	output, err := awsService.CredentialProcessOutput()
+	if err != nil {
+		log.Error("Unable to read the session", "error", err)
+		return ExitError
+	}
+
+	if err := json.NewEncoder(stdout).Encode(output); err != nil {
+		log.Error("Unable to write credential_process output", "error", err)
+		return ExitError
+	}
+
+	return ExitOK
+}
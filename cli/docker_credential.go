@@ -0,0 +1,150 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"github.com/charmbracelet/log"
+
+	"github.com/alexmk92/aws-login/core"
+)
+
+// DockerCredentialHelperBinary is the name docker looks for on the PATH when the
+// helper is configured as "aws-login", symlinking it to aws-login enables helper mode:
+//
+//	ln -s $(which aws-login) /usr/local/bin/docker-credential-aws-login
+//
+// and in ~/.docker/config.json
+//
+//	{"credHelpers": {"123456789012.dkr.ecr.eu-west-2.amazonaws.com": "aws-login"}}
+const DockerCredentialHelperBinary = "docker-credential-aws-login"
+
+// The message docker expects when the helper has no credentials for a registry,
+// it falls back to anonymous access rather than failing the pull
+const dockerCredentialsNotFound = "credentials not found in native keychain"
+
+// dockerCredential is the document exchanged with docker for get and store
+type dockerCredential struct {
+	ServerURL string `json:"ServerURL"`
+	Username  string `json:"Username"`
+	Secret    string `json:"Secret"`
+}
+
+// runDockerCredential implements the docker credential helper protocol, see:
+// https://github.com/docker/docker-credential-helpers#development
+//
+// Tokens are minted on demand from the (cached) session of the profile that lists the
+// registry, so store and erase have nothing to do.  Like credential_process, stdout is
+// reserved for the protocol and everything else is logged to stderr.
+func runDockerCredential(awsService *core.AWSService, opts Options, stdin io.Reader, stdout io.Writer) int {
+	if len(opts.Args) != 1 {
+		log.Error("Usage: aws-login docker-credential <get|store|erase|list>")
+		return ExitUsage
+	}
+
+	// Only surface problems, docker prints stderr verbatim
+	log.SetLevel(log.WarnLevel)
+
+	switch opts.Args[0] {
+	case "get":
+		return dockerCredentialGet(awsService, opts, stdin, stdout)
+
+	case "store", "erase":
+		// Docker still sends the payload, drain it so it never sees a broken pipe
+		_, _ = io.Copy(io.Discard, stdin)
+		return ExitOK
+
+	case "list":
+		registries := make(map[string]string)
+		for host := range awsService.GetECRRegistries() {
+			registries[host] = "AWS"
+		}
+
+		if err := json.NewEncoder(stdout).Encode(registries); err != nil {
+			log.Error("Unable to write registries", "error", err)
+			return ExitError
+		}
+		return ExitOK
+
+	default:
+		log.Error("Unknown docker credential helper action", "action", opts.Args[0])
+		return ExitUsage
+	}
+}
+
+// dockerCredentialGet logs in as the profile that lists the registry and prints a
+// fresh ECR token for it
+func dockerCredentialGet(awsService *core.AWSService, opts Options, stdin io.Reader, stdout io.Writer) int {
+	raw, err := io.ReadAll(stdin)
+	if err != nil {
+		log.Error("Unable to read the server URL", "error", err)
+		return ExitError
+	}
+	serverURL := strings.TrimSpace(string(raw))
+
+	registries := core.ParseECRRegistries(registryHost(serverURL))
+	if len(registries) != 1 {
+		fmt.Fprintln(stdout, dockerCredentialsNotFound)
+		return ExitError
+	}
+	registry := registries[0]
+
+	profile, ok := awsService.GetECRRegistries()[registry.Host()]
+	if !ok {
+		fmt.Fprintln(stdout, dockerCredentialsNotFound)
+		return ExitError
+	}
+
+	// Role profiles can't log in by themselves, assume them from their source_profile
+	// (or the only valid profile when that isn't set)
+	if slices.Contains(awsService.GetValidProfiles(), profile) {
+		opts.Login.Profile = profile
+	} else {
+		opts.Login.Role = profile
+		if credentials, err := awsService.GetCredentials(profile); err == nil && credentials.SourceProfile != "" {
+			opts.Login.Profile = credentials.SourceProfile
+		}
+	}
+
+	// Docker owns the token, nothing should be left behind for the shell helper
+	awsService.SetSessionFilePath("")
+	opts.AttemptECRLogin = false
+	opts.AttemptCodeArtifactLogin = false
+	opts.AttemptEKSLogin = false
+
+	if exitCode := runHeadless(awsService, opts); exitCode != ExitOK {
+		return exitCode
+	}
+
+	authorization, err := awsService.GetECRAuthorization(registry)
+	if err != nil {
+		logLoginError("Failed to get ECR credentials", err, "registry", registry.Host())
+		return ExitECRFailed
+	}
+
+	if err := json.NewEncoder(stdout).Encode(dockerCredential{
+		ServerURL: serverURL,
+		Username:  authorization.Username,
+		Secret:    authorization.Password,
+	}); err != nil {
+		log.Error("Unable to write credentials", "error", err)
+		return ExitError
+	}
+
+	return ExitOK
+}
+
+// registryHost strips the scheme and path docker may include in the server URL,
+// i.e. https://123456789012.dkr.ecr.eu-west-2.amazonaws.com/v2/
+func registryHost(serverURL string) string {
+	host := serverURL
+	if _, rest, ok := strings.Cut(host, "://"); ok {
+		host = rest
+	}
+	host, _, _ = strings.Cut(host, "/")
+
+	return host
+}
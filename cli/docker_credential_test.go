@@ -0,0 +1,90 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/alexmk92/aws-login/core"
+)
+
+func newDockerCredentialTestService(t *testing.T) *core.AWSService {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "credentials")
+	content := `[prd]
+aws_access_key_id = AKIAI44QH8DHBEXAMPLE
+aws_secret_access_key = je7MtGbClwBF/2Zp9Utk/h3yCo8nvbEXAMPLEKEY
+mfa_serial = arn:aws:iam::123456789012:mfa/user
+ecr_registries = 123456789012:us-east-1
+
+[int]
+assumable_role_id = arn:aws:iam::987654321098:role/OrganizationAccountAccessRole
+region = eu-west-1`
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatalf("Failed to write test credentials: %v", err)
+	}
+
+	return core.NewAWSService(false, core.CredentialFiles{Credentials: []string{path}})
+}
+
+func TestRunDockerCredential_List(t *testing.T) {
+	awsService := newDockerCredentialTestService(t)
+
+	var stdout bytes.Buffer
+	exitCode := runDockerCredential(awsService, Options{Args: []string{"list"}}, strings.NewReader(""), &stdout)
+	if exitCode != ExitOK {
+		t.Fatalf("Expected ExitOK, got %d", exitCode)
+	}
+
+	var registries map[string]string
+	if err := json.Unmarshal(stdout.Bytes(), &registries); err != nil {
+		t.Fatalf("Expected JSON output, got '%s'", stdout.String())
+	}
+
+	expected := []string{
+		"123456789012.dkr.ecr.us-east-1.amazonaws.com",
+		"987654321098.dkr.ecr.eu-west-1.amazonaws.com",
+	}
+	if len(registries) != len(expected) {
+		t.Errorf("Expected %d registries, got %v", len(expected), registries)
+	}
+	for _, host := range expected {
+		if registries[host] != "AWS" {
+			t.Errorf("Expected registry '%s' with username AWS, got %v", host, registries)
+		}
+	}
+}
+
+func TestRunDockerCredential_UnknownRegistry(t *testing.T) {
+	awsService := newDockerCredentialTestService(t)
+
+	var stdout bytes.Buffer
+	exitCode := runDockerCredential(awsService, Options{Args: []string{"get"}}, strings.NewReader("https://index.docker.io/v1/\n"), &stdout)
+	if exitCode == ExitOK {
+		t.Errorf("Expected a failure for a registry we don't manage")
+	}
+	if strings.TrimSpace(stdout.String()) != dockerCredentialsNotFound {
+		t.Errorf("Expected '%s', got '%s'", dockerCredentialsNotFound, stdout.String())
+	}
+}
+
+func TestRegistryHost(t *testing.T) {
+	tests := []struct {
+		serverURL string
+		expected  string
+	}{
+		{"123456789012.dkr.ecr.eu-west-2.amazonaws.com", "123456789012.dkr.ecr.eu-west-2.amazonaws.com"},
+		{"https://123456789012.dkr.ecr.eu-west-2.amazonaws.com", "123456789012.dkr.ecr.eu-west-2.amazonaws.com"},
+		{"https://123456789012.dkr.ecr.eu-west-2.amazonaws.com/v2/", "123456789012.dkr.ecr.eu-west-2.amazonaws.com"},
+	}
+
+	for _, tt := range tests {
+		if got := registryHost(tt.serverURL); got != tt.expected {
+			t.Errorf("Expected '%s', got '%s'", tt.expected, got)
+		}
+	}
+}
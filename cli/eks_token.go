@@ -0,0 +1,51 @@
+package cli
+
+import (
+	"encoding/json"
+	"io"
+
+	"github.com/charmbracelet/log"
+
+	"github.com/alexmk92/aws-login/core"
+)
+
+// runEKSToken runs the headless login flow and prints a token for the cluster as the
+// ExecCredential document kubectl expects from an exec plugin.  This is what the user
+// entries written by --eks run, i.e.
+//
+//	aws-login eks-token --cluster prd --region eu-west-2 --profile prd
+//
+// Like credential_process, stdout is reserved for the document and everything else is
+// logged to stderr, which kubectl shows when the plugin fails.
+func runEKSToken(awsService *core.AWSService, opts Options, stdout io.Writer) int {
+	if opts.EKSCluster == "" {
+		log.Error("Usage: aws-login eks-token --cluster NAME [--region REGION] [--profile PROFILE] [--role ROLE]")
+		return ExitUsage
+	}
+
+	// kubectl owns the token, nothing should be left behind for the shell helper
+	awsService.SetSessionFilePath("")
+	opts.AttemptECRLogin = false
+	opts.AttemptCodeArtifactLogin = false
+	opts.AttemptEKSLogin = false
+
+	// Only surface problems, kubectl prints stderr verbatim
+	log.SetLevel(log.WarnLevel)
+
+	if exitCode := runHeadless(awsService, opts); exitCode != ExitOK {
+		return exitCode
+	}
+
+	credential, err := awsService.EKSExecCredential(opts.EKSCluster, opts.Region)
+	if err != nil {
+		log.Error("Unable to create EKS token", "cluster", opts.EKSCluster, "error", err)
+		return ExitError
+	}
+
+	if err := json.NewEncoder(stdout).Encode(credential); err != nil {
+		log.Error("Unable to write ExecCredential", "error", err)
+		return ExitError
+	}
+
+	return ExitOK
+}
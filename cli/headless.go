@@ -0,0 +1,280 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/charmbracelet/log"
+
+	"github.com/alexmk92/aws-login/core"
+	"github.com/alexmk92/aws-login/core/auth_drivers"
+	"github.com/alexmk92/aws-login/core/types"
+)
+
+// runHeadless drives the AWS service directly without the TUI, this is what CI
+// helpers and Makefiles use.  Every value we would normally prompt for must either
+// be supplied via flags or be derivable (i.e. a single valid profile, or a driver
+// that can yield MFA codes).
+func runHeadless(awsService *core.AWSService, opts Options) int {
+	profile := opts.Login.Profile
+	if profile == "" {
+		profiles := awsService.GetValidProfiles()
+		if len(profiles) != 1 {
+			log.Error("--profile is required when more than one valid profile is configured", "profiles", profiles)
+			return ExitUsage
+		}
+		profile = profiles[0]
+	}
+
+	role, err := awsService.ResolveAssumableRole(profile, opts.Login.Role)
+	if err != nil {
+		log.Error("Unable to resolve role", "role", opts.Login.Role, "error", err)
+		return ExitUsage
+	}
+
+	if awsService.IsSSOProfile(profile) {
+		if exitCode := establishSSOSession(awsService, profile, role.Arn); exitCode != ExitOK {
+			return exitCode
+		}
+	} else {
+		// Roles passed as a raw ARN may not belong to a profile, in that case
+		// we keep reporting the base profile as the active one
+		assumedProfileName := role.Profile
+		if role.Arn != "" && assumedProfileName == "" {
+			assumedProfileName = profile
+		}
+
+		if exitCode := establishSession(awsService, opts, profile, role.Arn, assumedProfileName); exitCode != ExitOK {
+			return exitCode
+		}
+	}
+
+	if opts.AttemptECRLogin {
+		results, err := awsService.LoginToECR()
+		for _, result := range results {
+			if result.Err != nil {
+				logLoginError("Failed to login to ECR", result.Err, "registry", result.Registry.Host(), "target", result.Target)
+			} else {
+				log.Info("Logged in to ECR", "registry", result.Registry.Host(), "target", result.Target)
+			}
+		}
+		if err != nil {
+			if len(results) == 0 {
+				logLoginError("Failed to login to ECR", err)
+			}
+			return ExitECRFailed
+		}
+	}
+
+	if opts.AttemptCodeArtifactLogin {
+		results, err := awsService.LoginToCodeArtifact()
+		for _, result := range results {
+			repository := result.Repository.Domain + "/" + result.Repository.Repository
+			if result.Err != nil {
+				logLoginError("Failed to configure CodeArtifact", result.Err, "repository", repository, "format", result.Repository.Format)
+			} else {
+				log.Info("Configured CodeArtifact", "repository", repository, "format", result.Repository.Format)
+			}
+		}
+		if err != nil {
+			if len(results) == 0 {
+				logLoginError("Failed to configure CodeArtifact", err)
+			}
+			return ExitCodeArtifactFailed
+		}
+	}
+
+	if opts.AttemptEKSLogin {
+		results, err := awsService.UpdateKubeconfig()
+		for _, result := range results {
+			if result.Err != nil {
+				logLoginError("Failed to add EKS cluster to the kubeconfig", result.Err, "cluster", result.Cluster.Name)
+			} else {
+				log.Info("Added EKS cluster to the kubeconfig", "cluster", result.Cluster.Name, "context", result.Context)
+			}
+		}
+		if err != nil {
+			if len(results) == 0 {
+				logLoginError("Failed to update the kubeconfig", err)
+			}
+			return ExitEKSFailed
+		}
+	}
+
+	return ExitOK
+}
+
+// establishSession reuses a cached session where possible and only falls back to
+// requesting a new one (which needs an MFA code) when the cache can't satisfy it.
+func establishSession(awsService *core.AWSService, opts Options, profile, roleArn, assumedProfileName string) int {
+	if roleArn != "" {
+		restored, err := awsService.RestoreAssumedRole(profile, roleArn, assumedProfileName)
+		if err != nil {
+			log.Error("Failed to restore cached role session", "role", roleArn, "error", err)
+			return ExitError
+		}
+		if restored {
+			log.Info("Reusing cached role session", "profile", assumedProfileName, "role", roleArn)
+			return ExitOK
+		}
+	}
+
+	restored, err := awsService.RestoreSession(profile)
+	if err != nil {
+		log.Error("Failed to restore cached session", "profile", profile, "error", err)
+		return ExitError
+	}
+
+	if restored {
+		log.Info("Reusing cached session", "profile", profile)
+	} else {
+		if exitCode := getSessionToken(awsService, opts, profile); exitCode != ExitOK {
+			return exitCode
+		}
+		log.Info("Session established", "profile", profile)
+	}
+
+	if roleArn != "" {
+		// Only chains through intermediate roles are worth logging hop by hop
+		progress := func(hops []types.RoleHop, index int) {
+			if len(hops) > 1 {
+				log.Info("Assuming role", "hop", fmt.Sprintf("%d/%d", index+1, len(hops)), "profile", hops[index].Profile, "role", hops[index].RoleArn)
+			}
+		}
+		if _, err := awsService.AssumeRoleChain(assumedProfileName, roleArn, progress); err != nil {
+			logLoginError("Failed to assume role", err, "role", roleArn)
+			return ExitAuthFailed
+		}
+		log.Info("Assumed role", "profile", assumedProfileName, "role", roleArn)
+	}
+
+	return ExitOK
+}
+
+// establishSSOSession gets credentials for the IAM Identity Center role, which is
+// given as ACCOUNT_ID/ROLE_NAME.  Without a cached token the device authorization
+// URL is logged for the user to approve, we then wait for them to do so.
+func establishSSOSession(awsService *core.AWSService, profile, role string) int {
+	if role == "" {
+		log.Error("--role ACCOUNT_ID/ROLE_NAME is required unless the profile sets sso_account_id and sso_role_name", "profile", profile)
+		return ExitUsage
+	}
+
+	restored, err := awsService.RestoreAssumedRole(profile, role, profile)
+	if err != nil {
+		log.Error("Failed to restore cached role session", "role", role, "error", err)
+		return ExitError
+	}
+	if restored {
+		log.Info("Reusing cached role session", "profile", profile, "role", role)
+		return ExitOK
+	}
+
+	if !awsService.HasSSOToken(profile) {
+		authorization, err := awsService.StartSSOLogin(profile)
+		if err != nil {
+			logLoginError("Failed to start IAM Identity Center login", err, "profile", profile)
+			return ExitAuthFailed
+		}
+
+		// Logged as a warning so it still shows up when only problems are surfaced
+		log.Warn("Approve the IAM Identity Center login in your browser",
+			"url", authorization.VerificationURIComplete, "code", authorization.UserCode)
+
+		if err := awsService.WaitForSSOLogin(context.Background(), profile, authorization); err != nil {
+			logLoginError("IAM Identity Center login failed", err, "profile", profile)
+			return ExitAuthFailed
+		}
+	}
+
+	if _, err := awsService.SSOLogin(profile, role); err != nil {
+		logLoginError("Failed to get role credentials", err, "role", role)
+		return ExitAuthFailed
+	}
+	log.Info("Session established", "profile", profile, "role", role)
+
+	return ExitOK
+}
+
+// getSessionToken requests a session with a fresh MFA code.  When STS rejects the code
+// because another terminal already used it, and the code came from a driver, we wait
+// for the next TOTP window and try again rather than failing the whole login.
+func getSessionToken(awsService *core.AWSService, opts Options, profile string) int {
+	for attempt := 0; ; attempt++ {
+		mfaCode, exitCode := resolveMFACode(awsService, opts, profile)
+		if exitCode != ExitOK {
+			return exitCode
+		}
+
+		_, err := awsService.GetSessionToken(profile, mfaCode)
+		if err == nil {
+			return ExitOK
+		}
+
+		// Codes supplied via --mfa can't be refreshed, so there is nothing to wait for
+		if !core.IsErrorKind(err, core.ErrorKindMFACodeReused) || opts.Login.MFACode != "" || attempt >= core.MaxMFARetries {
+			logLoginError("Failed to get session token", err, "profile", profile)
+			return ExitAuthFailed
+		}
+
+		wait := core.TimeUntilNextMFACode(time.Now())
+		log.Warn("MFA code already used, waiting for a fresh code", "wait", wait.Round(time.Second))
+		time.Sleep(wait)
+	}
+}
+
+// resolveMFACode returns the MFA code supplied via --mfa, falling back to the auth
+// driver when it is able to yield codes without user interaction.
+func resolveMFACode(awsService *core.AWSService, opts Options, profile string) (string, int) {
+	if opts.Login.MFACode != "" {
+		if !awsService.ValidateMFACode(opts.Login.MFACode) {
+			log.Error("Invalid MFA code - must be 6 digits")
+			return "", ExitUsage
+		}
+		return opts.Login.MFACode, ExitOK
+	}
+
+	if opts.AuthDriverName == auth_drivers.AuthDriverUnknown || opts.AuthDriverName == auth_drivers.AuthDriverManual {
+		log.Error("--mfa is required unless --driver can fetch MFA codes (i.e. 1password)")
+		return "", ExitUsage
+	}
+
+	driver, err := auth_drivers.GetDriver(opts.AuthDriverName, profile, awsService.Runner())
+	if err != nil {
+		log.Error("Unable to initialise auth driver", "driver", opts.AuthDriverName.String(), "error", err)
+		return "", ExitMFAUnavailable
+	}
+
+	// The vault password is asked for on the terminal, without one there's nowhere to ask
+	if unlockable, ok := driver.(types.UnlockableDriver); ok && unlockable.NeedsPassword() {
+		password, err := readPassword(fmt.Sprintf("Password to unlock %s: ", driver.Name()))
+		if err != nil {
+			log.Error("The driver needs a password to unlock the vault, use the interactive UI or --mfa", "driver", driver.Name(), "error", err)
+			return "", ExitMFAUnavailable
+		}
+		unlockable.Unlock(password)
+	}
+
+	mfaCode, err := awsService.GetMFACode(driver)
+	if err != nil {
+		log.Error("Unable to fetch MFA code", "driver", driver.Name(), "error", err)
+		return "", ExitMFAUnavailable
+	}
+
+	return mfaCode, ExitOK
+}
+
+// logLoginError logs the error along with the explanation and suggested fix when
+// the failure could be classified
+func logLoginError(msg string, err error, keyvals ...any) {
+	keyvals = append(keyvals, "error", err)
+
+	var loginErr *core.LoginError
+	if errors.As(err, &loginErr) && loginErr.Explanation() != "" {
+		keyvals = append(keyvals, "reason", loginErr.Explanation(), "fix", loginErr.Suggestion())
+	}
+
+	log.Error(msg, keyvals...)
+}
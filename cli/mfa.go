@@ -0,0 +1,129 @@
+package cli
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/charmbracelet/log"
+
+	"github.com/alexmk92/aws-login/core"
+	"github.com/alexmk92/aws-login/core/types"
+)
+
+const mfaUsage = "Usage: aws-login mfa import NAME [OTPAUTH_URI] | aws-login mfa list"
+
+// runMFA manages the seeds used by the totp driver, i.e.
+//
+//	zbarimg -q --raw qr.png | aws-login mfa import prd
+//
+// NAME is the profile's vault_key, or the profile name when it doesn't have one.  The
+// seed is read from stdin when it isn't passed as an argument, which keeps it out of
+// the shell history.  The store passphrase is asked for on the terminal when it isn't
+// in the keyring.
+func runMFA(store *core.TOTPStore, opts Options, stdin io.Reader, stdout io.Writer) int {
+	if len(opts.Args) == 0 {
+		log.Error(mfaUsage)
+		return ExitUsage
+	}
+
+	switch opts.Args[0] {
+	case "import":
+		return runMFAImport(store, opts.Args[1:], stdin)
+	case "list":
+		var names []string
+		err := withTOTPPassphrase(store, func() (err error) {
+			names, err = store.Names()
+			return err
+		})
+		if err != nil {
+			log.Error("Unable to read the TOTP store", "error", err)
+			return ExitError
+		}
+		for _, name := range names {
+			fmt.Fprintln(stdout, name)
+		}
+		return ExitOK
+	default:
+		log.Error(mfaUsage)
+		return ExitUsage
+	}
+}
+
+func runMFAImport(store *core.TOTPStore, args []string, stdin io.Reader) int {
+	if len(args) == 0 || len(args) > 2 || strings.TrimSpace(args[0]) == "" {
+		log.Error(mfaUsage)
+		return ExitUsage
+	}
+	name := strings.TrimSpace(args[0])
+
+	value := ""
+	if len(args) == 2 {
+		value = args[1]
+	} else {
+		line, err := bufio.NewReader(stdin).ReadString('\n')
+		if err != nil && err != io.EOF {
+			log.Error("Unable to read the seed from stdin", "error", err)
+			return ExitError
+		}
+		value = line
+	}
+
+	seed, err := core.ParseTOTPSeed(value)
+	if err != nil {
+		log.Error("Invalid TOTP seed", "error", err)
+		return ExitUsage
+	}
+
+	if err := withTOTPPassphrase(store, func() error { return store.Import(name, seed) }); err != nil {
+		log.Error("Unable to import the TOTP seed", "name", name, "error", err)
+		return ExitError
+	}
+
+	log.Info("Imported TOTP seed", "name", name, "issuer", seed.Issuer, "account", seed.Account)
+	return ExitOK
+}
+
+// withTOTPPassphrase runs fn, asking for the store passphrase on the terminal (and
+// running it again) when it isn't in the keyring
+func withTOTPPassphrase(store *core.TOTPStore, fn func() error) error {
+	err := fn()
+	if !errors.Is(err, core.ErrTOTPPassphraseNeeded) {
+		return err
+	}
+
+	prompt := "TOTP store passphrase: "
+	if !store.Exists() {
+		prompt = "Choose a TOTP store passphrase: "
+	}
+	passphrase, promptErr := readPassword(prompt)
+	if promptErr != nil {
+		return fmt.Errorf("%w, set %s to pass it from the environment", err, core.TOTPPassphraseEnv)
+	}
+
+	// A new store has its passphrase chosen here, so make sure it was typed correctly
+	if !store.Exists() {
+		repeated, err := readPassword("Repeat the passphrase: ")
+		if err != nil {
+			return err
+		}
+		if passphrase != repeated {
+			return fmt.Errorf("the passphrases don't match")
+		}
+	}
+
+	store.SetPassphrase(passphrase)
+	return fn()
+}
+
+// newTOTPStore opens the default TOTP store
+func newTOTPStore(runner types.Runner) (*core.TOTPStore, error) {
+	path, err := core.DefaultTOTPStorePath()
+	if err != nil {
+		return nil, err
+	}
+
+	return core.NewTOTPStore(path, runner), nil
+}
@@ -0,0 +1,267 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/alexmk92/aws-login/core"
+	"github.com/alexmk92/aws-login/core/auth_drivers"
+	"github.com/alexmk92/aws-login/core/aws_client"
+	"github.com/alexmk92/aws-login/core/types"
+)
+
+// Subcommands, the default (empty) command runs the login flow
+const (
+	CommandLogin             = ""
+	CommandCredentialProcess = "credential-process"
+	CommandDockerCredential  = "docker-credential"
+	CommandEKSToken          = "eks-token"
+	CommandConsole           = "console"
+	CommandMFA               = "mfa"
+)
+
+// Options holds everything that can be configured from the command line
+type Options struct {
+	Command         string
+	Args            []string // Positional arguments following the subcommand
+	Login           types.LoginOptions
+	AuthDriverName  auth_drivers.AuthDriverName
+	NoTUI           bool
+	AttemptECRLogin bool
+
+	// Configure package managers for the CodeArtifact repositories on the profile
+	AttemptCodeArtifactLogin bool
+
+	// Add the profile's EKS clusters to the kubeconfig, Kubeconfig is passed to kubectl
+	AttemptEKSLogin bool
+	Kubeconfig      string
+
+	// The cluster (and its region) eks-token mints a token for
+	EKSCluster string
+	Region     string
+
+	// Where the console subcommand lands, and whether to print the URL instead of opening it
+	ConsoleDestination string
+	PrintURL           bool
+
+	// Keep the interactive success screen up so the console can be opened from it
+	OfferConsole bool
+
+	// Session cache settings
+	NoCache          bool
+	RefreshThreshold time.Duration
+
+	// Explicit AWS files, these replace the default (or environment) locations
+	CredentialsFiles []string
+	ConfigFiles      []string
+
+	// Endpoint overrides, these win over the AWS_ENDPOINT_URL_* environment variables
+	STSEndpoint          string
+	ECREndpoint          string
+	CodeArtifactEndpoint string
+	EKSEndpoint          string
+
+	// ECR login targets, --docker-config is shorthand for --ecr-target docker-config
+	ECRTargets   []string
+	DockerConfig bool
+
+	// STS parameter overrides, these win over the values configured on the profile
+	Session types.SessionOptions
+}
+
+// ParseArgs parses the command line arguments (excluding the binary name) into Options.
+//
+// The AWS_LOGIN_AUTH_DRIVER environment variable is used as the default driver, an
+// explicit --driver flag always wins.  Any positional argument keeps the legacy behaviour
+// of enabling the ECR login (i.e. `aws-login attempt-ecr-login`).
+func ParseArgs(args []string, output io.Writer) (Options, error) {
+	opts := Options{
+		AuthDriverName:   auth_drivers.AuthDriverUnknown,
+		RefreshThreshold: core.DefaultRefreshThreshold,
+	}
+
+	if thresholdStr := os.Getenv("AWS_LOGIN_REFRESH_THRESHOLD"); thresholdStr != "" {
+		if threshold, err := time.ParseDuration(thresholdStr); err == nil {
+			opts.RefreshThreshold = threshold
+		}
+	}
+
+	// Just demonstrating how you can assign a variable AND assert on it immediately
+	// inside of an if statement
+	if driverStr := os.Getenv("AWS_LOGIN_AUTH_DRIVER"); driverStr != "" {
+		// Again with our inline assertion so we can assign the driver with the safely parsed type
+		if driver, err := auth_drivers.ParseAuthDriver(driverStr); err == nil {
+			opts.AuthDriverName = driver
+		}
+	}
+
+	var driverStr string
+	var duration, sessionDuration time.Duration
+	opts.Session.Tags = make(map[string]string)
+
+	fs := flag.NewFlagSet("aws-login", flag.ContinueOnError)
+	fs.SetOutput(output)
+	fs.StringVar(&opts.Login.Profile, "profile", "", "profile to log in with, skips the profile selection")
+	fs.StringVar(&opts.Login.Role, "role", "", "profile name or role ARN to assume, skips the role selection")
+	fs.StringVar(&driverStr, "driver", "", "auth driver to use (manual, 1password, totp, bitwarden, pass, keepassxc or a plugin), skips the driver selection")
+	fs.StringVar(&opts.Login.MFACode, "mfa", "", "6-digit MFA code, skips the MFA prompt")
+	fs.BoolVar(&opts.NoTUI, "no-tui", false, "run without the interactive UI, every missing value is an error")
+	fs.BoolVar(&opts.AttemptECRLogin, "ecr", false, "attempt to log in to ECR once the session is established")
+	fs.BoolVar(&opts.AttemptCodeArtifactLogin, "codeartifact", false, "configure npm, pip, maven and go for the profile's CodeArtifact repositories")
+	fs.BoolVar(&opts.AttemptEKSLogin, "eks", false, "add the profile's EKS clusters to the kubeconfig")
+	fs.StringVar(&opts.Kubeconfig, "kubeconfig", "", "kubeconfig to update instead of KUBECONFIG or ~/.kube/config")
+	fs.StringVar(&opts.EKSCluster, "cluster", "", "EKS cluster to create a token for (eks-token)")
+	fs.StringVar(&opts.Region, "region", "", "region of the EKS cluster, defaults to eks_clusters or the profile's region (eks-token)")
+	fs.StringVar(&opts.ConsoleDestination, "destination", "", "console page to open, i.e. s3 or ec2/home#Instances (console)")
+	fs.BoolVar(&opts.PrintURL, "print", false, "print the console sign-in URL instead of opening the browser (console)")
+	fs.BoolVar(&opts.OfferConsole, "offer-console", false, "keep the success screen open so the console can be opened with c")
+	fs.BoolVar(&opts.NoCache, "no-cache", false, "always request a new session instead of reusing a cached one")
+	fs.DurationVar(&opts.RefreshThreshold, "refresh-threshold", opts.RefreshThreshold, "refresh cached sessions expiring sooner than this")
+	fs.Var((*stringList)(&opts.CredentialsFiles), "credentials-file", "credentials file to load, repeat to merge several files in order")
+	fs.Var((*stringList)(&opts.ConfigFiles), "config-file", "config file to load, repeat to merge several files in order")
+	fs.StringVar(&opts.STSEndpoint, "sts-endpoint", "", "STS endpoint URL, i.e. a VPC or FIPS endpoint")
+	fs.StringVar(&opts.ECREndpoint, "ecr-endpoint", "", "ECR API endpoint URL, i.e. a VPC or FIPS endpoint")
+	fs.StringVar(&opts.CodeArtifactEndpoint, "codeartifact-endpoint", "", "CodeArtifact API endpoint URL, i.e. a VPC endpoint")
+	fs.StringVar(&opts.EKSEndpoint, "eks-endpoint", "", "EKS API endpoint URL, i.e. a VPC endpoint")
+	fs.BoolVar(&opts.DockerConfig, "docker-config", false, "write ECR credentials to the docker config instead of running docker login")
+	fs.Var((*stringList)(&opts.ECRTargets), "ecr-target", "tool to log in to ECR with (docker, docker-config, podman, nerdctl, helm, oras), repeat for several")
+	fs.DurationVar(&duration, "duration", 0, "lifetime of the assumed role session, i.e. 12h")
+	fs.DurationVar(&sessionDuration, "session-duration", 0, "lifetime of the MFA session, i.e. 36h")
+	fs.StringVar(&opts.Session.RoleSessionName, "role-session-name", "", "role session name, supports {user}, {host} and {profile}")
+	fs.StringVar(&opts.Session.ExternalID, "external-id", "", "external ID required by the role's trust policy")
+	fs.StringVar(&opts.Session.SourceIdentity, "source-identity", "", "source identity for the role session, supports the same placeholders")
+	fs.Var((tagMap)(opts.Session.Tags), "tag", "session tag as Key=Value, repeat to add several tags")
+
+	positional, err := parseInterspersed(fs, args)
+	if err != nil {
+		return opts, err
+	}
+
+	// Targets may be repeated or comma separated, validate them up front
+	targets, err := core.ParseECRTargets(strings.Join(opts.ECRTargets, ","))
+	if err != nil {
+		return opts, err
+	}
+	opts.ECRTargets = targets
+	if opts.DockerConfig && !slices.Contains(opts.ECRTargets, core.ECRTargetDockerConfig) {
+		opts.ECRTargets = append(opts.ECRTargets, core.ECRTargetDockerConfig)
+	}
+
+	opts.Session.DurationSeconds = int(duration.Seconds())
+	opts.Session.SessionDurationSeconds = int(sessionDuration.Seconds())
+
+	if driverStr != "" {
+		driver, err := auth_drivers.ParseAuthDriver(driverStr)
+		if err != nil {
+			return opts, err
+		}
+		opts.AuthDriverName = driver
+	}
+
+	if len(positional) > 0 {
+		switch positional[0] {
+		case CommandCredentialProcess, CommandDockerCredential, CommandEKSToken, CommandConsole, CommandMFA:
+			opts.Command = positional[0]
+			opts.Args = positional[1:]
+		default:
+			// Arg1 used to be the only way to request an ECR login, keep honouring it
+			opts.AttemptECRLogin = true
+		}
+	}
+
+	return opts, nil
+}
+
+// CredentialFiles resolves the AWS files to load, flags win over the environment
+// variables which in turn win over the ~/.aws defaults.
+func (o Options) CredentialFiles() (core.CredentialFiles, error) {
+	files, err := core.DefaultCredentialFiles()
+	if err != nil {
+		return files, err
+	}
+
+	if len(o.CredentialsFiles) > 0 {
+		files.Credentials = o.CredentialsFiles
+	}
+	if len(o.ConfigFiles) > 0 {
+		files.Config = o.ConfigFiles
+	}
+
+	return files, nil
+}
+
+// APIConfig resolves the AWS client config, flags win over the environment
+func (o Options) APIConfig() aws_client.Config {
+	config := aws_client.ConfigFromEnv()
+
+	if o.STSEndpoint != "" {
+		config.STSEndpoint = o.STSEndpoint
+	}
+	if o.ECREndpoint != "" {
+		config.ECREndpoint = o.ECREndpoint
+	}
+	if o.CodeArtifactEndpoint != "" {
+		config.CodeArtifactEndpoint = o.CodeArtifactEndpoint
+	}
+	if o.EKSEndpoint != "" {
+		config.EKSEndpoint = o.EKSEndpoint
+	}
+
+	return config
+}
+
+// stringList is a flag.Value that collects every occurrence of a repeated flag
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// tagMap is a flag.Value that collects repeated Key=Value flags
+type tagMap map[string]string
+
+func (m tagMap) String() string {
+	pairs := make([]string, 0, len(m))
+	for key, value := range m {
+		pairs = append(pairs, key+"="+value)
+	}
+	return strings.Join(pairs, ",")
+}
+
+func (m tagMap) Set(value string) error {
+	key, tagValue, ok := strings.Cut(value, "=")
+	if !ok || strings.TrimSpace(key) == "" {
+		return fmt.Errorf("expected Key=Value, got '%s'", value)
+	}
+	m[strings.TrimSpace(key)] = strings.TrimSpace(tagValue)
+	return nil
+}
+
+// parseInterspersed parses flags that may appear either side of positional arguments,
+// the standard flag package stops parsing at the first non-flag argument.
+func parseInterspersed(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+
+		if fs.NArg() == 0 {
+			return positional, nil
+		}
+
+		positional = append(positional, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+}
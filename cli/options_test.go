@@ -0,0 +1,226 @@
+package cli
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/alexmk92/aws-login/core/auth_drivers"
+)
+
+func TestParseArgs(t *testing.T) {
+	tests := []struct {
+		name            string
+		args            []string
+		envDriver       string
+		expectedProfile string
+		expectedRole    string
+		expectedMFA     string
+		expectedDriver  auth_drivers.AuthDriverName
+		expectedNoTUI   bool
+		expectedECR     bool
+		expectedCommand string
+		expectError     bool
+	}{
+		{
+			name:           "no arguments",
+			args:           []string{},
+			expectedDriver: auth_drivers.AuthDriverUnknown,
+		},
+		{
+			name:           "legacy positional argument enables ECR",
+			args:           []string{"attempt-ecr-login"},
+			expectedDriver: auth_drivers.AuthDriverUnknown,
+			expectedECR:    true,
+		},
+		{
+			name:            "all flags supplied",
+			args:            []string{"--profile", "prd", "--role", "int", "--driver", "1password", "--mfa", "123456", "--no-tui"},
+			expectedProfile: "prd",
+			expectedRole:    "int",
+			expectedMFA:     "123456",
+			expectedDriver:  auth_drivers.AuthDriver1Password,
+			expectedNoTUI:   true,
+		},
+		{
+			name:            "flags after the positional argument",
+			args:            []string{"attempt-ecr-login", "--profile", "prd"},
+			expectedProfile: "prd",
+			expectedDriver:  auth_drivers.AuthDriverUnknown,
+			expectedECR:     true,
+		},
+		{
+			name:            "credential-process subcommand does not enable ECR",
+			args:            []string{"credential-process", "--profile", "prd"},
+			expectedProfile: "prd",
+			expectedDriver:  auth_drivers.AuthDriverUnknown,
+			expectedCommand: CommandCredentialProcess,
+		},
+		{
+			name:            "docker-credential subcommand",
+			args:            []string{"docker-credential", "get"},
+			expectedDriver:  auth_drivers.AuthDriverUnknown,
+			expectedCommand: CommandDockerCredential,
+		},
+		{
+			name:           "driver from environment",
+			args:           []string{},
+			envDriver:      "1password",
+			expectedDriver: auth_drivers.AuthDriver1Password,
+		},
+		{
+			name:           "driver flag overrides environment",
+			args:           []string{"--driver", "manual"},
+			envDriver:      "1password",
+			expectedDriver: auth_drivers.AuthDriverManual,
+		},
+		{
+			name:        "invalid driver flag",
+			args:        []string{"--driver", "lastpass"},
+			expectError: true,
+		},
+		{
+			name:        "unknown flag",
+			args:        []string{"--nope"},
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("AWS_LOGIN_AUTH_DRIVER", tt.envDriver)
+
+			opts, err := ParseArgs(tt.args, io.Discard)
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("Expected error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if opts.Login.Profile != tt.expectedProfile {
+				t.Errorf("Expected profile '%s', got '%s'", tt.expectedProfile, opts.Login.Profile)
+			}
+			if opts.Login.Role != tt.expectedRole {
+				t.Errorf("Expected role '%s', got '%s'", tt.expectedRole, opts.Login.Role)
+			}
+			if opts.Login.MFACode != tt.expectedMFA {
+				t.Errorf("Expected MFA code '%s', got '%s'", tt.expectedMFA, opts.Login.MFACode)
+			}
+			if opts.AuthDriverName != tt.expectedDriver {
+				t.Errorf("Expected driver '%s', got '%s'", tt.expectedDriver, opts.AuthDriverName)
+			}
+			if opts.NoTUI != tt.expectedNoTUI {
+				t.Errorf("Expected NoTUI=%v, got %v", tt.expectedNoTUI, opts.NoTUI)
+			}
+			if opts.Command != tt.expectedCommand {
+				t.Errorf("Expected command '%s', got '%s'", tt.expectedCommand, opts.Command)
+			}
+			if opts.AttemptECRLogin != tt.expectedECR {
+				t.Errorf("Expected AttemptECRLogin=%v, got %v", tt.expectedECR, opts.AttemptECRLogin)
+			}
+		})
+	}
+}
+
+func TestParseArgs_SessionOptions(t *testing.T) {
+	opts, err := ParseArgs([]string{
+		"--duration", "12h",
+		"--session-duration", "36h",
+		"--role-session-name", "{user}-{host}",
+		"--external-id", "external",
+		"--source-identity", "{user}",
+		"--tag", "team=platform",
+		"--tag", "env=prd",
+	}, io.Discard)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if opts.Session.DurationSeconds != 43200 {
+		t.Errorf("Expected DurationSeconds 43200, got %d", opts.Session.DurationSeconds)
+	}
+	if opts.Session.SessionDurationSeconds != 129600 {
+		t.Errorf("Expected SessionDurationSeconds 129600, got %d", opts.Session.SessionDurationSeconds)
+	}
+	if opts.Session.RoleSessionName != "{user}-{host}" || opts.Session.SourceIdentity != "{user}" {
+		t.Errorf("Expected templates to be kept for expansion, got '%s' '%s'", opts.Session.RoleSessionName, opts.Session.SourceIdentity)
+	}
+	if opts.Session.ExternalID != "external" {
+		t.Errorf("Expected ExternalID 'external', got '%s'", opts.Session.ExternalID)
+	}
+	if opts.Session.Tags["team"] != "platform" || opts.Session.Tags["env"] != "prd" {
+		t.Errorf("Expected both tags, got %v", opts.Session.Tags)
+	}
+
+	if _, err := ParseArgs([]string{"--tag", "nope"}, io.Discard); err == nil {
+		t.Errorf("Expected an error for a tag without a value")
+	}
+}
+
+func TestParseArgs_ECRTargets(t *testing.T) {
+	opts, err := ParseArgs([]string{"--ecr-target", "podman,helm", "--ecr-target", "oras", "--docker-config"}, io.Discard)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := "podman,helm,oras,docker-config"
+	if strings.Join(opts.ECRTargets, ",") != expected {
+		t.Errorf("Expected targets '%s', got %v", expected, opts.ECRTargets)
+	}
+
+	if _, err := ParseArgs([]string{"--ecr-target", "skopeo"}, io.Discard); err == nil {
+		t.Errorf("Expected an error for an unknown target")
+	}
+}
+
+func TestParseArgs_EKSToken(t *testing.T) {
+	opts, err := ParseArgs([]string{"eks-token", "--cluster", "prd", "--region", "eu-west-1", "--profile", "prd", "--role", "int"}, io.Discard)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if opts.Command != CommandEKSToken {
+		t.Errorf("Expected command '%s', got '%s'", CommandEKSToken, opts.Command)
+	}
+	if opts.EKSCluster != "prd" || opts.Region != "eu-west-1" {
+		t.Errorf("Expected cluster 'prd' in 'eu-west-1', got '%s' in '%s'", opts.EKSCluster, opts.Region)
+	}
+	if opts.AttemptECRLogin {
+		t.Errorf("Expected the subcommand not to enable the ECR login")
+	}
+}
+
+func TestParseArgs_Console(t *testing.T) {
+	opts, err := ParseArgs([]string{"console", "--role", "int", "--destination", "s3", "--print"}, io.Discard)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if opts.Command != CommandConsole || opts.ConsoleDestination != "s3" || !opts.PrintURL {
+		t.Errorf("Unexpected options %+v", opts)
+	}
+
+	opts, err = ParseArgs([]string{"--role", "int", "--offer-console"}, io.Discard)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if opts.Command != CommandLogin || !opts.OfferConsole {
+		t.Errorf("Expected --offer-console to keep the success screen open, got %+v", opts)
+	}
+}
+
+func TestParseArgs_MFA(t *testing.T) {
+	opts, err := ParseArgs([]string{"mfa", "import", "prd"}, io.Discard)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if opts.Command != CommandMFA || strings.Join(opts.Args, " ") != "import prd" || opts.AttemptECRLogin {
+		t.Errorf("Unexpected options %+v", opts)
+	}
+}
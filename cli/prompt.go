@@ -0,0 +1,31 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/charmbracelet/x/term"
+)
+
+// errNoTerminal is returned when a password is needed but stdin isn't a terminal,
+// passwords are never read from a pipe
+var errNoTerminal = errors.New("no terminal to ask for the password on")
+
+// readPassword asks for a password on the terminal without echoing it, the prompt
+// goes to stderr so it never mixes with output meant for another program
+func readPassword(prompt string) (string, error) {
+	fd := os.Stdin.Fd()
+	if !term.IsTerminal(fd) {
+		return "", errNoTerminal
+	}
+
+	fmt.Fprint(os.Stderr, prompt)
+	password, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", fmt.Errorf("failed to read the password: %w", err)
+	}
+
+	return string(password), nil
+}
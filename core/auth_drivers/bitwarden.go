@@ -0,0 +1,168 @@
+package auth_drivers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/alexmk92/aws-login/core"
+	"github.com/alexmk92/aws-login/core/types"
+)
+
+// BitwardenDriver implements Bitwarden MFA token retrieval through the bw CLI.  A
+// locked vault is unlocked with the master password supplied by the caller, both the
+// password and the resulting session key are only ever held in memory.
+type BitwardenDriver struct {
+	vaultKey string
+	profile  string
+	runner   types.Runner
+	password string
+	session  string
+}
+
+// This is a type assertion to the compiler to ensure that BitwardenDriver implements the UnlockableDriver
+// interface if the constraints aren't met, the compiler will throw an error
+//
+// We do this because we have a @factory.go file that returns a types.Driver interface and we need to
+// ensure that if someone bypases the factory and tries to create a BitwardenDriver directly,
+// the compiler will throw an error
+var _ types.UnlockableDriver = (*BitwardenDriver)(nil)
+
+// NewBitwardenDriver creates a new Bitwarden driver, the item is the profile's vault_key
+func NewBitwardenDriver(profile string, runner types.Runner) *BitwardenDriver {
+	credentialReader := core.GetCredentialReader()
+	credential, exists := credentialReader.GetCredential(profile)
+
+	vaultKey := ""
+	if exists {
+		vaultKey = credential.VaultKey
+	}
+
+	return &BitwardenDriver{vaultKey: vaultKey, profile: profile, runner: core.RunnerOrDefault(runner)}
+}
+
+// GetToken retrieves MFA token from Bitwarden
+func (d *BitwardenDriver) GetToken() (string, error) {
+	return d.GetMFACode()
+}
+
+// Name returns the name of the driver
+func (d *BitwardenDriver) Name() string {
+	return "bitwarden"
+}
+
+func (d *BitwardenDriver) YieldsMFACode() bool {
+	return true
+}
+
+// GetMFACode runs `bw get totp`, bw picks the unlocked session up from BW_SESSION
+// unless we have unlocked the vault ourselves.  --nointeraction stops bw prompting for
+// the master password, which would hang the TUI, so a locked vault is reported as an
+// error instead.
+func (d *BitwardenDriver) GetMFACode() (string, error) {
+	if d.session == "" && d.password != "" {
+		if err := d.unlock(); err != nil {
+			return "", err
+		}
+	}
+
+	command := types.Command{Name: "bw", Args: []string{"get", "totp", d.vaultKey, "--nointeraction"}}
+	if d.session != "" {
+		command.Env = []string{"BW_SESSION=" + d.session}
+	}
+
+	result, err := d.runner.Run(command)
+
+	if err != nil {
+		if hint := d.unlockHint(); hint != "" {
+			return "", fmt.Errorf("failed to retrieve MFA code from Bitwarden with item %s, %s: %w", d.vaultKey, hint, err)
+		}
+		return "", fmt.Errorf("failed to retrieve MFA code from Bitwarden with item %s: %w", d.vaultKey, err)
+	}
+
+	mfaCode := strings.TrimSpace(result.Stdout)
+	if mfaCode == "" {
+		return "", fmt.Errorf("empty MFA code from Bitwarden")
+	}
+
+	return mfaCode, nil
+}
+
+func (d BitwardenDriver) IsInstalled() bool {
+	_, err := core.RunnerOrDefault(d.runner).Run(types.Command{Name: "bw", Args: []string{"--version"}})
+	return err == nil
+}
+
+// NeedsPassword reports whether the vault is locked and there's no session to use
+func (d *BitwardenDriver) NeedsPassword() bool {
+	if d.session != "" || d.password != "" || os.Getenv("BW_SESSION") != "" {
+		return false
+	}
+
+	return d.status() == "locked"
+}
+
+// Unlock sets the master password used to unlock the vault
+func (d *BitwardenDriver) Unlock(password string) {
+	d.password = password
+}
+
+// unlock runs `bw unlock --raw` for a session key, the password is written to stdin
+// so it never shows up in the process list.  A rejected password is forgotten so the
+// caller can ask for it again.
+func (d *BitwardenDriver) unlock() error {
+	result, err := d.runner.Run(types.Command{Name: "bw", Args: []string{"unlock", "--raw"}, Stdin: d.password + "\n"})
+	d.password = ""
+
+	if err != nil {
+		var commandErr *types.CommandError
+		if errors.As(err, &commandErr) && strings.Contains(commandErr.Result.Stderr, "Invalid master password") {
+			return fmt.Errorf("incorrect master password for Bitwarden")
+		}
+		return fmt.Errorf("failed to unlock the Bitwarden vault: %w", err)
+	}
+
+	d.session = strings.TrimSpace(result.Stdout)
+	if d.session == "" {
+		return fmt.Errorf("no session key from `bw unlock`")
+	}
+
+	return nil
+}
+
+// unlockHint explains how to fix a vault that isn't unlocked
+func (d *BitwardenDriver) unlockHint() string {
+	switch d.status() {
+	case "unauthenticated":
+		return "log in with `bw login` then run `export BW_SESSION=$(bw unlock --raw)`"
+	case "locked":
+		return "the vault is locked, run `export BW_SESSION=$(bw unlock --raw)`"
+	default:
+		return ""
+	}
+}
+
+// status returns what bw status reports, unauthenticated, locked or unlocked, or
+// nothing when bw can't tell us
+func (d *BitwardenDriver) status() string {
+	command := types.Command{Name: "bw", Args: []string{"status", "--nointeraction"}}
+	if d.session != "" {
+		command.Env = []string{"BW_SESSION=" + d.session}
+	}
+
+	result, err := d.runner.Run(command)
+	if err != nil {
+		return ""
+	}
+
+	var status struct {
+		Status string `json:"status"`
+	}
+	if err := json.Unmarshal([]byte(result.Stdout), &status); err != nil {
+		return ""
+	}
+
+	return status.Status
+}
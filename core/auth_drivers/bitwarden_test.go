@@ -0,0 +1,157 @@
+package auth_drivers
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/alexmk92/aws-login/core/coretest"
+	"github.com/alexmk92/aws-login/core/types"
+)
+
+func TestBitwardenDriver_GetMFACode(t *testing.T) {
+	loadTestCredentials(t, `[prd]
+vault_key = AWS MFA prd`)
+
+	tests := []struct {
+		name          string
+		totp          types.CommandResult
+		status        *types.CommandResult
+		expectedCode  string
+		expectedError string
+	}{
+		{
+			name:         "code is trimmed",
+			totp:         types.CommandResult{Stdout: "123456\n"},
+			expectedCode: "123456",
+		},
+		{
+			name:          "empty output",
+			totp:          types.CommandResult{Stdout: "\n"},
+			expectedError: "empty MFA code",
+		},
+		{
+			name:          "locked vault explains how to unlock",
+			totp:          types.CommandResult{Stderr: "Vault is locked.", ExitCode: 1},
+			status:        &types.CommandResult{Stdout: `{"serverUrl":null,"status":"locked"}`},
+			expectedError: "bw unlock --raw",
+		},
+		{
+			name:          "logged out explains how to log in",
+			totp:          types.CommandResult{Stderr: "You are not logged in.", ExitCode: 1},
+			status:        &types.CommandResult{Stdout: `{"serverUrl":null,"status":"unauthenticated"}`},
+			expectedError: "bw login",
+		},
+		{
+			name:          "unknown item",
+			totp:          types.CommandResult{Stderr: "Not found.", ExitCode: 1},
+			status:        &types.CommandResult{Stdout: `{"serverUrl":null,"status":"unlocked"}`},
+			expectedError: "Not found.",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runner := coretest.NewFakeRunner().On("bw get totp", tt.totp)
+			if tt.status != nil {
+				runner.On("bw status", *tt.status)
+			}
+			driver := NewBitwardenDriver("prd", runner)
+
+			code, err := driver.GetMFACode()
+			if tt.expectedError != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.expectedError) {
+					t.Errorf("Expected error containing '%s', got %v", tt.expectedError, err)
+				}
+			} else if err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+
+			if code != tt.expectedCode {
+				t.Errorf("Expected code '%s', got '%s'", tt.expectedCode, code)
+			}
+
+			if coretest.CommandLine(runner.Calls[0]) != "bw get totp AWS MFA prd --nointeraction" {
+				t.Errorf("Unexpected commands %v", runner.CommandLines())
+			}
+		})
+	}
+}
+
+func TestBitwardenDriver_IsInstalled(t *testing.T) {
+	installed := coretest.NewFakeRunner().On("bw --version", types.CommandResult{Stdout: "2024.9.0\n"})
+	if !NewBitwardenDriver("", installed).IsInstalled() {
+		t.Errorf("Expected driver to be installed when bw --version succeeds")
+	}
+
+	if NewBitwardenDriver("", coretest.NewFakeRunner()).IsInstalled() {
+		t.Errorf("Expected driver to be unavailable when bw is missing")
+	}
+}
+
+func TestBitwardenDriver_Unlock(t *testing.T) {
+	loadTestCredentials(t, `[prd]
+vault_key = AWS MFA prd`)
+	t.Setenv("BW_SESSION", "")
+
+	tests := []struct {
+		name          string
+		unlock        types.CommandResult
+		expectedCode  string
+		expectedError string
+	}{
+		{
+			name:         "session is passed to bw get totp",
+			unlock:       types.CommandResult{Stdout: "c2Vzc2lvbg==\n"},
+			expectedCode: "123456",
+		},
+		{
+			name:          "wrong master password",
+			unlock:        types.CommandResult{Stderr: "Invalid master password.", ExitCode: 1},
+			expectedError: "incorrect master password",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runner := coretest.NewFakeRunner().
+				On("bw status", types.CommandResult{Stdout: `{"serverUrl":null,"status":"locked"}`}).
+				On("bw unlock --raw", tt.unlock).
+				On("bw get totp", types.CommandResult{Stdout: "123456\n"})
+			driver := NewBitwardenDriver("prd", runner)
+
+			if !driver.NeedsPassword() {
+				t.Fatalf("Expected a locked vault to need the master password")
+			}
+			driver.Unlock("hunter2")
+
+			code, err := driver.GetMFACode()
+			if tt.expectedError != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.expectedError) {
+					t.Errorf("Expected error containing '%s', got %v", tt.expectedError, err)
+				}
+				if !driver.NeedsPassword() {
+					t.Errorf("Expected a rejected password to be asked for again")
+				}
+			} else if err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+
+			if code != tt.expectedCode {
+				t.Errorf("Expected code '%s', got '%s'", tt.expectedCode, code)
+			}
+
+			for _, call := range runner.Calls {
+				switch coretest.CommandLine(call) {
+				case "bw unlock --raw":
+					if call.Stdin != "hunter2\n" {
+						t.Errorf("Expected the password on stdin, got '%s'", call.Stdin)
+					}
+				case "bw get totp AWS MFA prd --nointeraction":
+					if len(call.Env) != 1 || call.Env[0] != "BW_SESSION=c2Vzc2lvbg==" {
+						t.Errorf("Expected the session to be passed in the environment, got %v", call.Env)
+					}
+				}
+			}
+		})
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"strings"
 
+	"github.com/alexmk92/aws-login/core"
 	"github.com/alexmk92/aws-login/core/types"
 )
 
@@ -13,7 +14,11 @@ type AuthDriverName int
 const (
 	AuthDriverManual AuthDriverName = iota
 	AuthDriver1Password
-	AuthDriverUnknown
+	AuthDriverTOTP
+	AuthDriverBitwarden
+	AuthDriverPass
+	AuthDriverKeePassXC
+	AuthDriverUnknown // Plugins are numbered from here, see RegisterPlugin
 )
 
 // String returns the string representation of the auth driver
@@ -23,35 +28,115 @@ func (d AuthDriverName) String() string {
 		return "manual"
 	case AuthDriver1Password:
 		return "1password"
+	case AuthDriverTOTP:
+		return "totp"
+	case AuthDriverBitwarden:
+		return "bitwarden"
+	case AuthDriverPass:
+		return "pass"
+	case AuthDriverKeePassXC:
+		return "keepassxc"
 	default:
+		if plugin, ok := PluginFor(d); ok {
+			return plugin.Name
+		}
 		return "unknown"
 	}
 }
 
-// ParseAuthDriver parses a string to AuthDriver
+// ParseAuthDriver parses a string to AuthDriver, names that aren't built in are looked
+// up among the plugins
 func ParseAuthDriver(s string) (AuthDriverName, error) {
+	driver, err := parseBuiltinAuthDriver(s)
+	if err == nil {
+		return driver, nil
+	}
+
+	name := strings.ToLower(strings.TrimSpace(s))
+	if driver, ok := pluginDriverName(name); ok {
+		return driver, nil
+	}
+
+	// Discovery reads every directory on the PATH, so it's only done when a plugin is asked for
+	discovered := DiscoverPlugins()
+	if driver, ok := pluginDriverName(name); ok {
+		return driver, nil
+	}
+
+	names := make([]string, 0, len(discovered))
+	for _, plugin := range discovered {
+		names = append(names, plugin.Name)
+	}
+
+	if len(names) > 0 {
+		return AuthDriverManual, fmt.Errorf("%w, or one of the plugins: %s", err, strings.Join(names, ", "))
+	}
+	return AuthDriverManual, err
+}
+
+func parseBuiltinAuthDriver(s string) (AuthDriverName, error) {
 	switch strings.ToLower(strings.TrimSpace(s)) {
 	case "manual":
 		return AuthDriverManual, nil
 	case "1password":
 		return AuthDriver1Password, nil
+	case "totp":
+		return AuthDriverTOTP, nil
+	case "bitwarden":
+		return AuthDriverBitwarden, nil
+	case "pass", "gopass":
+		return AuthDriverPass, nil
+	case "keepassxc":
+		return AuthDriverKeePassXC, nil
 	default:
-		return AuthDriverManual, fmt.Errorf("invalid auth driver '%s', valid options are: manual, 1password", s)
+		return AuthDriverManual, fmt.Errorf("invalid auth driver '%s', valid options are: manual, 1password, totp, bitwarden, pass, keepassxc", s)
 	}
 }
 
-// GetDriver returns the appropriate auth driver based on the driver type
-func GetDriver(driverType AuthDriverName, profile string) (types.Driver, error) {
+// GetDriver returns the appropriate auth driver based on the driver type, drivers
+// that shell out use the runner for every external process
+func GetDriver(driverType AuthDriverName, profile string, runner types.Runner) (types.Driver, error) {
 	switch driverType {
 	case AuthDriverManual:
 		return NewManualDriver(), nil
 	case AuthDriver1Password:
-		driver := NewOnePasswordDriver(profile)
+		driver := NewOnePasswordDriver(profile, runner)
 		if !driver.IsInstalled() {
 			return nil, fmt.Errorf("1Password CLI is not installed or not available in PATH")
 		}
 		return driver, nil
+	case AuthDriverTOTP:
+		driver := NewTOTPDriver(profile, runner)
+		if !driver.IsInstalled() {
+			return nil, core.ErrTOTPStoreMissing
+		}
+		return driver, nil
+	case AuthDriverBitwarden:
+		driver := NewBitwardenDriver(profile, runner)
+		if !driver.IsInstalled() {
+			return nil, fmt.Errorf("Bitwarden CLI is not installed or not available in PATH")
+		}
+		return driver, nil
+	case AuthDriverPass:
+		driver := NewPassDriver(profile, runner)
+		if !driver.IsInstalled() {
+			return nil, fmt.Errorf("neither gopass nor pass is installed or available in PATH")
+		}
+		return driver, nil
+	case AuthDriverKeePassXC:
+		driver := NewKeePassXCDriver(profile, runner)
+		if !driver.IsInstalled() {
+			return nil, fmt.Errorf("keepassxc-cli is not installed or not available in PATH")
+		}
+		return driver, nil
 	default:
+		if plugin, ok := PluginFor(driverType); ok {
+			driver := NewPluginDriver(plugin, profile, runner)
+			if !driver.IsInstalled() {
+				return nil, fmt.Errorf("the %s plugin reports it is not installed (%s)", plugin.Name, plugin.Path)
+			}
+			return driver, nil
+		}
 		return nil, fmt.Errorf("unknown auth driver: %v", driverType)
 	}
 }
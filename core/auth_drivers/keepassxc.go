@@ -0,0 +1,115 @@
+package auth_drivers
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/alexmk92/aws-login/core"
+	"github.com/alexmk92/aws-login/core/types"
+)
+
+// KeePassXCDatabaseEnv is the database used by profiles without keepassxc_database
+const KeePassXCDatabaseEnv = "AWS_LOGIN_KEEPASSXC_DATABASE"
+
+// KeePassXCDriver implements KeePassXC MFA token retrieval through keepassxc-cli, the
+// database password is supplied by the caller and only ever held in memory
+type KeePassXCDriver struct {
+	vaultKey string
+	database string
+	password string
+	runner   types.Runner
+}
+
+// This is a type assertion to the compiler to ensure that KeePassXCDriver implements the UnlockableDriver
+// interface (and so the Driver interface), if the constraints aren't met, the compiler will throw an error
+//
+// We do this because we have a @factory.go file that returns a types.Driver interface and we need to
+// ensure that if someone bypases the factory and tries to create a KeePassXCDriver directly,
+// the compiler will throw an error
+var _ types.UnlockableDriver = (*KeePassXCDriver)(nil)
+
+// NewKeePassXCDriver creates a new KeePassXC driver, the entry is the profile's vault_key
+// and the database is keepassxc_database or AWS_LOGIN_KEEPASSXC_DATABASE
+func NewKeePassXCDriver(profile string, runner types.Runner) *KeePassXCDriver {
+	credentialReader := core.GetCredentialReader()
+	credential, exists := credentialReader.GetCredential(profile)
+
+	vaultKey, database := "", os.Getenv(KeePassXCDatabaseEnv)
+	if exists {
+		vaultKey = credential.VaultKey
+		if credential.KeePassXCDatabase != "" {
+			database = credential.KeePassXCDatabase
+		}
+	}
+
+	if home, err := os.UserHomeDir(); err == nil {
+		database = core.ExpandHome(database, home)
+	}
+
+	return &KeePassXCDriver{vaultKey: vaultKey, database: database, runner: core.RunnerOrDefault(runner)}
+}
+
+// GetToken retrieves MFA token from KeePassXC
+func (d *KeePassXCDriver) GetToken() (string, error) {
+	return d.GetMFACode()
+}
+
+// Name returns the name of the driver
+func (d *KeePassXCDriver) Name() string {
+	return "keepassxc"
+}
+
+func (d *KeePassXCDriver) YieldsMFACode() bool {
+	return true
+}
+
+// GetMFACode runs `keepassxc-cli totp`, the password is written to stdin so it never
+// shows up in the process list.  A rejected password is forgotten so the caller
+// can ask for it again.
+func (d *KeePassXCDriver) GetMFACode() (string, error) {
+	if d.database == "" {
+		return "", fmt.Errorf("no KeePassXC database configured, set keepassxc_database on the profile or %s", KeePassXCDatabaseEnv)
+	}
+	if d.NeedsPassword() {
+		return "", fmt.Errorf("the KeePassXC database %s is locked", d.database)
+	}
+
+	result, err := d.runner.Run(types.Command{
+		Name:  "keepassxc-cli",
+		Args:  []string{"totp", "--quiet", d.database, d.vaultKey},
+		Stdin: d.password + "\n",
+	})
+
+	if err != nil {
+		var commandErr *types.CommandError
+		if errors.As(err, &commandErr) && strings.Contains(commandErr.Result.Stderr, "Invalid credentials") {
+			d.password = ""
+			return "", fmt.Errorf("incorrect password for the KeePassXC database %s", d.database)
+		}
+		return "", fmt.Errorf("failed to retrieve MFA code from KeePassXC with entry %s: %w", d.vaultKey, err)
+	}
+
+	mfaCode := strings.TrimSpace(result.Stdout)
+	if mfaCode == "" {
+		return "", fmt.Errorf("empty MFA code from KeePassXC")
+	}
+
+	return mfaCode, nil
+}
+
+func (d KeePassXCDriver) IsInstalled() bool {
+	_, err := core.RunnerOrDefault(d.runner).Run(types.Command{Name: "keepassxc-cli", Args: []string{"--version"}})
+	return err == nil
+}
+
+// NeedsPassword reports whether the database still has to be unlocked
+func (d *KeePassXCDriver) NeedsPassword() bool {
+	return d.password == ""
+}
+
+// Unlock sets the password used to open the database
+func (d *KeePassXCDriver) Unlock(password string) {
+	d.password = password
+}
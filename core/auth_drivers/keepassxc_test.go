@@ -0,0 +1,84 @@
+package auth_drivers
+
+import (
+	"testing"
+
+	"github.com/alexmk92/aws-login/core/coretest"
+	"github.com/alexmk92/aws-login/core/types"
+)
+
+func TestKeePassXCDriver_GetMFACode(t *testing.T) {
+	loadTestCredentials(t, `[prd]
+vault_key = AWS/prd
+keepassxc_database = /vaults/work.kdbx
+
+[stg]
+vault_key = AWS/stg`)
+	t.Setenv(KeePassXCDatabaseEnv, "~/vaults/global.kdbx")
+	t.Setenv("HOME", "/home/test")
+
+	runner := coretest.NewFakeRunner().On("keepassxc-cli totp", types.CommandResult{Stdout: "123456\n"})
+	driver := NewKeePassXCDriver("prd", runner)
+
+	if !driver.NeedsPassword() {
+		t.Fatalf("Expected a new driver to need the database password")
+	}
+	if _, err := driver.GetMFACode(); err == nil || len(runner.Calls) != 0 {
+		t.Errorf("Expected a locked driver to fail without running keepassxc-cli")
+	}
+
+	driver.Unlock("hunter2")
+	code, err := driver.GetMFACode()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if code != "123456" {
+		t.Errorf("Expected code '123456', got '%s'", code)
+	}
+
+	call := runner.Calls[0]
+	if coretest.CommandLine(call) != "keepassxc-cli totp --quiet /vaults/work.kdbx AWS/prd" || call.Stdin != "hunter2\n" {
+		t.Errorf("Unexpected command %s with stdin %q", coretest.CommandLine(call), call.Stdin)
+	}
+
+	// Profiles without keepassxc_database use the global database, ~ is the home directory
+	stg := NewKeePassXCDriver("stg", runner)
+	stg.Unlock("hunter2")
+	if _, err := stg.GetMFACode(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if line := coretest.CommandLine(runner.Calls[1]); line != "keepassxc-cli totp --quiet /home/test/vaults/global.kdbx AWS/stg" {
+		t.Errorf("Unexpected command %s", line)
+	}
+}
+
+func TestKeePassXCDriver_RejectedPassword(t *testing.T) {
+	loadTestCredentials(t, `[prd]
+vault_key = AWS/prd
+keepassxc_database = /vaults/work.kdbx`)
+
+	runner := coretest.NewFakeRunner().On("keepassxc-cli totp", types.CommandResult{
+		Stderr:   "Error while reading the database: Invalid credentials were provided, please try again.",
+		ExitCode: 1,
+	})
+	driver := NewKeePassXCDriver("prd", runner)
+	driver.Unlock("wrong")
+
+	if _, err := driver.GetMFACode(); err == nil {
+		t.Fatalf("Expected an error for a rejected password")
+	}
+	if !driver.NeedsPassword() {
+		t.Errorf("Expected a rejected password to be forgotten")
+	}
+}
+
+func TestKeePassXCDriver_IsInstalled(t *testing.T) {
+	installed := coretest.NewFakeRunner().On("keepassxc-cli --version", types.CommandResult{Stdout: "2.7.9\n"})
+	if !NewKeePassXCDriver("", installed).IsInstalled() {
+		t.Errorf("Expected driver to be installed when keepassxc-cli --version succeeds")
+	}
+
+	if NewKeePassXCDriver("", coretest.NewFakeRunner()).IsInstalled() {
+		t.Errorf("Expected driver to be unavailable when keepassxc-cli is missing")
+	}
+}
@@ -2,7 +2,6 @@ package auth_drivers
 
 import (
 	"fmt"
-	"os/exec"
 	"strings"
 
 	"github.com/alexmk92/aws-login/core"
@@ -13,6 +12,7 @@ import (
 type OnePasswordDriver struct {
 	vaultKey string
 	profile  string
+	runner   types.Runner
 }
 
 // This is a type assertion to the compiler to ensure that OnePasswordDriver implements the Driver interface
@@ -23,8 +23,9 @@ type OnePasswordDriver struct {
 // the compiler will throw an error
 var _ types.Driver = (*OnePasswordDriver)(nil)
 
-// NewOnePasswordDriver creates a new 1Password driver
-func NewOnePasswordDriver(profile string) *OnePasswordDriver {
+// NewOnePasswordDriver creates a new 1Password driver, every op invocation goes
+// through the runner so the driver can be tested without the 1Password CLI
+func NewOnePasswordDriver(profile string, runner types.Runner) *OnePasswordDriver {
 	credentialReader := core.GetCredentialReader()
 	credential, exists := credentialReader.GetCredential(profile)
 
@@ -33,19 +34,18 @@ func NewOnePasswordDriver(profile string) *OnePasswordDriver {
 		vaultKey = credential.VaultKey
 	}
 
-	return &OnePasswordDriver{vaultKey: vaultKey, profile: profile}
+	return &OnePasswordDriver{vaultKey: vaultKey, profile: profile, runner: core.RunnerOrDefault(runner)}
 }
 
 // GetToken retrieves MFA token from 1Password
 func (d *OnePasswordDriver) GetToken() (string, error) {
-	cmd := exec.Command("op", "item", "get", d.vaultKey, "--otp")
-	output, err := cmd.Output()
+	result, err := d.runner.Run(types.Command{Name: "op", Args: []string{"item", "get", d.vaultKey, "--otp"}})
 
 	if err != nil {
 		return "", fmt.Errorf("failed to retrieve MFA code from 1Password: %w", err)
 	}
 
-	mfaCode := strings.TrimSpace(string(output))
+	mfaCode := strings.TrimSpace(result.Stdout)
 	if mfaCode == "" {
 		return "", fmt.Errorf("empty MFA code from 1Password")
 	}
@@ -63,14 +63,13 @@ func (d *OnePasswordDriver) YieldsMFACode() bool {
 }
 
 func (d *OnePasswordDriver) GetMFACode() (string, error) {
-	cmd := exec.Command("op", "item", "get", d.vaultKey, "--otp")
-	output, err := cmd.Output()
+	result, err := d.runner.Run(types.Command{Name: "op", Args: []string{"item", "get", d.vaultKey, "--otp"}})
 
 	if err != nil {
 		return "", fmt.Errorf("failed to retrieve MFA code from 1Password with vault key %s: %w", d.vaultKey, err)
 	}
 
-	mfaCode := strings.TrimSpace(string(output))
+	mfaCode := strings.TrimSpace(result.Stdout)
 	if mfaCode == "" {
 		return "", fmt.Errorf("empty MFA code from 1Password")
 	}
@@ -79,7 +78,6 @@ func (d *OnePasswordDriver) GetMFACode() (string, error) {
 }
 
 func (d OnePasswordDriver) IsInstalled() bool {
-	cmd := exec.Command("op", "--version")
-	err := cmd.Run()
+	_, err := core.RunnerOrDefault(d.runner).Run(types.Command{Name: "op", Args: []string{"--version"}})
 	return err == nil
 }
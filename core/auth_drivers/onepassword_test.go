@@ -0,0 +1,87 @@
+package auth_drivers
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/alexmk92/aws-login/core"
+	"github.com/alexmk92/aws-login/core/coretest"
+	"github.com/alexmk92/aws-login/core/types"
+)
+
+func loadTestCredentials(t *testing.T, content string) {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "credentials")
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatalf("Failed to write test credentials: %v", err)
+	}
+
+	if err := core.NewCredentialReader().LoadFiles(core.CredentialFiles{Credentials: []string{path}}); err != nil {
+		t.Fatalf("Failed to load test credentials: %v", err)
+	}
+}
+
+func TestOnePasswordDriver_GetMFACode(t *testing.T) {
+	loadTestCredentials(t, `[prd]
+vault_key = AWS MFA prd`)
+
+	tests := []struct {
+		name         string
+		result       types.CommandResult
+		expectedCode string
+		expectError  bool
+	}{
+		{
+			name:         "code is trimmed",
+			result:       types.CommandResult{Stdout: "123456\n"},
+			expectedCode: "123456",
+		},
+		{
+			name:        "empty output",
+			result:      types.CommandResult{Stdout: "\n"},
+			expectError: true,
+		},
+		{
+			name:        "op exits with an error",
+			result:      types.CommandResult{Stderr: "[ERROR] You are not currently signed in", ExitCode: 1},
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runner := coretest.NewFakeRunner().On("op item get", tt.result)
+			driver := NewOnePasswordDriver("prd", runner)
+
+			code, err := driver.GetMFACode()
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("Expected error but got none")
+				}
+			} else if err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+
+			if code != tt.expectedCode {
+				t.Errorf("Expected code '%s', got '%s'", tt.expectedCode, code)
+			}
+
+			if len(runner.Calls) != 1 || coretest.CommandLine(runner.Calls[0]) != "op item get AWS MFA prd --otp" {
+				t.Errorf("Unexpected commands %v", runner.CommandLines())
+			}
+		})
+	}
+}
+
+func TestOnePasswordDriver_IsInstalled(t *testing.T) {
+	installed := coretest.NewFakeRunner().On("op --version", types.CommandResult{Stdout: "2.30.0\n"})
+	if !NewOnePasswordDriver("", installed).IsInstalled() {
+		t.Errorf("Expected driver to be installed when op --version succeeds")
+	}
+
+	if NewOnePasswordDriver("", coretest.NewFakeRunner()).IsInstalled() {
+		t.Errorf("Expected driver to be unavailable when op is missing")
+	}
+}
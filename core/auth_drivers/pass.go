@@ -0,0 +1,90 @@
+package auth_drivers
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/alexmk92/aws-login/core"
+	"github.com/alexmk92/aws-login/core/types"
+)
+
+// PassDriver implements MFA token retrieval from the standard unix password store,
+// through gopass or pass with the pass-otp extension
+type PassDriver struct {
+	vaultKey string
+	profile  string
+	runner   types.Runner
+}
+
+// This is a type assertion to the compiler to ensure that PassDriver implements the Driver interface
+// if the constraints aren't met, the compiler will throw an error
+//
+// We do this because we have a @factory.go file that returns a types.Driver interface and we need to
+// ensure that if someone bypases the factory and tries to create a PassDriver directly,
+// the compiler will throw an error
+var _ types.Driver = (*PassDriver)(nil)
+
+// NewPassDriver creates a new pass driver, the profile's vault_key is the path of the
+// entry in the password store, i.e. aws/prd
+func NewPassDriver(profile string, runner types.Runner) *PassDriver {
+	credentialReader := core.GetCredentialReader()
+	credential, exists := credentialReader.GetCredential(profile)
+
+	vaultKey := ""
+	if exists {
+		vaultKey = credential.VaultKey
+	}
+
+	return &PassDriver{vaultKey: vaultKey, profile: profile, runner: core.RunnerOrDefault(runner)}
+}
+
+// GetToken retrieves MFA token from the password store
+func (d *PassDriver) GetToken() (string, error) {
+	return d.GetMFACode()
+}
+
+// Name returns the name of the driver
+func (d *PassDriver) Name() string {
+	return "pass"
+}
+
+func (d *PassDriver) YieldsMFACode() bool {
+	return true
+}
+
+// GetMFACode runs `gopass otp` (or `pass otp`), gopass follows the code with how long
+// it lasts so only the first field is used
+func (d *PassDriver) GetMFACode() (string, error) {
+	binary := d.binary()
+	if binary == "" {
+		return "", fmt.Errorf("neither gopass nor pass is installed or available in PATH")
+	}
+
+	result, err := d.runner.Run(types.Command{Name: binary, Args: []string{"otp", d.vaultKey}})
+	if err != nil {
+		return "", fmt.Errorf("failed to retrieve MFA code from %s with path %s: %w", binary, d.vaultKey, err)
+	}
+
+	fields := strings.Fields(result.Stdout)
+	if len(fields) == 0 {
+		return "", fmt.Errorf("empty MFA code from %s", binary)
+	}
+
+	return fields[0], nil
+}
+
+func (d PassDriver) IsInstalled() bool {
+	return d.binary() != ""
+}
+
+// binary returns the password store CLI to use, gopass is preferred as it supports
+// OTP without an extension
+func (d PassDriver) binary() string {
+	runner := core.RunnerOrDefault(d.runner)
+	for _, name := range []string{"gopass", "pass"} {
+		if _, err := runner.Run(types.Command{Name: name, Args: []string{"--version"}}); err == nil {
+			return name
+		}
+	}
+	return ""
+}
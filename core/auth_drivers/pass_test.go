@@ -0,0 +1,75 @@
+package auth_drivers
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/alexmk92/aws-login/core/coretest"
+	"github.com/alexmk92/aws-login/core/types"
+)
+
+func TestPassDriver_GetMFACode(t *testing.T) {
+	loadTestCredentials(t, `[prd]
+vault_key = aws/prd`)
+
+	tests := []struct {
+		name             string
+		runner           *coretest.FakeRunner
+		expectedCode     string
+		expectedCommands []string
+		expectError      bool
+	}{
+		{
+			name: "gopass is preferred and the lifetime is ignored",
+			runner: coretest.NewFakeRunner().
+				On("gopass --version", types.CommandResult{Stdout: "gopass 1.15.13\n"}).
+				On("pass --version", types.CommandResult{Stdout: "v1.7.4\n"}).
+				On("gopass otp", types.CommandResult{Stdout: "123456 lasts 21s \t|------   |\n"}),
+			expectedCode:     "123456",
+			expectedCommands: []string{"gopass --version", "gopass otp aws/prd"},
+		},
+		{
+			name: "pass with pass-otp",
+			runner: coretest.NewFakeRunner().
+				On("pass --version", types.CommandResult{Stdout: "v1.7.4\n"}).
+				On("pass otp", types.CommandResult{Stdout: "654321\n"}),
+			expectedCode:     "654321",
+			expectedCommands: []string{"gopass --version", "pass --version", "pass otp aws/prd"},
+		},
+		{
+			name: "entry without an otpauth URI",
+			runner: coretest.NewFakeRunner().
+				On("pass --version", types.CommandResult{Stdout: "v1.7.4\n"}).
+				On("pass otp", types.CommandResult{Stderr: "Error: aws/prd is not in the password store.", ExitCode: 1}),
+			expectedCommands: []string{"gopass --version", "pass --version", "pass otp aws/prd"},
+			expectError:      true,
+		},
+		{
+			name:             "neither CLI is installed",
+			runner:           coretest.NewFakeRunner(),
+			expectedCommands: []string{"gopass --version", "pass --version"},
+			expectError:      true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, err := NewPassDriver("prd", tt.runner).GetMFACode()
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("Expected error but got none")
+				}
+			} else if err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+
+			if code != tt.expectedCode {
+				t.Errorf("Expected code '%s', got '%s'", tt.expectedCode, code)
+			}
+
+			if !slices.Equal(tt.runner.CommandLines(), tt.expectedCommands) {
+				t.Errorf("Expected commands %v, got %v", tt.expectedCommands, tt.runner.CommandLines())
+			}
+		})
+	}
+}
@@ -0,0 +1,299 @@
+package auth_drivers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alexmk92/aws-login/core"
+	"github.com/alexmk92/aws-login/core/types"
+)
+
+// PluginPrefix is the executable name prefix of external drivers, aws-login-driver-hsm
+// is offered as the hsm driver
+const PluginPrefix = "aws-login-driver-"
+
+// PluginsEnv lists plugin executables explicitly, separated like PATH.  They win over
+// plugins with the same name found on the PATH.
+const PluginsEnv = "AWS_LOGIN_DRIVER_PLUGINS"
+
+// PluginProtocolVersion is the version of the JSON protocol spoken to plugins, it is
+// bumped whenever a change would break existing plugins
+const PluginProtocolVersion = 1
+
+// PluginTimeout bounds describe and is-installed, a hung plugin must not hold up the
+// driver list
+const PluginTimeout = 3 * time.Second
+
+// PluginMFACodeTimeout bounds get-mfa-code, which may wait on the user, i.e. to touch
+// a hardware key
+const PluginMFACodeTimeout = 60 * time.Second
+
+// Plugin commands, the command is passed both as the only argument and in the request
+const (
+	PluginCommandDescribe    = "describe"
+	PluginCommandIsInstalled = "is-installed"
+	PluginCommandGetMFACode  = "get-mfa-code"
+)
+
+// PluginRequest is written to the plugin's stdin
+type PluginRequest struct {
+	Version int            `json:"version"`
+	Command string         `json:"command"`
+	Profile *PluginProfile `json:"profile,omitempty"` // Only sent with get-mfa-code
+}
+
+// PluginProfile is the metadata of the profile a code is requested for
+type PluginProfile struct {
+	Name      string `json:"name"`
+	VaultKey  string `json:"vault_key,omitempty"`
+	MFASerial string `json:"mfa_serial,omitempty"`
+	AccountID string `json:"account_id,omitempty"`
+	Region    string `json:"region,omitempty"`
+}
+
+// PluginResponse is read from the plugin's stdout, only the fields for the command
+// are expected.  A non-empty Error fails the command whatever the exit code.
+type PluginResponse struct {
+	Version     int    `json:"version"`
+	DisplayName string `json:"display_name,omitempty"` // describe
+	Description string `json:"description,omitempty"`  // describe
+	Installed   bool   `json:"installed,omitempty"`    // is-installed
+	Code        string `json:"code,omitempty"`         // get-mfa-code
+	Error       string `json:"error,omitempty"`
+}
+
+// Plugin is a discovered plugin executable
+type Plugin struct {
+	Name string
+	Path string
+}
+
+// Plugins are given driver names above AuthDriverUnknown in the order they are first
+// discovered, so the built in drivers keep their values
+var (
+	pluginsMu sync.Mutex
+	plugins   []Plugin
+)
+
+// DiscoverPlugins finds the plugins listed in AWS_LOGIN_DRIVER_PLUGINS and every
+// aws-login-driver-* executable on the PATH, plugins can't replace built in drivers
+func DiscoverPlugins() []Plugin {
+	var found []Plugin
+	seen := make(map[string]bool)
+	add := func(name, path string) {
+		if name == "" || seen[name] {
+			return
+		}
+		if _, err := parseBuiltinAuthDriver(name); err == nil {
+			return
+		}
+		seen[name] = true
+		found = append(found, Plugin{Name: name, Path: path})
+	}
+
+	for _, path := range filepath.SplitList(os.Getenv(PluginsEnv)) {
+		if path = strings.TrimSpace(path); path != "" && isExecutable(path) {
+			add(pluginName(path), path)
+		}
+	}
+
+	// Earlier PATH entries win, just like exec.LookPath
+	for _, dir := range filepath.SplitList(os.Getenv("PATH")) {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			path := filepath.Join(dir, entry.Name())
+			if strings.HasPrefix(entry.Name(), PluginPrefix) && isExecutable(path) {
+				add(pluginName(path), path)
+			}
+		}
+	}
+
+	pluginsMu.Lock()
+	defer pluginsMu.Unlock()
+	for _, plugin := range found {
+		registerPluginLocked(plugin)
+	}
+
+	return found
+}
+
+// RegisterPlugin makes the plugin available as a driver and returns its name, plugins
+// that are already registered keep their name but pick up the new path
+func RegisterPlugin(plugin Plugin) AuthDriverName {
+	pluginsMu.Lock()
+	defer pluginsMu.Unlock()
+
+	return registerPluginLocked(plugin)
+}
+
+func registerPluginLocked(plugin Plugin) AuthDriverName {
+	for i, registered := range plugins {
+		if registered.Name == plugin.Name {
+			plugins[i] = plugin
+			return AuthDriverUnknown + 1 + AuthDriverName(i)
+		}
+	}
+
+	plugins = append(plugins, plugin)
+	return AuthDriverUnknown + AuthDriverName(len(plugins))
+}
+
+// PluginFor returns the plugin behind a driver name
+func PluginFor(driverType AuthDriverName) (Plugin, bool) {
+	pluginsMu.Lock()
+	defer pluginsMu.Unlock()
+
+	index := int(driverType - AuthDriverUnknown - 1)
+	if index < 0 || index >= len(plugins) {
+		return Plugin{}, false
+	}
+	return plugins[index], true
+}
+
+// pluginDriverName looks a registered plugin up by name
+func pluginDriverName(name string) (AuthDriverName, bool) {
+	pluginsMu.Lock()
+	defer pluginsMu.Unlock()
+
+	for i, plugin := range plugins {
+		if plugin.Name == name {
+			return AuthDriverUnknown + 1 + AuthDriverName(i), true
+		}
+	}
+	return AuthDriverUnknown, false
+}
+
+// PluginDriver speaks the plugin protocol to an external executable
+type PluginDriver struct {
+	plugin  Plugin
+	profile PluginProfile
+	runner  types.Runner
+}
+
+// This is a type assertion to the compiler to ensure that PluginDriver implements the Driver interface
+// if the constraints aren't met, the compiler will throw an error
+//
+// We do this because we have a @factory.go file that returns a types.Driver interface and we need to
+// ensure that if someone bypases the factory and tries to create a PluginDriver directly,
+// the compiler will throw an error
+var _ types.Driver = (*PluginDriver)(nil)
+
+// NewPluginDriver creates a driver for the plugin, the profile's metadata is sent with
+// every request for an MFA code
+func NewPluginDriver(plugin Plugin, profile string, runner types.Runner) *PluginDriver {
+	metadata := PluginProfile{Name: profile}
+	if credential, exists := core.GetCredentialReader().GetCredential(profile); exists {
+		metadata.VaultKey = credential.VaultKey
+		metadata.MFASerial = credential.MfaSerial
+		metadata.AccountID = credential.AccountID
+		metadata.Region = credential.Region
+	}
+
+	return &PluginDriver{plugin: plugin, profile: metadata, runner: core.RunnerOrDefault(runner)}
+}
+
+// GetToken retrieves MFA token from the plugin
+func (d *PluginDriver) GetToken() (string, error) {
+	return d.GetMFACode()
+}
+
+// Name returns the name of the driver
+func (d *PluginDriver) Name() string {
+	return d.plugin.Name
+}
+
+func (d *PluginDriver) YieldsMFACode() bool {
+	return true
+}
+
+func (d *PluginDriver) GetMFACode() (string, error) {
+	response, err := d.call(PluginRequest{Command: PluginCommandGetMFACode, Profile: &d.profile}, PluginMFACodeTimeout)
+	if err != nil {
+		return "", fmt.Errorf("failed to retrieve MFA code from %s: %w", d.plugin.Name, err)
+	}
+
+	mfaCode := strings.TrimSpace(response.Code)
+	if mfaCode == "" {
+		return "", fmt.Errorf("empty MFA code from %s", d.plugin.Name)
+	}
+
+	return mfaCode, nil
+}
+
+// IsInstalled asks the plugin whether whatever it depends on is available
+func (d *PluginDriver) IsInstalled() bool {
+	response, err := d.call(PluginRequest{Command: PluginCommandIsInstalled}, PluginTimeout)
+	return err == nil && response.Installed
+}
+
+// Describe returns the name and description to show in the driver list, falling back
+// to the plugin name when the plugin doesn't describe itself
+func (d *PluginDriver) Describe() (string, string) {
+	response, err := d.call(PluginRequest{Command: PluginCommandDescribe}, PluginTimeout)
+	if err != nil || response.DisplayName == "" {
+		return d.plugin.Name, fmt.Sprintf("Use the %s plugin (%s)", d.plugin.Name, d.plugin.Path)
+	}
+	return response.DisplayName, response.Description
+}
+
+// call runs the plugin with a single request and parses its response, the plugin is
+// killed if it hasn't answered within the timeout
+func (d *PluginDriver) call(request PluginRequest, timeout time.Duration) (PluginResponse, error) {
+	request.Version = PluginProtocolVersion
+	payload, err := json.Marshal(request)
+	if err != nil {
+		return PluginResponse{}, fmt.Errorf("failed to marshal plugin request: %w", err)
+	}
+
+	result, runErr := d.runner.Run(types.Command{Name: d.plugin.Path, Args: []string{request.Command}, Stdin: string(payload), Timeout: timeout})
+
+	var response PluginResponse
+	if err := json.Unmarshal([]byte(result.Stdout), &response); err != nil {
+		if runErr != nil {
+			return response, runErr
+		}
+		return response, fmt.Errorf("invalid plugin response: %w", err)
+	}
+
+	if response.Error != "" {
+		return response, errors.New(response.Error)
+	}
+	if runErr != nil {
+		return response, runErr
+	}
+	if response.Version != PluginProtocolVersion {
+		return response, fmt.Errorf("plugin speaks protocol version %d, expected %d", response.Version, PluginProtocolVersion)
+	}
+
+	return response, nil
+}
+
+// pluginName strips the prefix (and .exe on Windows) from the executable name
+func pluginName(path string) string {
+	name := filepath.Base(path)
+	if runtime.GOOS == "windows" {
+		name = strings.TrimSuffix(name, ".exe")
+	}
+	return strings.ToLower(strings.TrimPrefix(name, PluginPrefix))
+}
+
+func isExecutable(path string) bool {
+	info, err := os.Stat(path)
+	if err != nil || info.IsDir() {
+		return false
+	}
+	if runtime.GOOS == "windows" {
+		return strings.EqualFold(filepath.Ext(path), ".exe")
+	}
+	return info.Mode().Perm()&0111 != 0
+}
@@ -0,0 +1,179 @@
+package auth_drivers
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/alexmk92/aws-login/core/coretest"
+	"github.com/alexmk92/aws-login/core/types"
+)
+
+func writeTestPlugin(t *testing.T, dir, name string, mode os.FileMode) string {
+	t.Helper()
+
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"), mode); err != nil {
+		t.Fatalf("Failed to write test plugin: %v", err)
+	}
+	return path
+}
+
+func TestDiscoverPlugins(t *testing.T) {
+	first, second, explicit := t.TempDir(), t.TempDir(), t.TempDir()
+
+	writeTestPlugin(t, first, "aws-login-driver-hsm", 0755)
+	writeTestPlugin(t, first, "aws-login-driver-disabled", 0644)
+	writeTestPlugin(t, first, "aws-login-driver-1password", 0755)
+	writeTestPlugin(t, second, "aws-login-driver-hsm", 0755)
+	writeTestPlugin(t, second, "aws-login-driver-vault", 0755)
+	writeTestPlugin(t, second, "unrelated", 0755)
+	explicitVault := writeTestPlugin(t, explicit, "corp-vault", 0755)
+
+	t.Setenv("PATH", strings.Join([]string{first, second}, string(os.PathListSeparator)))
+	t.Setenv(PluginsEnv, explicitVault)
+
+	found := map[string]string{}
+	for _, plugin := range DiscoverPlugins() {
+		found[plugin.Name] = plugin.Path
+	}
+
+	expected := map[string]string{
+		"hsm":        filepath.Join(first, "aws-login-driver-hsm"),
+		"vault":      filepath.Join(second, "aws-login-driver-vault"),
+		"corp-vault": explicitVault,
+	}
+	if len(found) != len(expected) {
+		t.Errorf("Expected plugins %v, got %v", expected, found)
+	}
+	for name, path := range expected {
+		if found[name] != path {
+			t.Errorf("Expected plugin '%s' at %s, got '%s'", name, path, found[name])
+		}
+	}
+
+	driver, err := ParseAuthDriver("HSM")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if driver <= AuthDriverUnknown || driver.String() != "hsm" {
+		t.Errorf("Expected the hsm plugin driver, got %d (%s)", driver, driver.String())
+	}
+	if plugin, ok := PluginFor(driver); !ok || plugin.Path != expected["hsm"] {
+		t.Errorf("Expected driver to resolve to %s, got %+v", expected["hsm"], plugin)
+	}
+
+	// Built in drivers keep their values
+	if driver, err := ParseAuthDriver("1password"); err != nil || driver != AuthDriver1Password {
+		t.Errorf("Expected the built in 1password driver, got %d (%v)", driver, err)
+	}
+
+	if _, err := ParseAuthDriver("missing"); err == nil || !strings.Contains(err.Error(), "hsm") {
+		t.Errorf("Expected the error to list the plugins, got %v", err)
+	}
+}
+
+func TestPluginDriver_GetMFACode(t *testing.T) {
+	loadTestCredentials(t, `[prd]
+vault_key = aws/prd
+mfa_serial = arn:aws:iam::123456789012:mfa/alex
+region = eu-west-2`)
+
+	plugin := Plugin{Name: "hsm", Path: "/plugins/aws-login-driver-hsm"}
+
+	tests := []struct {
+		name          string
+		result        types.CommandResult
+		expectedCode  string
+		expectedError string
+	}{
+		{
+			name:         "code is returned",
+			result:       types.CommandResult{Stdout: `{"version":1,"code":"123456"}`},
+			expectedCode: "123456",
+		},
+		{
+			name:          "plugin reports an error",
+			result:        types.CommandResult{Stdout: `{"version":1,"error":"token not enrolled"}`, ExitCode: 1},
+			expectedError: "token not enrolled",
+		},
+		{
+			name:          "unsupported protocol version",
+			result:        types.CommandResult{Stdout: `{"version":2,"code":"123456"}`},
+			expectedError: "protocol version 2",
+		},
+		{
+			name:          "output isn't JSON",
+			result:        types.CommandResult{Stdout: "123456\n"},
+			expectedError: "invalid plugin response",
+		},
+		{
+			name:          "empty code",
+			result:        types.CommandResult{Stdout: `{"version":1}`},
+			expectedError: "empty MFA code",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runner := coretest.NewFakeRunner().On(plugin.Path+" get-mfa-code", tt.result)
+
+			code, err := NewPluginDriver(plugin, "prd", runner).GetMFACode()
+			if tt.expectedError != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.expectedError) {
+					t.Errorf("Expected error containing '%s', got %v", tt.expectedError, err)
+				}
+			} else if err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+
+			if code != tt.expectedCode {
+				t.Errorf("Expected code '%s', got '%s'", tt.expectedCode, code)
+			}
+
+			var request PluginRequest
+			if err := json.Unmarshal([]byte(runner.Calls[0].Stdin), &request); err != nil {
+				t.Fatalf("Failed to parse request: %v", err)
+			}
+			expected := PluginProfile{Name: "prd", VaultKey: "aws/prd", MFASerial: "arn:aws:iam::123456789012:mfa/alex", Region: "eu-west-2"}
+			if request.Version != PluginProtocolVersion || request.Command != PluginCommandGetMFACode || request.Profile == nil || *request.Profile != expected {
+				t.Errorf("Unexpected request %s", runner.Calls[0].Stdin)
+			}
+			if runner.Calls[0].Timeout != PluginMFACodeTimeout {
+				t.Errorf("Expected the plugin to run with a %s timeout, got %s", PluginMFACodeTimeout, runner.Calls[0].Timeout)
+			}
+		})
+	}
+}
+
+func TestPluginDriver_DescribeAndIsInstalled(t *testing.T) {
+	plugin := Plugin{Name: "hsm", Path: "/plugins/aws-login-driver-hsm"}
+
+	runner := coretest.NewFakeRunner().
+		On(plugin.Path+" describe", types.CommandResult{Stdout: `{"version":1,"display_name":"HSM","description":"Use the HSM-backed secret service"}`}).
+		On(plugin.Path+" is-installed", types.CommandResult{Stdout: `{"version":1,"installed":true}`})
+	driver := NewPluginDriver(plugin, "", runner)
+
+	if title, description := driver.Describe(); title != "HSM" || description != "Use the HSM-backed secret service" {
+		t.Errorf("Unexpected description '%s' '%s'", title, description)
+	}
+	if !driver.IsInstalled() {
+		t.Errorf("Expected plugin to be installed")
+	}
+	for _, call := range runner.Calls {
+		if call.Timeout != PluginTimeout {
+			t.Errorf("Expected %s to run with a %s timeout, got %s", coretest.CommandLine(call), PluginTimeout, call.Timeout)
+		}
+	}
+
+	// Plugins that fail to answer fall back to their name and are hidden
+	broken := NewPluginDriver(plugin, "", coretest.NewFakeRunner())
+	if title, _ := broken.Describe(); title != "hsm" {
+		t.Errorf("Expected the plugin name as the title, got '%s'", title)
+	}
+	if broken.IsInstalled() {
+		t.Errorf("Expected a plugin that can't run to be unavailable")
+	}
+}
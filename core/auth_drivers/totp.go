@@ -0,0 +1,83 @@
+package auth_drivers
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/alexmk92/aws-login/core"
+	"github.com/alexmk92/aws-login/core/types"
+)
+
+// TOTPDriver computes MFA codes itself from a seed in the encrypted TOTP store, so no
+// password manager or phone is needed.  When the store passphrase isn't in the keyring
+// the caller asks for it, it is only ever held in memory.
+type TOTPDriver struct {
+	seedName string
+	store    *core.TOTPStore
+	now      func() time.Time
+}
+
+// This is a type assertion to the compiler to ensure that TOTPDriver implements the UnlockableDriver
+// interface if the constraints aren't met, the compiler will throw an error
+//
+// We do this because we have a @factory.go file that returns a types.Driver interface and we need to
+// ensure that if someone bypases the factory and tries to create a TOTPDriver directly,
+// the compiler will throw an error
+var _ types.UnlockableDriver = (*TOTPDriver)(nil)
+
+// NewTOTPDriver creates a new TOTP driver, the seed is looked up by the profile's
+// vault_key falling back to the profile name.  The runner is used to read the
+// store passphrase from the OS keyring.
+func NewTOTPDriver(profile string, runner types.Runner) *TOTPDriver {
+	seedName := profile
+	if credential, exists := core.GetCredentialReader().GetCredential(profile); exists && credential.VaultKey != "" {
+		seedName = credential.VaultKey
+	}
+
+	path, _ := core.DefaultTOTPStorePath()
+
+	return NewTOTPDriverWithStore(seedName, core.NewTOTPStore(path, runner))
+}
+
+// NewTOTPDriverWithStore creates a TOTP driver reading the named seed from store
+func NewTOTPDriverWithStore(seedName string, store *core.TOTPStore) *TOTPDriver {
+	return &TOTPDriver{seedName: seedName, store: store, now: time.Now}
+}
+
+// GetToken computes the current code
+func (d *TOTPDriver) GetToken() (string, error) {
+	return d.GetMFACode()
+}
+
+// Name returns the name of the driver
+func (d *TOTPDriver) Name() string {
+	return "totp"
+}
+
+func (d *TOTPDriver) YieldsMFACode() bool {
+	return true
+}
+
+func (d *TOTPDriver) GetMFACode() (string, error) {
+	seed, err := d.store.Seed(d.seedName)
+	if err != nil {
+		return "", fmt.Errorf("failed to read TOTP seed '%s': %w", d.seedName, err)
+	}
+
+	return core.GenerateTOTP(seed, d.now())
+}
+
+// IsInstalled reports whether any seeds have been imported
+func (d *TOTPDriver) IsInstalled() bool {
+	return d.store.Exists()
+}
+
+// NeedsPassword reports whether the store passphrase still has to be entered
+func (d *TOTPDriver) NeedsPassword() bool {
+	return d.store.NeedsPassphrase()
+}
+
+// Unlock sets the passphrase used to decrypt the store
+func (d *TOTPDriver) Unlock(password string) {
+	d.store.SetPassphrase(password)
+}
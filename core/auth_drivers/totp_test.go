@@ -0,0 +1,78 @@
+package auth_drivers
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/alexmk92/aws-login/core"
+	"github.com/alexmk92/aws-login/core/coretest"
+	"github.com/alexmk92/aws-login/core/types"
+)
+
+func TestTOTPDriver_GetMFACode(t *testing.T) {
+	t.Setenv(core.TOTPPassphraseEnv, "correct horse battery staple")
+	store := core.NewTOTPStore(filepath.Join(t.TempDir(), "totp.json"), coretest.NewFakeRunner())
+
+	driver := NewTOTPDriverWithStore("AWS MFA prd", store)
+	driver.now = func() time.Time { return time.Unix(59, 0) }
+
+	if driver.IsInstalled() {
+		t.Errorf("Expected driver to be unavailable before a seed is imported")
+	}
+
+	seed := types.TOTPSeed{Secret: "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ", Algorithm: "SHA1", Digits: 6, Period: 30}
+	if err := store.Import("AWS MFA prd", seed); err != nil {
+		t.Fatalf("Failed to import seed: %v", err)
+	}
+
+	if !driver.IsInstalled() {
+		t.Errorf("Expected driver to be installed once a seed is imported")
+	}
+
+	code, err := driver.GetMFACode()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if code != "287082" {
+		t.Errorf("Expected code '287082', got '%s'", code)
+	}
+
+	if _, err := NewTOTPDriverWithStore("AWS MFA stg", store).GetMFACode(); err == nil {
+		t.Errorf("Expected an error for a profile without a seed")
+	}
+}
+
+func TestTOTPDriver_Unlock(t *testing.T) {
+	t.Setenv(core.TOTPPassphraseEnv, "")
+	store := core.NewTOTPStore(filepath.Join(t.TempDir(), "totp.json"), coretest.NewFakeRunner())
+	driver := NewTOTPDriverWithStore("prd", store)
+
+	// There's nothing to unlock until a seed is imported
+	if driver.NeedsPassword() {
+		t.Errorf("Expected no password to be needed without a store")
+	}
+
+	store.SetPassphrase("correct horse battery staple")
+	if err := store.Import("prd", types.TOTPSeed{Secret: "JBSWY3DPEHPK3PXP"}); err != nil {
+		t.Fatalf("Failed to import seed: %v", err)
+	}
+	store.SetPassphrase("")
+
+	if !driver.NeedsPassword() {
+		t.Fatalf("Expected the passphrase to be needed without a keyring")
+	}
+
+	driver.Unlock("Tr0ub4dor&3")
+	if _, err := driver.GetMFACode(); err == nil {
+		t.Errorf("Expected the wrong passphrase to be rejected")
+	}
+	if !driver.NeedsPassword() {
+		t.Errorf("Expected a rejected passphrase to be asked for again")
+	}
+
+	driver.Unlock("correct horse battery staple")
+	if _, err := driver.GetMFACode(); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
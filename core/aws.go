@@ -1,22 +1,60 @@
 package core
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"os"
-	"os/exec"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 
+	"github.com/alexmk92/aws-login/core/aws_client"
 	"github.com/alexmk92/aws-login/core/types"
 )
 
 // AWSService handles all AWS-related operations
 type AWSService struct {
-	credentialReader *CredentialReader
-	attemptECRLogin  bool
+	credentialReader  *CredentialReader
+	attemptECRLogin   bool
+	sessionFilePath   string               // Where the shell helper expects the session, empty disables writing it
+	activeCredentials *types.Credentials   // The most recently established session
+	sessionCache      *SessionCache        // Optional, nil disables caching entirely
+	sessionProfile    string               // The base profile the active MFA session belongs to
+	assumedRoleArn    string               // The role the active session belongs to, empty for the MFA session itself
+	apiClient         *aws_client.Client   // Native client used for every STS and ECR request
+	runner            types.Runner         // Runs every external process (i.e. docker)
+	sessionOptions    types.SessionOptions // Overrides for the STS parameters configured on profiles
+	dockerConfigPath  string               // Where the docker-config target writes, empty means DefaultDockerConfigPath
+	ecrTargets        []string             // Overrides the ECR login targets configured on profiles
+
+	attemptCodeArtifactLogin bool
+	attemptEKSLogin          bool
+	kubeconfigPath           string            // Passed to kubectl --kubeconfig, empty lets kubectl decide
+	sessionEnv               map[string]string // Extra variables written to the session file for the shell helper
+
+	ssoCacheDir string                    // Where IAM Identity Center tokens are cached, shared with the AWS CLI
+	ssoTokens   map[string]ssoCachedToken // Tokens (and client registrations) by cache key
 }
 
+// DefaultSessionFilePath is sourced (and removed) by the shell helper after a login
+const DefaultSessionFilePath = "/tmp/aws-session.json"
+
+// Defaults for the STS parameters when neither the profile nor the flags set them
+const (
+	DefaultSessionDurationSeconds = 86400
+	DefaultRoleSessionName        = "aws-login-session"
+
+	// STS caps sessions for a role assumed with another role's credentials at an hour
+	MaxChainedRoleDurationSeconds = 3600
+)
+
+// DefaultECRRegion is used for the default registry when the profile has no region
+const DefaultECRRegion = "eu-west-2"
+
 // Create a new AWS service instance, if we wanted this to be a singleton
 // for a thread safe singleton, we could use the sync do once pattern
 //
@@ -43,19 +81,72 @@ type AWSService struct {
 //
 //		return awsServiceInstance
 //	}
-func NewAWSService(attemptECRLogin bool) *AWSService {
+func NewAWSService(attemptECRLogin bool, files CredentialFiles) *AWSService {
 	credentialReader := NewCredentialReader()
-	if err := credentialReader.LoadCredentialsFile(); err != nil {
+	if err := credentialReader.LoadFiles(files); err != nil {
 		// This is a fatal error, we need to load the credentials file, it will send an os.Exit(1) signal
-		log.Fatalf("Failed to load credentials file: %v", err)
+		log.Fatalf("Failed to load AWS files: %v", err)
 	}
 
+	// Without a home directory SSO tokens are only kept for this login
+	ssoCacheDir, _ := DefaultSSOCacheDir()
+
 	return &AWSService{
 		credentialReader: credentialReader,
 		attemptECRLogin:  attemptECRLogin,
+		sessionFilePath:  DefaultSessionFilePath,
+		apiClient:        aws_client.NewClient(aws_client.ConfigFromEnv()),
+		runner:           ExecRunner{},
+		ssoCacheDir:      ssoCacheDir,
 	}
 }
 
+// SetRunner replaces the runner used for external processes
+func (s *AWSService) SetRunner(runner types.Runner) {
+	s.runner = runner
+}
+
+// SetDockerConfigPath changes the file the docker-config target writes to, an empty
+// path uses DefaultDockerConfigPath
+func (s *AWSService) SetDockerConfigPath(path string) {
+	s.dockerConfigPath = path
+}
+
+// SetECRTargets overrides the login targets configured on the profiles, an empty
+// list falls back to the profile (or DefaultECRTargets)
+func (s *AWSService) SetECRTargets(targets []string) {
+	s.ecrTargets = targets
+}
+
+// SetSessionOptions overrides the STS parameters configured on the profiles
+func (s *AWSService) SetSessionOptions(options types.SessionOptions) {
+	s.sessionOptions = options
+}
+
+// Runner returns the runner external processes should be spawned with, drivers
+// share it so a single fake can observe the whole flow in tests
+func (s *AWSService) Runner() types.Runner {
+	return RunnerOrDefault(s.runner)
+}
+
+// SetAPIClient replaces the client used to talk to AWS, i.e. to use custom
+// endpoints or a fake server in tests
+func (s *AWSService) SetAPIClient(client *aws_client.Client) {
+	s.apiClient = client
+}
+
+// SetSessionFilePath changes where the session is written once established, passing
+// an empty path disables the session file entirely (i.e. for credential_process
+// where the credentials are written to stdout instead).
+func (s *AWSService) SetSessionFilePath(path string) {
+	s.sessionFilePath = path
+}
+
+// SetSessionCache enables reusing unexpired sessions, passing nil disables the cache
+func (s *AWSService) SetSessionCache(cache *SessionCache) {
+	s.sessionCache = cache
+}
+
 // GetCredentials returns the credentials for a specific profile
 // notice that we're returning a nil pointer if the credential is not found
 // this is because we want to allow the caller to handle the error case gracefully
@@ -119,21 +210,73 @@ func (s *AWSService) GetValidProfiles() []string {
 }
 
 // GetAssumableRoles returns the list of roles that can be assumed for a profile
-func (s *AWSService) GetAssumableRoles(profile string) []string {
+func (s *AWSService) GetAssumableRoles(profile string) []types.AssumableRole {
 	if s.credentialReader == nil {
-		return []string{}
+		return []types.AssumableRole{}
 	}
 
 	return s.credentialReader.GetAssumableRoles(profile)
 }
 
-// GetAssumedProfileName returns the profile name that has the given assumable_role_id
-func (aws *AWSService) GetAssumedProfileName(roleArn string) string {
-	if aws.credentialReader == nil {
-		return ""
+// ResolveRole converts the role value supplied by the user into the ARN that should
+// be assumed, see ResolveAssumableRole.
+func (s *AWSService) ResolveRole(profile, role string) (string, error) {
+	resolved, err := s.ResolveAssumableRole(profile, role)
+	return resolved.Arn, err
+}
+
+// ResolveAssumableRole converts the role value supplied by the user into the role
+// that should be assumed.  The role can either be the name of a profile that declares
+// an assumable_role_id, or a raw role ARN.  An empty role (or the base profile itself)
+// means we continue as the current user, so an empty role is returned.
+//
+// A raw ARN is attributed to the profile that declares it, unless several do, as we
+// can't tell which of their settings (region, session name etc.) were meant.  Roles
+// the profile's assumable_roles doesn't allow are rejected.
+//
+// IAM Identity Center profiles have no role to assume, instead the role is resolved to
+// ACCOUNT_ID/ROLE_NAME (see resolveSSORole).
+func (s *AWSService) ResolveAssumableRole(profile, role string) (types.AssumableRole, error) {
+	role = strings.TrimSpace(role)
+	if s.IsSSOProfile(profile) {
+		key, err := s.resolveSSORole(profile, role)
+		if err != nil || key == "" {
+			return types.AssumableRole{}, err
+		}
+		accountID, roleName, _ := strings.Cut(key, "/")
+		return types.AssumableRole{Arn: key, AccountID: accountID, DisplayName: roleName}, nil
+	}
+
+	if role == "" || role == profile {
+		return types.AssumableRole{}, nil
+	}
+
+	var resolved types.AssumableRole
+	if strings.HasPrefix(role, "arn:") {
+		declaredBy := ""
+		if s.credentialReader != nil {
+			if profiles := s.credentialReader.ProfilesForRoleArn(role); len(profiles) == 1 {
+				declaredBy = profiles[0]
+			}
+		}
+		resolved = NewAssumableRole(declaredBy, role)
+	} else {
+		credentials, err := s.GetCredentials(role)
+		if err != nil {
+			return types.AssumableRole{}, err
+		}
+
+		if credentials.AssumableRoleID == "" {
+			return types.AssumableRole{}, fmt.Errorf("profile '%s' does not define an assumable_role_id", role)
+		}
+		resolved = NewAssumableRole(role, credentials.AssumableRoleID)
 	}
 
-	return aws.credentialReader.GetProfileByRoleArn(roleArn)
+	if s.credentialReader != nil && !s.credentialReader.IsRoleAllowed(profile, resolved) {
+		return types.AssumableRole{}, fmt.Errorf("role '%s' is not in the assumable_roles of profile '%s'", role, profile)
+	}
+
+	return resolved, nil
 }
 
 // ValidateMFACode checks if the MFA code is 6 digits
@@ -149,6 +292,21 @@ func (s *AWSService) ValidateMFACode(code string) bool {
 	return true
 }
 
+// MFACodePeriod is how long a TOTP code is valid for, authenticators roll over to a
+// new code at the start of every period
+const MFACodePeriod = 30 * time.Second
+
+// MaxMFARetries is how many times we'll wait for a fresh code from the driver when
+// STS tells us the code has already been used, before giving up
+const MaxMFARetries = 2
+
+// TimeUntilNextMFACode returns how long until the authenticator shows a new code,
+// we use this to wait out a code that STS has already seen.
+func TimeUntilNextMFACode(now time.Time) time.Duration {
+	elapsed := time.Duration(now.UnixNano()) % MFACodePeriod
+	return MFACodePeriod - elapsed
+}
+
 // GetSessionToken gets temporary AWS credentials using provided MFA code
 // all types.Credentials yielded by getSessionTokenInternal are set in the process
 // environment variables, so we don't need to return them.
@@ -161,95 +319,450 @@ func (s *AWSService) GetSessionToken(profile, mfaCode string) (bool, error) {
 		return false, err
 	}
 
-	// Get session token
-	cmd := exec.Command("aws", "sts", "get-session-token",
-		"--duration", "86400",
-		"--serial-number", mfaSerial,
-		"--token-code", mfaCode,
-		"--profile", profile)
-
-	// Debug print removed to avoid interfering with Bubble Tea rendering
+	staticCredential, err := s.GetCredentials(profile)
+	if err != nil {
+		return false, err
+	}
 
-	output, err := cmd.Output()
+	if staticCredential.AccessKey == "" || staticCredential.AccessSecret == "" {
+		return false, fmt.Errorf("access keys not configured for profile '%s'", profile)
+	}
 
+	// Get session token, signed with the long lived keys of the profile
+	session, err := s.apiClient.GetSessionToken(context.Background(), types.Credentials{
+		AccessKeyId:     staticCredential.AccessKey,
+		SecretAccessKey: staticCredential.AccessSecret,
+	}, staticCredential.Region, aws_client.GetSessionTokenInput{
+		DurationSeconds: s.sessionDurationFor(profile),
+		SerialNumber:    mfaSerial,
+		TokenCode:       mfaCode,
+	})
 	if err != nil {
-		return false, fmt.Errorf("failed to get AWS session token: %w", err)
+		return false, classifyError("failed to get AWS session token", err)
 	}
 
-	var stsResponse types.STSResponse
-	if err := json.Unmarshal(output, &stsResponse); err != nil {
-		return false, fmt.Errorf("failed to parse STS response: %w", err)
+	s.sessionProfile = profile
+	s.assumedRoleArn = ""
+	s.cacheCredentials(profile, "", session)
+
+	return s.persistCredentials(session, profile)
+}
+
+// HasCachedSession reports whether the MFA prompt can be skipped for the profile,
+// either because the role has been assumed recently or because the MFA session
+// for the base profile is still valid.  assumedProfile is the profile declaring
+// the role, it is the base profile for a raw role ARN.
+func (s *AWSService) HasCachedSession(profile, roleArn, assumedProfile string) bool {
+	if s.sessionCache == nil {
+		return false
+	}
+
+	if roleArn != "" {
+		if _, ok := s.sessionCache.Get(profile, s.roleCacheKey(profile, assumedProfile, roleArn)); ok {
+			return true
+		}
+	}
+
+	_, ok := s.sessionCache.Get(profile, "")
+	return ok
+}
+
+// RestoreSession activates the cached MFA session for the profile, returning false
+// when there is no usable session and a new one must be requested with MFA.
+func (s *AWSService) RestoreSession(profile string) (bool, error) {
+	if s.sessionCache == nil {
+		return false, nil
+	}
+
+	credentials, ok := s.sessionCache.Get(profile, "")
+	if !ok {
+		return false, nil
+	}
+
+	s.sessionProfile = profile
+	s.assumedRoleArn = ""
+	return s.persistCredentials(credentials, profile)
+}
+
+// RestoreAssumedRole activates cached credentials for a role previously assumed
+// from the base profile, assumedProfile is the name reported for the session.
+func (s *AWSService) RestoreAssumedRole(profile, roleArn, assumedProfile string) (bool, error) {
+	if s.sessionCache == nil {
+		return false, nil
+	}
+
+	credentials, ok := s.sessionCache.Get(profile, s.roleCacheKey(profile, assumedProfile, roleArn))
+	if !ok {
+		return false, nil
+	}
+
+	s.sessionProfile = profile
+	s.assumedRoleArn = roleArn
+	return s.persistCredentials(credentials, assumedProfile)
+}
+
+// cacheCredentials stores the session for reuse, failing to cache is not fatal
+// to the login so any error is deliberately ignored.  roleKey is empty for the
+// MFA session, otherwise it comes from roleCacheKey.
+func (s *AWSService) cacheCredentials(profile, roleKey string, credentials *types.Credentials) {
+	if s.sessionCache == nil || profile == "" {
+		return
 	}
 
-	return s.persistCredentials(&stsResponse.Credentials, profile)
+	_ = s.sessionCache.Put(profile, roleKey, credentials)
 }
 
-// LoginToECR performs Docker login to ECR using temporary credentials
-func (s *AWSService) LoginToECR() error {
+// roleCacheKey identifies a cached role session.  Several profiles may declare the
+// same ARN with their own region, session name and duration, so the key is the
+// declaring profile and the ARN along with every STS parameter that shapes the
+// session, changing any of them requests a new session rather than reusing a stale
+// one.  IAM Identity Center roles (ACCOUNT_ID/ROLE_NAME) have no such parameters.
+func (s *AWSService) roleCacheKey(baseProfile, assumedProfile, roleArn string) string {
+	if roleArn == "" || s.IsSSOProfile(baseProfile) {
+		return roleArn
+	}
+	if assumedProfile == "" {
+		assumedProfile = baseProfile
+	}
+
+	input := s.assumeRoleInputFor(baseProfile, assumedProfile, roleArn)
+	tags := make([]string, 0, len(input.Tags))
+	for key, value := range input.Tags {
+		tags = append(tags, key+"="+value)
+	}
+	sort.Strings(tags)
+
+	return strings.Join([]string{
+		assumedProfile,
+		roleArn,
+		strconv.Itoa(input.DurationSeconds),
+		input.RoleSessionName,
+		input.ExternalID,
+		input.SourceIdentity,
+		strings.Join(tags, ","),
+	}, "\x00")
+}
+
+// LoginToECR performs Docker login to every ECR registry configured for the active
+// profile using the temporary credentials.  A result is returned per registry, the
+// error is non-nil when no registry could be attempted or any of them failed.
+func (s *AWSService) LoginToECR() ([]types.ECRLoginResult, error) {
 	if !s.attemptECRLogin {
-		return fmt.Errorf("attempt to login to ECR is disabled")
+		return nil, fmt.Errorf("attempt to login to ECR is disabled")
+	}
+
+	if s.activeCredentials == nil {
+		return nil, fmt.Errorf("no active session, log in first")
 	}
 
-	credentials, err := s.GetCredentials(os.Getenv("AWS_PROFILE"))
+	profile := os.Getenv("AWS_PROFILE")
+	registries, err := s.ecrRegistriesFor(profile, s.sessionProfile)
 	if err != nil {
-		return fmt.Errorf("failed to get credentials: %w", err)
+		return nil, err
+	}
+	targets := s.ecrTargetsFor(profile, s.sessionProfile)
+
+	results := make([]types.ECRLoginResult, 0, len(registries)*len(targets))
+	failed := 0
+	for _, registry := range registries {
+		// A single token works for every target, so only ask ECR once per registry
+		authorization, err := s.GetECRAuthorization(registry)
+
+		for _, target := range targets {
+			targetErr := err
+			if targetErr == nil {
+				targetErr = s.loginTarget(target, registry, authorization.Username, authorization.Password)
+			}
+			if targetErr != nil {
+				failed++
+			}
+			results = append(results, types.ECRLoginResult{Registry: registry, Target: target, Err: targetErr})
+		}
 	}
 
-	// Get ECR login password using temporary credentials
-	passwordCmd := exec.Command("aws", "ecr", "get-login-password", "--region", "eu-west-2")
-	password, err := passwordCmd.Output()
+	if failed > 0 {
+		return results, fmt.Errorf("failed %d of %d ECR logins", failed, len(results))
+	}
+
+	return results, nil
+}
+
+// ecrTargetsFor returns the login targets, the flags win over the first profile
+// with ecr_login_targets which wins over DefaultECRTargets
+func (s *AWSService) ecrTargetsFor(profiles ...string) []string {
+	if len(s.ecrTargets) > 0 {
+		return s.ecrTargets
+	}
+
+	for _, profile := range profiles {
+		if credentials, err := s.GetCredentials(profile); err == nil && len(credentials.ECRTargets) > 0 {
+			return credentials.ECRTargets
+		}
+	}
+
+	return DefaultECRTargets
+}
+
+// ecrRegistriesFor returns the registries configured on the first profile that has
+// any, falling back to the active profile's own account in its region (or
+// DefaultECRRegion) so existing setups keep working without ecr_registries.
+func (s *AWSService) ecrRegistriesFor(profile string, fallbackProfiles ...string) ([]types.ECRRegistry, error) {
+	for _, name := range append([]string{profile}, fallbackProfiles...) {
+		if credentials, err := s.GetCredentials(name); err == nil && len(credentials.ECRRegistries) > 0 {
+			return credentials.ECRRegistries, nil
+		}
+	}
+
+	credentials, err := s.GetCredentials(profile)
 	if err != nil {
-		return fmt.Errorf("failed to get ECR login password: %w", err)
+		return nil, fmt.Errorf("failed to get credentials: %w", err)
 	}
 
 	// Ensure we have an account ID, AccountID can be optional in the credentials file, but the
 	// user is required to specify the full RoleARN for the assumable role if we're using that instead.
 	accountID := credentials.AccountID
 	if accountID == "" {
-		accountID = credentials.AssumableRoleID
 		// Role ARN = arn:aws:iam::ACCOUNT:role/ROLE_NAME
 		// we want to extract the ACCOUNT ID
-		accountID = strings.Split(accountID, ":")[4]
+		parts := strings.Split(credentials.AssumableRoleID, ":")
+		if len(parts) < 5 || parts[4] == "" {
+			return nil, fmt.Errorf("no ECR registries configured for profile '%s' and no account ID to default to", profile)
+		}
+		accountID = parts[4]
 	}
 
-	// Docker login
-	dockerCmd := exec.Command("docker", "login",
-		"--username", "AWS",
-		"--password-stdin",
-		fmt.Sprintf("%s.dkr.ecr.eu-west-2.amazonaws.com", accountID))
-	dockerCmd.Stdin = strings.NewReader(string(password))
+	region := credentials.Region
+	if region == "" {
+		region = DefaultECRRegion
+	}
+
+	return []types.ECRRegistry{{AccountID: accountID, Region: region}}, nil
+}
+
+// GetECRAuthorization fetches the docker credentials for the registry using the
+// active session
+func (s *AWSService) GetECRAuthorization(registry types.ECRRegistry) (*aws_client.AuthorizationData, error) {
+	if s.activeCredentials == nil {
+		return nil, fmt.Errorf("no active session, log in first")
+	}
 
-	if err := dockerCmd.Run(); err != nil {
-		return fmt.Errorf("failed to login to ECR: %w", err)
+	// Get ECR login password using temporary credentials
+	authorizations, err := s.apiClient.GetAuthorizationToken(context.Background(), *s.activeCredentials, registry.Region, registry.AccountID)
+	if err != nil {
+		return nil, classifyError("failed to get ECR login password", err)
+	}
+	if len(authorizations) == 0 {
+		return nil, fmt.Errorf("failed to get ECR login password: no authorization data returned")
 	}
 
-	return nil
+	return &authorizations[0], nil
 }
 
-// AssumeRole assumes a role using the current session credentials
-func (s *AWSService) AssumeRole(profile string, roleArn string) (bool, error) {
-	// Call assume-role
-	cmd := exec.Command("aws", "sts", "assume-role",
-		"--role-arn", strings.TrimSpace(roleArn),
-		"--role-session-name", "aws-login-session")
+// GetECRRegistries returns every registry configured across all profiles, keyed by
+// hostname with the profile that logs in to it as the value.  When several profiles
+// share a registry the first profile (alphabetically) wins.
+func (s *AWSService) GetECRRegistries() map[string]string {
+	registries := make(map[string]string)
+	if s.credentialReader == nil {
+		return registries
+	}
+
+	for _, profile := range s.credentialReader.GetProfileNames() {
+		profileRegistries, err := s.ecrRegistriesFor(profile)
+		if err != nil {
+			continue
+		}
+		for _, registry := range profileRegistries {
+			if _, exists := registries[registry.Host()]; !exists {
+				registries[registry.Host()] = profile
+			}
+		}
+	}
 
-	output, err := cmd.Output()
+	return registries
+}
+
+// AssumeRole assumes a role using the current session credentials, going through
+// any intermediate roles the profile's source_profile requires (see RoleChain)
+func (s *AWSService) AssumeRole(profile string, roleArn string) (bool, error) {
+	return s.AssumeRoleChain(profile, roleArn, nil)
+}
 
-	// Also check if there's stderr output
-	if exitError, ok := err.(*exec.ExitError); ok {
-		return false, fmt.Errorf("failed to assume role %s: %w", roleArn, exitError)
+// AssumeRoleChain assumes every role in the chain to roleArn in turn, each one with
+// the credentials from the hop before.  When an intermediate role is still cached
+// the chain resumes from there.  progress (which may be nil) is called with the
+// whole chain and the index of the hop before each role is assumed.
+func (s *AWSService) AssumeRoleChain(profile string, roleArn string, progress func(hops []types.RoleHop, index int)) (bool, error) {
+	roleArn = strings.TrimSpace(roleArn)
+	if s.activeCredentials == nil {
+		return false, fmt.Errorf("failed to assume role %s: no active session, log in first", roleArn)
 	}
 
+	hops, err := s.RoleChain(profile, roleArn)
 	if err != nil {
-		return false, fmt.Errorf("failed to assume role %s: %w", roleArn, err)
+		return false, err
+	}
+
+	// Start from the furthest intermediate role that is still cached, the final role
+	// is left to RestoreAssumedRole
+	credentials := s.activeCredentials
+	start := 0
+	if s.sessionCache != nil {
+		for i := len(hops) - 2; i >= 0; i-- {
+			if cached, ok := s.sessionCache.Get(s.sessionProfile, s.roleCacheKey(s.sessionProfile, hops[i].Profile, hops[i].RoleArn)); ok {
+				credentials, start = cached, i+1
+				break
+			}
+		}
+	}
+
+	for i := start; i < len(hops); i++ {
+		hop := hops[i]
+		if progress != nil {
+			progress(hops, i)
+		}
+
+		// Every hop after the first is role chaining, STS rejects longer durations
+		input := s.assumeRoleInputFor(s.sessionProfile, hop.Profile, hop.RoleArn)
+		if i > 0 && input.DurationSeconds > MaxChainedRoleDurationSeconds {
+			input.DurationSeconds = MaxChainedRoleDurationSeconds
+		}
+
+		assumed, err := s.apiClient.AssumeRole(context.Background(), *credentials, s.regionFor(hop.Profile, s.sessionProfile), input)
+		if err != nil {
+			op := fmt.Sprintf("failed to assume role %s", hop.RoleArn)
+			if len(hops) > 1 {
+				op = fmt.Sprintf("%s (hop %d of %d to %s)", op, i+1, len(hops), roleArn)
+			}
+			return false, classifyError(op, err)
+		}
+
+		s.cacheCredentials(s.sessionProfile, s.roleCacheKey(s.sessionProfile, hop.Profile, hop.RoleArn), assumed)
+		credentials = assumed
+	}
+
+	s.assumedRoleArn = roleArn
+
+	return s.persistCredentials(credentials, profile)
+}
+
+// RoleChain resolves the roles that must be assumed, in order, to reach roleArn from
+// the MFA session.  The profile's source_profile is followed back towards the base
+// profile and every profile on the way that declares a role becomes an earlier hop,
+// i.e. target (source_profile = broker) -> broker (source_profile = prd) gives
+// [broker, target] when logged in as prd.  The chain stops at the base profile, or
+// at the first source profile without a role of its own.
+func (s *AWSService) RoleChain(profile, roleArn string) ([]types.RoleHop, error) {
+	hops := []types.RoleHop{{Profile: profile, RoleArn: roleArn}}
+	visited := map[string]bool{profile: true}
+	path := []string{profile}
+
+	for current := profile; current != s.sessionProfile; {
+		credentials, err := s.GetCredentials(current)
+		if err != nil || credentials.SourceProfile == "" || credentials.SourceProfile == s.sessionProfile {
+			break
+		}
+
+		source := credentials.SourceProfile
+		path = append(path, source)
+		if visited[source] {
+			return nil, fmt.Errorf("role chain for profile '%s' loops back on itself: %s", profile, strings.Join(path, " -> "))
+		}
+		visited[source] = true
+
+		sourceCredentials, err := s.GetCredentials(source)
+		if err != nil {
+			return nil, fmt.Errorf("profile '%s' has source_profile '%s' which does not exist", current, source)
+		}
+		if sourceCredentials.AssumableRoleID == "" {
+			break
+		}
+
+		hops = append([]types.RoleHop{{Profile: source, RoleArn: sourceCredentials.AssumableRoleID}}, hops...)
+		current = source
+	}
+
+	return hops, nil
+}
+
+// sessionDurationFor returns the MFA session lifetime for the profile, the flag wins
+// over session_duration_seconds which wins over our 24 hour default.
+func (s *AWSService) sessionDurationFor(profile string) int {
+	if s.sessionOptions.SessionDurationSeconds > 0 {
+		return s.sessionOptions.SessionDurationSeconds
+	}
+
+	if credentials, err := s.GetCredentials(profile); err == nil && credentials.SessionDurationSeconds > 0 {
+		return credentials.SessionDurationSeconds
+	}
+
+	return DefaultSessionDurationSeconds
+}
+
+// assumeRoleInputFor builds the assume role request, every parameter is taken from
+// the flags first, then the assumed profile, then the base profile the MFA session
+// belongs to, so settings like role_session_name can be configured once per user.
+func (s *AWSService) assumeRoleInputFor(baseProfile, profile, roleArn string) aws_client.AssumeRoleInput {
+	var profiles []*types.StaticCredential
+	for _, name := range []string{profile, baseProfile} {
+		if credentials, err := s.GetCredentials(name); err == nil {
+			profiles = append(profiles, credentials)
+		}
+	}
+
+	input := aws_client.AssumeRoleInput{
+		RoleArn:         roleArn,
+		DurationSeconds: s.sessionOptions.DurationSeconds,
+		RoleSessionName: s.sessionOptions.RoleSessionName,
+		ExternalID:      s.sessionOptions.ExternalID,
+		SourceIdentity:  s.sessionOptions.SourceIdentity,
+		Tags:            make(map[string]string),
 	}
 
-	var assumeResponse types.AssumeRoleResponse
-	if err := json.Unmarshal(output, &assumeResponse); err != nil {
-		return false, fmt.Errorf("failed to parse assume-role response: %w", err)
+	// Walk from the least to the most specific source so later tags win
+	for i := len(profiles) - 1; i >= 0; i-- {
+		for key, value := range profiles[i].SessionTags {
+			input.Tags[key] = value
+		}
+	}
+	for key, value := range s.sessionOptions.Tags {
+		input.Tags[key] = value
+	}
+
+	for _, credentials := range profiles {
+		if input.DurationSeconds == 0 {
+			input.DurationSeconds = credentials.DurationSeconds
+		}
+		if input.RoleSessionName == "" {
+			input.RoleSessionName = credentials.RoleSessionName
+		}
+		if input.ExternalID == "" {
+			input.ExternalID = credentials.ExternalID
+		}
+		if input.SourceIdentity == "" {
+			input.SourceIdentity = credentials.SourceIdentity
+		}
+	}
+
+	if input.RoleSessionName == "" {
+		input.RoleSessionName = DefaultRoleSessionName
 	}
+	input.RoleSessionName = expandSessionName(input.RoleSessionName, profile)
+	input.SourceIdentity = expandSessionName(input.SourceIdentity, profile)
 
-	return s.persistCredentials(&assumeResponse.Credentials, profile)
+	return input
+}
+
+// regionFor returns the first region configured across the given profiles, an
+// empty region means the global STS endpoint will be used.
+func (s *AWSService) regionFor(profiles ...string) string {
+	for _, profile := range profiles {
+		if credentials, err := s.GetCredentials(profile); err == nil && credentials.Region != "" {
+			return credentials.Region
+		}
+	}
+
+	return ""
 }
 
 func (s *AWSService) persistCredentials(credentials *types.Credentials, profile string) (bool, error) {
@@ -267,11 +780,16 @@ func (s *AWSService) persistCredentials(credentials *types.Credentials, profile
 		Profile:         profile,
 		Expiration:      credentials.Expiration,
 	}
+	s.activeCredentials = token
+
+	if s.sessionFilePath == "" {
+		return true, nil
+	}
 
 	// Write the credentials to a JSON file, we don't return credentials
 	// because we don't want other parts of the program to have access to
 	// them as they are sensitive and should not be tampered with.
-	_, err := s.writeToJSONFile(token, "/tmp/aws-session.json")
+	_, err := s.writeToJSONFile(token, s.sessionFilePath)
 	if err != nil {
 		return false, fmt.Errorf("failed to write credentials to JSON file: %w", err)
 	}
@@ -279,6 +797,28 @@ func (s *AWSService) persistCredentials(credentials *types.Credentials, profile
 	return true, nil
 }
 
+// CredentialProcessOutput returns the active session in the shape the AWS SDKs
+// expect from a credential_process.  This is the only way to read the session
+// back out of the service, so it should only be used to hand credentials to
+// another process.
+func (s *AWSService) CredentialProcessOutput() (*types.CredentialProcessOutput, error) {
+	if s.activeCredentials == nil {
+		return nil, fmt.Errorf("no active session, log in first")
+	}
+
+	return newCredentialProcessOutput(s.activeCredentials), nil
+}
+
+func newCredentialProcessOutput(credentials *types.Credentials) *types.CredentialProcessOutput {
+	return &types.CredentialProcessOutput{
+		Version:         1,
+		AccessKeyId:     credentials.AccessKeyId,
+		SecretAccessKey: credentials.SecretAccessKey,
+		SessionToken:    credentials.SessionToken,
+		Expiration:      credentials.Expiration,
+	}
+}
+
 // Private helper function to write credentials to a JSON file
 // this is used to persist the credentials to a file for the remainder
 // of this programs execution. The bash script will then source this
@@ -287,13 +827,10 @@ func (s *AWSService) persistCredentials(credentials *types.Credentials, profile
 // as the files will be cleaned up by the OS on reboot.
 func (s *AWSService) writeToJSONFile(credentials *types.Credentials, filePath string) (string, error) {
 	// Create JSON structure
-	jsonData := map[string]interface{}{
-		"Version":         1,
-		"AccessKeyId":     credentials.AccessKeyId,
-		"SecretAccessKey": credentials.SecretAccessKey,
-		"SessionToken":    credentials.SessionToken,
-		"Expiration":      credentials.Expiration,
-		"ProfileName":     credentials.Profile,
+	jsonData := types.SessionFile{
+		CredentialProcessOutput: *newCredentialProcessOutput(credentials),
+		ProfileName:             credentials.Profile,
+		Env:                     s.sessionEnv,
 	}
 
 	// Marshal to JSON
@@ -302,7 +839,22 @@ func (s *AWSService) writeToJSONFile(credentials *types.Credentials, filePath st
 		return "", fmt.Errorf("failed to marshal JSON: %w", err)
 	}
 
-	if err := os.WriteFile(filePath, jsonBytes, 0644); err != nil {
+	// /tmp is shared, so never follow a file or symlink someone else put there.  Our
+	// own file from an earlier write is removed first, anyone else's can't be and
+	// O_EXCL refuses to open it.
+	if err := os.Remove(filePath); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return "", fmt.Errorf("failed to replace JSON file: %w", err)
+	}
+
+	file, err := os.OpenFile(filePath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return "", fmt.Errorf("failed to write JSON file: %w", err)
+	}
+	if _, err := file.Write(jsonBytes); err != nil {
+		file.Close()
+		return "", fmt.Errorf("failed to write JSON file: %w", err)
+	}
+	if err := file.Close(); err != nil {
 		return "", fmt.Errorf("failed to write JSON file: %w", err)
 	}
 
@@ -0,0 +1,173 @@
+package aws_client
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/alexmk92/aws-login/core/types"
+)
+
+// DefaultSTSRegion is the signing region for the global STS endpoint
+const DefaultSTSRegion = "us-east-1"
+
+// Config controls where the client sends requests, every endpoint is optional and
+// falls back to the public AWS endpoint for the region.  Overriding an endpoint
+// lets us point at VPC/FIPS endpoints in production or a fake server in tests.
+type Config struct {
+	STSEndpoint          string
+	ECREndpoint          string
+	CodeArtifactEndpoint string
+	EKSEndpoint          string
+	SSOOIDCEndpoint      string
+	SSOEndpoint          string // The IAM Identity Center portal, where accounts, roles and credentials come from
+	SigninEndpoint       string // The console federation endpoint, there's no environment variable for this one
+	HTTPClient           *http.Client
+}
+
+// ConfigFromEnv reads the standard AWS endpoint override environment variables,
+// service specific variables win over the global AWS_ENDPOINT_URL.
+func ConfigFromEnv() Config {
+	global := os.Getenv("AWS_ENDPOINT_URL")
+
+	return Config{
+		STSEndpoint:          firstNonEmpty(os.Getenv("AWS_ENDPOINT_URL_STS"), global),
+		ECREndpoint:          firstNonEmpty(os.Getenv("AWS_ENDPOINT_URL_ECR"), global),
+		CodeArtifactEndpoint: firstNonEmpty(os.Getenv("AWS_ENDPOINT_URL_CODEARTIFACT"), global),
+		EKSEndpoint:          firstNonEmpty(os.Getenv("AWS_ENDPOINT_URL_EKS"), global),
+		SSOOIDCEndpoint:      firstNonEmpty(os.Getenv("AWS_ENDPOINT_URL_SSO_OIDC"), global),
+		SSOEndpoint:          firstNonEmpty(os.Getenv("AWS_ENDPOINT_URL_SSO"), global),
+	}
+}
+
+// Client is a minimal, dependency free client for the AWS APIs we need
+type Client struct {
+	config     Config
+	httpClient *http.Client
+	now        func() time.Time // Overridable so signatures are reproducible in tests
+}
+
+// NewClient creates a client from the config, a default HTTP client with a
+// sensible timeout is used when none is supplied.
+func NewClient(config Config) *Client {
+	httpClient := config.HTTPClient
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: 30 * time.Second}
+	}
+
+	return &Client{
+		config:     config,
+		httpClient: httpClient,
+		now:        time.Now,
+	}
+}
+
+// APIError is returned when AWS responds with an error document
+type APIError struct {
+	StatusCode int
+	Code       string
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	if e.Code == "" {
+		return fmt.Sprintf("request failed with status %d: %s", e.StatusCode, e.Message)
+	}
+
+	return fmt.Sprintf("%s: %s", e.Code, e.Message)
+}
+
+// stsEndpoint returns the endpoint and signing region for STS, regional endpoints
+// are preferred when we know the region as they avoid a round trip to us-east-1.
+func (c *Client) stsEndpoint(region string) (string, string) {
+	if region == "" {
+		region = DefaultSTSRegion
+	}
+
+	if c.config.STSEndpoint != "" {
+		return c.config.STSEndpoint, region
+	}
+
+	if region == DefaultSTSRegion {
+		return "https://sts.amazonaws.com", region
+	}
+
+	return fmt.Sprintf("https://sts.%s.amazonaws.com", region), region
+}
+
+func (c *Client) ecrEndpoint(region string) string {
+	if c.config.ECREndpoint != "" {
+		return c.config.ECREndpoint
+	}
+
+	return fmt.Sprintf("https://api.ecr.%s.amazonaws.com", region)
+}
+
+// do signs and sends the request, returning the body for any 2xx response.  Error
+// bodies are handed to parseError so each protocol can decode its own error shape.
+func (c *Client) do(ctx context.Context, method, url string, headers map[string]string, body []byte,
+	credentials types.Credentials, region, service string, parseError func(int, []byte) error) ([]byte, error) {
+
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+
+	signRequest(req, body, credentials, region, service, c.now())
+
+	return c.send(req, parseError)
+}
+
+// doUnsigned sends the request without a signature, for APIs that authenticate with
+// a bearer token (or not at all) such as IAM Identity Center.
+func (c *Client) doUnsigned(ctx context.Context, method, url string, headers map[string]string, body []byte,
+	parseError func(int, []byte) error) ([]byte, error) {
+
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+
+	return c.send(req, parseError)
+}
+
+func (c *Client) send(req *http.Request, parseError func(int, []byte) error) ([]byte, error) {
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, parseError(resp.StatusCode, respBody)
+	}
+
+	return respBody, nil
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if strings.TrimSpace(value) != "" {
+			return strings.TrimSpace(value)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,77 @@
+package aws_client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alexmk92/aws-login/core/types"
+)
+
+// CodeArtifactToken is a bearer token for every repository in a CodeArtifact domain
+type CodeArtifactToken struct {
+	Token      string
+	Expiration time.Time
+}
+
+type codeArtifactTokenResponse struct {
+	AuthorizationToken string  `json:"authorizationToken"`
+	Expiration         float64 `json:"expiration"`
+}
+
+// GetCodeArtifactAuthorizationToken fetches a token for the domain, CodeArtifact speaks
+// REST JSON so the parameters travel in the query string of an empty POST.  A zero
+// duration lets CodeArtifact pick its default (12 hours, capped to the session).
+func (c *Client) GetCodeArtifactAuthorizationToken(ctx context.Context, credentials types.Credentials, region, domain, domainOwner string, durationSeconds int) (*CodeArtifactToken, error) {
+	query := url.Values{}
+	query.Set("domain", domain)
+	if domainOwner != "" {
+		query.Set("domain-owner", domainOwner)
+	}
+	if durationSeconds > 0 {
+		query.Set("duration", strconv.Itoa(durationSeconds))
+	}
+
+	endpoint := strings.TrimSuffix(c.codeArtifactEndpoint(region), "/") + "/v1/authorization-token?" + query.Encode()
+
+	body, err := c.do(ctx, "POST", endpoint, nil, nil, credentials, region, "codeartifact", parseRESTJSONError)
+	if err != nil {
+		return nil, err
+	}
+
+	var response codeArtifactTokenResponse
+	if err := json.Unmarshal(body, &response); err != nil {
+		return nil, fmt.Errorf("failed to parse CodeArtifact response: %w", err)
+	}
+
+	return &CodeArtifactToken{
+		Token:      response.AuthorizationToken,
+		Expiration: time.Unix(int64(response.Expiration), 0),
+	}, nil
+}
+
+func (c *Client) codeArtifactEndpoint(region string) string {
+	if c.config.CodeArtifactEndpoint != "" {
+		return c.config.CodeArtifactEndpoint
+	}
+
+	return fmt.Sprintf("https://codeartifact.%s.amazonaws.com", region)
+}
+
+// parseRESTJSONError decodes REST JSON errors, the code usually travels in a header
+// we don't see here so we fall back to the message when there is no __type
+func parseRESTJSONError(statusCode int, body []byte) error {
+	var response struct {
+		Type    string `json:"__type"`
+		Message string `json:"message"`
+	}
+	if err := json.Unmarshal(body, &response); err == nil && response.Type == "" && response.Message != "" {
+		return &APIError{StatusCode: statusCode, Message: response.Message}
+	}
+
+	return parseJSONError(statusCode, body)
+}
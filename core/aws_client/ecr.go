@@ -0,0 +1,108 @@
+package aws_client
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/alexmk92/aws-login/core/types"
+)
+
+// ECR speaks the JSON 1.1 protocol, every action is a POST to / with the action
+// named in the X-Amz-Target header.
+const ecrTargetPrefix = "AmazonEC2ContainerRegistry_V20150921."
+
+// AuthorizationData is a decoded ECR authorization token for a single registry
+type AuthorizationData struct {
+	Username      string
+	Password      string
+	ProxyEndpoint string
+	ExpiresAt     time.Time
+}
+
+type getAuthorizationTokenRequest struct {
+	RegistryIds []string `json:"registryIds,omitempty"`
+}
+
+type getAuthorizationTokenResponse struct {
+	AuthorizationData []struct {
+		AuthorizationToken string  `json:"authorizationToken"`
+		ExpiresAt          float64 `json:"expiresAt"`
+		ProxyEndpoint      string  `json:"proxyEndpoint"`
+	} `json:"authorizationData"`
+}
+
+type jsonErrorResponse struct {
+	Type    string `json:"__type"`
+	Message string `json:"message"`
+}
+
+// GetAuthorizationToken fetches docker credentials for the registries in the region,
+// when no registry IDs are given ECR returns a token for the caller's own account.
+func (c *Client) GetAuthorizationToken(ctx context.Context, credentials types.Credentials, region string, registryIDs ...string) ([]AuthorizationData, error) {
+	requestBody, err := json.Marshal(getAuthorizationTokenRequest{RegistryIds: registryIDs})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal ECR request: %w", err)
+	}
+
+	headers := map[string]string{
+		"Content-Type": "application/x-amz-json-1.1",
+		"X-Amz-Target": ecrTargetPrefix + "GetAuthorizationToken",
+	}
+
+	body, err := c.do(ctx, "POST", c.ecrEndpoint(region), headers, requestBody, credentials, region, "ecr", parseJSONError)
+	if err != nil {
+		return nil, err
+	}
+
+	var response getAuthorizationTokenResponse
+	if err := json.Unmarshal(body, &response); err != nil {
+		return nil, fmt.Errorf("failed to parse ECR response: %w", err)
+	}
+
+	authorizations := make([]AuthorizationData, 0, len(response.AuthorizationData))
+	for _, data := range response.AuthorizationData {
+		// The token is base64("AWS:<password>")
+		decoded, err := base64.StdEncoding.DecodeString(data.AuthorizationToken)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode ECR authorization token: %w", err)
+		}
+
+		username, password, ok := strings.Cut(string(decoded), ":")
+		if !ok {
+			return nil, fmt.Errorf("malformed ECR authorization token")
+		}
+
+		authorizations = append(authorizations, AuthorizationData{
+			Username:      username,
+			Password:      password,
+			ProxyEndpoint: data.ProxyEndpoint,
+			ExpiresAt:     time.Unix(int64(data.ExpiresAt), 0),
+		})
+	}
+
+	return authorizations, nil
+}
+
+// parseJSONError decodes the error shape shared by the JSON protocols, the type is
+// usually namespaced (i.e. com.amazonaws.ecr#AccessDeniedException)
+func parseJSONError(statusCode int, body []byte) error {
+	var response jsonErrorResponse
+	if err := json.Unmarshal(body, &response); err != nil || response.Type == "" {
+		return &APIError{StatusCode: statusCode, Message: strings.TrimSpace(string(body))}
+	}
+
+	code := response.Type
+	if i := strings.LastIndex(code, "#"); i >= 0 {
+		code = code[i+1:]
+	}
+
+	return &APIError{
+		StatusCode: statusCode,
+		Code:       code,
+		Message:    response.Message,
+	}
+}
@@ -0,0 +1,97 @@
+package aws_client
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/alexmk92/aws-login/core/types"
+)
+
+// EKS tokens are a presigned STS GetCallerIdentity URL, the API server calls it to find
+// out who we are.  This is the same scheme `aws eks get-token` and aws-iam-authenticator
+// use, see https://github.com/kubernetes-sigs/aws-iam-authenticator#api-authorization-from-outside-a-cluster
+const (
+	eksTokenPrefix     = "k8s-aws-v1."
+	eksClusterIDHeader = "x-k8s-aws-id"
+
+	// The presigned URL is only valid for a minute, but the API server caches the
+	// identity for 15.  We tell kubectl to refresh a minute early like the AWS CLI does.
+	eksPresignExpiry = 60 * time.Second
+	EKSTokenLifetime = 14 * time.Minute
+)
+
+// EKSCluster holds the connection details kubectl needs for a cluster
+type EKSCluster struct {
+	Name                     string
+	Arn                      string
+	Endpoint                 string
+	CertificateAuthorityData string // Base64 encoded PEM, exactly as the kubeconfig expects it
+}
+
+type describeClusterResponse struct {
+	Cluster struct {
+		Name                 string `json:"name"`
+		Arn                  string `json:"arn"`
+		Endpoint             string `json:"endpoint"`
+		CertificateAuthority struct {
+			Data string `json:"data"`
+		} `json:"certificateAuthority"`
+	} `json:"cluster"`
+}
+
+// DescribeCluster fetches the endpoint and certificate authority of the cluster, EKS
+// speaks REST JSON so the cluster name travels in the path of a GET.
+func (c *Client) DescribeCluster(ctx context.Context, credentials types.Credentials, region, name string) (*EKSCluster, error) {
+	endpoint := strings.TrimSuffix(c.eksEndpoint(region), "/") + "/clusters/" + url.PathEscape(name)
+
+	body, err := c.do(ctx, "GET", endpoint, nil, nil, credentials, region, "eks", parseRESTJSONError)
+	if err != nil {
+		return nil, err
+	}
+
+	var response describeClusterResponse
+	if err := json.Unmarshal(body, &response); err != nil {
+		return nil, fmt.Errorf("failed to parse EKS response: %w", err)
+	}
+
+	return &EKSCluster{
+		Name:                     response.Cluster.Name,
+		Arn:                      response.Cluster.Arn,
+		Endpoint:                 response.Cluster.Endpoint,
+		CertificateAuthorityData: response.Cluster.CertificateAuthority.Data,
+	}, nil
+}
+
+// GetEKSToken builds a bearer token for the cluster, no request is sent as the
+// token is the presigned URL itself.  The expiration is when kubectl should ask
+// for a new token, not when the presigned URL expires.
+func (c *Client) GetEKSToken(credentials types.Credentials, region, clusterName string) (string, time.Time, error) {
+	endpoint, signingRegion := c.stsEndpoint(region)
+
+	req, err := http.NewRequest("GET", strings.TrimSuffix(endpoint, "/")+"/?Action=GetCallerIdentity&Version=2011-06-15", nil)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set(eksClusterIDHeader, clusterName)
+
+	now := c.now()
+	presignRequest(req, credentials, signingRegion, "sts", eksPresignExpiry, now)
+
+	token := eksTokenPrefix + base64.RawURLEncoding.EncodeToString([]byte(req.URL.String()))
+
+	return token, now.Add(EKSTokenLifetime), nil
+}
+
+func (c *Client) eksEndpoint(region string) string {
+	if c.config.EKSEndpoint != "" {
+		return c.config.EKSEndpoint
+	}
+
+	return fmt.Sprintf("https://eks.%s.amazonaws.com", region)
+}
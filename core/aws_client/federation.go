@@ -0,0 +1,98 @@
+package aws_client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/alexmk92/aws-login/core/types"
+)
+
+// The federation endpoint exchanges role credentials for a console sign-in token, see:
+// https://docs.aws.amazon.com/IAM/latest/UserGuide/id_roles_providers_enable-console-custom-url.html
+const (
+	DefaultSigninEndpoint = "https://signin.aws.amazon.com/federation"
+	DefaultConsoleURL     = "https://console.aws.amazon.com/"
+)
+
+type federationSession struct {
+	SessionID    string `json:"sessionId"`
+	SessionKey   string `json:"sessionKey"`
+	SessionToken string `json:"sessionToken"`
+}
+
+// GetSigninToken exchanges the credentials for a sign-in token, the token is only
+// valid for 15 minutes so it should be turned into a URL and used straight away.
+//
+// Unlike every other call this request isn't signed, the credentials themselves
+// travel in the query string.  Only role (or federation token) credentials are
+// accepted, the endpoint rejects GetSessionToken credentials.
+func (c *Client) GetSigninToken(ctx context.Context, credentials types.Credentials) (string, error) {
+	session, err := json.Marshal(federationSession{
+		SessionID:    credentials.AccessKeyId,
+		SessionKey:   credentials.SecretAccessKey,
+		SessionToken: credentials.SessionToken,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal federation session: %w", err)
+	}
+
+	query := url.Values{}
+	query.Set("Action", "getSigninToken")
+	query.Set("Session", string(session))
+
+	req, err := http.NewRequestWithContext(ctx, "GET", c.signinEndpoint()+"?"+query.Encode(), nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create request: %w", err)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("failed to read response: %w", err)
+	}
+
+	// Errors come back as an HTML page rather than a document we can decode
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return "", &APIError{StatusCode: resp.StatusCode, Message: "the federation endpoint rejected the session credentials"}
+	}
+
+	var response struct {
+		SigninToken string `json:"SigninToken"`
+	}
+	if err := json.Unmarshal(body, &response); err != nil || response.SigninToken == "" {
+		return "", fmt.Errorf("failed to parse federation response: %s", strings.TrimSpace(string(body)))
+	}
+
+	return response.SigninToken, nil
+}
+
+// ConsoleLoginURL builds the URL that signs the browser in with the token and then
+// redirects to the destination, the issuer is where the console sends users whose
+// session has expired.
+func (c *Client) ConsoleLoginURL(signinToken, issuer, destination string) string {
+	query := url.Values{}
+	query.Set("Action", "login")
+	query.Set("Issuer", issuer)
+	query.Set("Destination", destination)
+	query.Set("SigninToken", signinToken)
+
+	return c.signinEndpoint() + "?" + query.Encode()
+}
+
+func (c *Client) signinEndpoint() string {
+	if c.config.SigninEndpoint != "" {
+		return c.config.SigninEndpoint
+	}
+
+	return DefaultSigninEndpoint
+}
@@ -0,0 +1,297 @@
+package aws_client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/alexmk92/aws-login/core/types"
+)
+
+// IAM Identity Center is two REST JSON APIs, neither of which is SigV4 signed:
+//
+//   - OIDC registers us as a client and runs the OAuth device authorization flow, see
+//     https://docs.aws.amazon.com/singlesignon/latest/OIDCAPIReference/Welcome.html
+//   - the portal lists accounts and roles and hands out role credentials in exchange
+//     for the OIDC access token, see
+//     https://docs.aws.amazon.com/singlesignon/latest/PortalAPIReference/Welcome.html
+const (
+	ssoDeviceCodeGrantType = "urn:ietf:params:oauth:grant-type:device_code"
+	ssoBearerTokenHeader   = "x-amz-sso_bearer_token"
+
+	// OIDC error codes returned while the user hasn't approved the device yet
+	SSOErrorAuthorizationPending = "authorization_pending"
+	SSOErrorSlowDown             = "slow_down"
+)
+
+// SSOClientRegistration identifies us to OIDC, registrations last for 90 days so
+// they are cached alongside the token
+type SSOClientRegistration struct {
+	ClientID     string
+	ClientSecret string
+	ExpiresAt    time.Time
+}
+
+// SSODeviceAuthorization is a pending login, the user approves it in the browser at
+// VerificationURIComplete (or VerificationURI after typing UserCode)
+type SSODeviceAuthorization struct {
+	DeviceCode              string
+	UserCode                string
+	VerificationURI         string
+	VerificationURIComplete string
+	ExpiresAt               time.Time
+	Interval                time.Duration // How long to wait between CreateToken calls
+}
+
+// SSOToken is the OIDC access token the portal accepts
+type SSOToken struct {
+	AccessToken string
+	ExpiresAt   time.Time
+}
+
+// SSOAccount is an AWS account the user has been assigned to
+type SSOAccount struct {
+	AccountID    string `json:"accountId"`
+	AccountName  string `json:"accountName"`
+	EmailAddress string `json:"emailAddress"`
+}
+
+// RegisterClient registers a public OIDC client, scopes may be empty
+func (c *Client) RegisterClient(ctx context.Context, region, clientName string, scopes []string) (*SSOClientRegistration, error) {
+	var response struct {
+		ClientID              string `json:"clientId"`
+		ClientSecret          string `json:"clientSecret"`
+		ClientSecretExpiresAt int64  `json:"clientSecretExpiresAt"`
+	}
+
+	request := map[string]any{
+		"clientName": clientName,
+		"clientType": "public",
+	}
+	if len(scopes) > 0 {
+		request["scopes"] = scopes
+	}
+
+	err := c.callOIDC(ctx, region, "/client/register", request, &response)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SSOClientRegistration{
+		ClientID:     response.ClientID,
+		ClientSecret: response.ClientSecret,
+		ExpiresAt:    time.Unix(response.ClientSecretExpiresAt, 0),
+	}, nil
+}
+
+// StartDeviceAuthorization starts a login for the start URL, the user then has until
+// ExpiresAt to approve it
+func (c *Client) StartDeviceAuthorization(ctx context.Context, region string, registration SSOClientRegistration, startURL string) (*SSODeviceAuthorization, error) {
+	var response struct {
+		DeviceCode              string `json:"deviceCode"`
+		UserCode                string `json:"userCode"`
+		VerificationURI         string `json:"verificationUri"`
+		VerificationURIComplete string `json:"verificationUriComplete"`
+		ExpiresIn               int    `json:"expiresIn"`
+		Interval                int    `json:"interval"`
+	}
+
+	err := c.callOIDC(ctx, region, "/device_authorization", map[string]any{
+		"clientId":     registration.ClientID,
+		"clientSecret": registration.ClientSecret,
+		"startUrl":     startURL,
+	}, &response)
+	if err != nil {
+		return nil, err
+	}
+
+	// The interval is optional, 5 seconds is the default from RFC 8628
+	interval := time.Duration(response.Interval) * time.Second
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+
+	return &SSODeviceAuthorization{
+		DeviceCode:              response.DeviceCode,
+		UserCode:                response.UserCode,
+		VerificationURI:         response.VerificationURI,
+		VerificationURIComplete: response.VerificationURIComplete,
+		ExpiresAt:               c.now().Add(time.Duration(response.ExpiresIn) * time.Second),
+		Interval:                interval,
+	}, nil
+}
+
+// CreateToken exchanges an approved device code for an access token, until the user
+// approves the login this fails with an APIError coded SSOErrorAuthorizationPending
+// (or SSOErrorSlowDown when we're polling too often).
+func (c *Client) CreateToken(ctx context.Context, region string, registration SSOClientRegistration, deviceCode string) (*SSOToken, error) {
+	var response struct {
+		AccessToken string `json:"accessToken"`
+		ExpiresIn   int    `json:"expiresIn"`
+	}
+
+	err := c.callOIDC(ctx, region, "/token", map[string]any{
+		"clientId":     registration.ClientID,
+		"clientSecret": registration.ClientSecret,
+		"grantType":    ssoDeviceCodeGrantType,
+		"deviceCode":   deviceCode,
+	}, &response)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SSOToken{
+		AccessToken: response.AccessToken,
+		ExpiresAt:   c.now().Add(time.Duration(response.ExpiresIn) * time.Second),
+	}, nil
+}
+
+// ListAccounts returns every account assigned to the user, following the pages
+func (c *Client) ListAccounts(ctx context.Context, region, accessToken string) ([]SSOAccount, error) {
+	var accounts []SSOAccount
+	nextToken := ""
+
+	for {
+		query := url.Values{}
+		query.Set("max_result", "100")
+		if nextToken != "" {
+			query.Set("next_token", nextToken)
+		}
+
+		var response struct {
+			AccountList []SSOAccount `json:"accountList"`
+			NextToken   string       `json:"nextToken"`
+		}
+		if err := c.callPortal(ctx, region, accessToken, "/assignment/accounts", query, &response); err != nil {
+			return nil, err
+		}
+
+		accounts = append(accounts, response.AccountList...)
+		if nextToken = response.NextToken; nextToken == "" {
+			return accounts, nil
+		}
+	}
+}
+
+// ListAccountRoles returns the names of the roles (permission sets) the user can use
+// in the account, following the pages
+func (c *Client) ListAccountRoles(ctx context.Context, region, accessToken, accountID string) ([]string, error) {
+	var roles []string
+	nextToken := ""
+
+	for {
+		query := url.Values{}
+		query.Set("account_id", accountID)
+		query.Set("max_result", "100")
+		if nextToken != "" {
+			query.Set("next_token", nextToken)
+		}
+
+		var response struct {
+			RoleList []struct {
+				RoleName string `json:"roleName"`
+			} `json:"roleList"`
+			NextToken string `json:"nextToken"`
+		}
+		if err := c.callPortal(ctx, region, accessToken, "/assignment/roles", query, &response); err != nil {
+			return nil, err
+		}
+
+		for _, role := range response.RoleList {
+			roles = append(roles, role.RoleName)
+		}
+		if nextToken = response.NextToken; nextToken == "" {
+			return roles, nil
+		}
+	}
+}
+
+// GetRoleCredentials returns temporary credentials for the role in the account
+func (c *Client) GetRoleCredentials(ctx context.Context, region, accessToken, accountID, roleName string) (*types.Credentials, error) {
+	query := url.Values{}
+	query.Set("account_id", accountID)
+	query.Set("role_name", roleName)
+
+	var response struct {
+		RoleCredentials struct {
+			AccessKeyID     string `json:"accessKeyId"`
+			SecretAccessKey string `json:"secretAccessKey"`
+			SessionToken    string `json:"sessionToken"`
+			Expiration      int64  `json:"expiration"` // Milliseconds since the epoch
+		} `json:"roleCredentials"`
+	}
+	if err := c.callPortal(ctx, region, accessToken, "/federation/credentials", query, &response); err != nil {
+		return nil, err
+	}
+
+	return &types.Credentials{
+		AccessKeyId:     response.RoleCredentials.AccessKeyID,
+		SecretAccessKey: response.RoleCredentials.SecretAccessKey,
+		SessionToken:    response.RoleCredentials.SessionToken,
+		Expiration:      time.UnixMilli(response.RoleCredentials.Expiration).UTC().Format(time.RFC3339),
+	}, nil
+}
+
+func (c *Client) callOIDC(ctx context.Context, region, path string, request any, out any) error {
+	requestBody, err := json.Marshal(request)
+	if err != nil {
+		return fmt.Errorf("failed to marshal OIDC request: %w", err)
+	}
+
+	endpoint := c.config.SSOOIDCEndpoint
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://oidc.%s.amazonaws.com", region)
+	}
+
+	headers := map[string]string{"Content-Type": "application/json"}
+	body, err := c.doUnsigned(ctx, "POST", strings.TrimSuffix(endpoint, "/")+path, headers, requestBody, parseOIDCError)
+	if err != nil {
+		return err
+	}
+
+	if err := json.Unmarshal(body, out); err != nil {
+		return fmt.Errorf("failed to parse OIDC response: %w", err)
+	}
+
+	return nil
+}
+
+func (c *Client) callPortal(ctx context.Context, region, accessToken, path string, query url.Values, out any) error {
+	endpoint := c.config.SSOEndpoint
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://portal.sso.%s.amazonaws.com", region)
+	}
+
+	headers := map[string]string{ssoBearerTokenHeader: accessToken}
+	body, err := c.doUnsigned(ctx, "GET", strings.TrimSuffix(endpoint, "/")+path+"?"+query.Encode(), headers, nil, parseRESTJSONError)
+	if err != nil {
+		return err
+	}
+
+	if err := json.Unmarshal(body, out); err != nil {
+		return fmt.Errorf("failed to parse IAM Identity Center response: %w", err)
+	}
+
+	return nil
+}
+
+// parseOIDCError decodes the OAuth style errors OIDC returns, i.e.
+// {"error":"authorization_pending","error_description":"..."}
+func parseOIDCError(statusCode int, body []byte) error {
+	var response struct {
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.Unmarshal(body, &response); err == nil && response.Error != "" {
+		message := response.ErrorDescription
+		if message == "" {
+			message = response.Error
+		}
+		return &APIError{StatusCode: statusCode, Code: response.Error, Message: message}
+	}
+
+	return parseRESTJSONError(statusCode, body)
+}
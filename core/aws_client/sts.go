@@ -0,0 +1,159 @@
+package aws_client
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/alexmk92/aws-login/core/types"
+)
+
+// STS speaks the query protocol, form encoded requests with XML responses:
+// https://docs.aws.amazon.com/STS/latest/APIReference/welcome.html
+const stsAPIVersion = "2011-06-15"
+
+// GetSessionTokenInput mirrors the parameters of sts:GetSessionToken
+type GetSessionTokenInput struct {
+	DurationSeconds int
+	SerialNumber    string
+	TokenCode       string
+}
+
+// AssumeRoleInput mirrors the parameters of sts:AssumeRole
+type AssumeRoleInput struct {
+	RoleArn         string
+	RoleSessionName string
+	DurationSeconds int
+	ExternalID      string
+	SourceIdentity  string
+	Tags            map[string]string
+}
+
+type stsCredentials struct {
+	AccessKeyId     string `xml:"AccessKeyId"`
+	SecretAccessKey string `xml:"SecretAccessKey"`
+	SessionToken    string `xml:"SessionToken"`
+	Expiration      string `xml:"Expiration"`
+}
+
+func (c stsCredentials) toCredentials() *types.Credentials {
+	return &types.Credentials{
+		AccessKeyId:     c.AccessKeyId,
+		SecretAccessKey: c.SecretAccessKey,
+		SessionToken:    c.SessionToken,
+		Expiration:      c.Expiration,
+	}
+}
+
+type getSessionTokenResponse struct {
+	Result struct {
+		Credentials stsCredentials `xml:"Credentials"`
+	} `xml:"GetSessionTokenResult"`
+}
+
+type assumeRoleResponse struct {
+	Result struct {
+		Credentials stsCredentials `xml:"Credentials"`
+	} `xml:"AssumeRoleResult"`
+}
+
+type stsErrorResponse struct {
+	Error struct {
+		Code    string `xml:"Code"`
+		Message string `xml:"Message"`
+	} `xml:"Error"`
+}
+
+// GetSessionToken exchanges long lived IAM user keys (plus an MFA code) for a session
+func (c *Client) GetSessionToken(ctx context.Context, credentials types.Credentials, region string, input GetSessionTokenInput) (*types.Credentials, error) {
+	params := url.Values{}
+	params.Set("Action", "GetSessionToken")
+	if input.DurationSeconds > 0 {
+		params.Set("DurationSeconds", strconv.Itoa(input.DurationSeconds))
+	}
+	if input.SerialNumber != "" {
+		params.Set("SerialNumber", input.SerialNumber)
+	}
+	if input.TokenCode != "" {
+		params.Set("TokenCode", input.TokenCode)
+	}
+
+	var response getSessionTokenResponse
+	if err := c.callSTS(ctx, credentials, region, params, &response); err != nil {
+		return nil, err
+	}
+
+	return response.Result.Credentials.toCredentials(), nil
+}
+
+// AssumeRole assumes the role using the supplied (usually session) credentials
+func (c *Client) AssumeRole(ctx context.Context, credentials types.Credentials, region string, input AssumeRoleInput) (*types.Credentials, error) {
+	params := url.Values{}
+	params.Set("Action", "AssumeRole")
+	params.Set("RoleArn", input.RoleArn)
+	params.Set("RoleSessionName", input.RoleSessionName)
+	if input.DurationSeconds > 0 {
+		params.Set("DurationSeconds", strconv.Itoa(input.DurationSeconds))
+	}
+	if input.ExternalID != "" {
+		params.Set("ExternalId", input.ExternalID)
+	}
+	if input.SourceIdentity != "" {
+		params.Set("SourceIdentity", input.SourceIdentity)
+	}
+
+	// Tags are a list in the query protocol, sort the keys so requests are reproducible
+	tagKeys := make([]string, 0, len(input.Tags))
+	for key := range input.Tags {
+		tagKeys = append(tagKeys, key)
+	}
+	sort.Strings(tagKeys)
+	for i, key := range tagKeys {
+		params.Set(fmt.Sprintf("Tags.member.%d.Key", i+1), key)
+		params.Set(fmt.Sprintf("Tags.member.%d.Value", i+1), input.Tags[key])
+	}
+
+	var response assumeRoleResponse
+	if err := c.callSTS(ctx, credentials, region, params, &response); err != nil {
+		return nil, err
+	}
+
+	return response.Result.Credentials.toCredentials(), nil
+}
+
+func (c *Client) callSTS(ctx context.Context, credentials types.Credentials, region string, params url.Values, out any) error {
+	params.Set("Version", stsAPIVersion)
+	endpoint, signingRegion := c.stsEndpoint(region)
+
+	headers := map[string]string{
+		"Content-Type": "application/x-www-form-urlencoded; charset=utf-8",
+	}
+
+	body, err := c.do(ctx, "POST", endpoint, headers, []byte(params.Encode()), credentials, signingRegion, "sts", parseSTSError)
+	if err != nil {
+		return err
+	}
+
+	if err := xml.Unmarshal(body, out); err != nil {
+		return fmt.Errorf("failed to parse STS response: %w", err)
+	}
+
+	return nil
+}
+
+func parseSTSError(statusCode int, body []byte) error {
+	var response stsErrorResponse
+	if err := xml.Unmarshal(body, &response); err != nil || response.Error.Code == "" {
+		return &APIError{StatusCode: statusCode, Message: strings.TrimSpace(string(body))}
+	}
+
+	return &APIError{
+		StatusCode: statusCode,
+		Code:       response.Error.Code,
+		Message:    response.Error.Message,
+	}
+}
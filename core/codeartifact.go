@@ -0,0 +1,407 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/alexmk92/aws-login/core/types"
+)
+
+// Package formats we know how to configure
+const (
+	CodeArtifactFormatNpm   = "npm"
+	CodeArtifactFormatPypi  = "pypi"
+	CodeArtifactFormatMaven = "maven"
+	CodeArtifactFormatGo    = "go"
+)
+
+// SetAttemptCodeArtifactLogin enables the CodeArtifact step after the session is established
+func (s *AWSService) SetAttemptCodeArtifactLogin(attempt bool) {
+	s.attemptCodeArtifactLogin = attempt
+}
+
+// LoginToCodeArtifact fetches a token for every domain in codeartifact_repositories on
+// the active profile and configures the matching package manager for each repository:
+//
+//   - npm writes the token, and the scoped (or opted in global) registry, to ~/.npmrc
+//     (or NPM_CONFIG_USERCONFIG)
+//   - pypi writes the index-url to pip.conf (or PIP_CONFIG_FILE)
+//   - maven writes a server and profile to ~/.m2/settings.xml
+//   - go adds GOPROXY (and GONOSUMDB) to the session file for the shell helper to export
+//
+// Like LoginToECR, a result is returned per repository and the error is non-nil when
+// nothing could be attempted or any repository failed.
+func (s *AWSService) LoginToCodeArtifact() ([]types.CodeArtifactLoginResult, error) {
+	if !s.attemptCodeArtifactLogin {
+		return nil, fmt.Errorf("attempt to login to CodeArtifact is disabled")
+	}
+
+	if s.activeCredentials == nil {
+		return nil, fmt.Errorf("no active session, log in first")
+	}
+
+	// The repositories may live on the role profile or the base profile
+	var profile *types.StaticCredential
+	for _, name := range []string{os.Getenv("AWS_PROFILE"), s.sessionProfile} {
+		if credentials, err := s.GetCredentials(name); err == nil && len(credentials.CodeArtifactRepositories) > 0 {
+			profile = credentials
+			break
+		}
+	}
+	if profile == nil {
+		return nil, fmt.Errorf("no codeartifact_repositories configured for profile '%s'", os.Getenv("AWS_PROFILE"))
+	}
+
+	owner := profile.CodeArtifactDomainOwner
+	if owner == "" {
+		owner = profile.AccountID
+	}
+	if owner == "" {
+		return nil, fmt.Errorf("codeartifact_domain_owner (or account_id) is required for profile '%s'", profile.ProfileName)
+	}
+
+	region := firstNonEmpty(profile.CodeArtifactRegion, profile.Region)
+	if region == "" {
+		return nil, fmt.Errorf("codeartifact_region (or region) is required for profile '%s'", profile.ProfileName)
+	}
+
+	// Every repository in a domain shares the token, so only ask once per domain
+	tokens := make(map[string]string)
+	tokenErrors := make(map[string]error)
+
+	results := make([]types.CodeArtifactLoginResult, 0, len(profile.CodeArtifactRepositories))
+	failed := 0
+	for _, repository := range profile.CodeArtifactRepositories {
+		if _, ok := tokens[repository.Domain]; !ok && tokenErrors[repository.Domain] == nil {
+			token, err := s.apiClient.GetCodeArtifactAuthorizationToken(context.Background(), *s.activeCredentials, region, repository.Domain, owner, 0)
+			if err != nil {
+				tokenErrors[repository.Domain] = classifyError(fmt.Sprintf("failed to get CodeArtifact token for %s", repository.Domain), err)
+			} else {
+				tokens[repository.Domain] = token.Token
+			}
+		}
+
+		err := tokenErrors[repository.Domain]
+		if err == nil {
+			endpoint := codeArtifactEndpoint(repository, owner, region)
+			err = s.configureCodeArtifactRepository(repository, endpoint, tokens[repository.Domain], profile)
+		}
+		if err != nil {
+			failed++
+		}
+		results = append(results, types.CodeArtifactLoginResult{Repository: repository, Err: err})
+	}
+
+	// GOPROXY only reaches the shell through the session file, so rewrite it now the
+	// variables are known
+	if len(s.sessionEnv) > 0 && s.sessionFilePath != "" {
+		if _, err := s.writeToJSONFile(s.activeCredentials, s.sessionFilePath); err != nil {
+			return results, fmt.Errorf("failed to write credentials to JSON file: %w", err)
+		}
+	}
+
+	if failed > 0 {
+		return results, fmt.Errorf("failed to configure %d of %d CodeArtifact repositories", failed, len(results))
+	}
+
+	return results, nil
+}
+
+// codeArtifactEndpoint builds the repository URL, this is the documented format that
+// GetRepositoryEndpoint returns so we save ourselves a round trip per repository
+func codeArtifactEndpoint(repository types.CodeArtifactRepository, owner, region string) string {
+	return fmt.Sprintf("https://%s-%s.d.codeartifact.%s.amazonaws.com/%s/%s/",
+		repository.Domain, owner, region, repository.Format, repository.Repository)
+}
+
+func (s *AWSService) configureCodeArtifactRepository(repository types.CodeArtifactRepository, endpoint, token string, profile *types.StaticCredential) error {
+	switch repository.Format {
+	case CodeArtifactFormatNpm:
+		path, err := npmrcPath()
+		if err != nil {
+			return err
+		}
+		return writeNpmrc(path, endpoint, token, profile.CodeArtifactNpmScope, profile.CodeArtifactNpmGlobalRegistry)
+
+	case CodeArtifactFormatPypi:
+		path, err := pipConfigPath()
+		if err != nil {
+			return err
+		}
+		return writePipConfig(path, authenticatedURL(endpoint, token)+"simple/")
+
+	case CodeArtifactFormatMaven:
+		path, err := mavenSettingsPath()
+		if err != nil {
+			return err
+		}
+		id := repository.Domain + "-" + repository.Repository
+		return writeMavenSettings(path, id, endpoint, token)
+
+	case CodeArtifactFormatGo:
+		if s.sessionEnv == nil {
+			s.sessionEnv = make(map[string]string)
+		}
+		s.sessionEnv["GOPROXY"] = authenticatedURL(endpoint, token) + ",direct"
+		if profile.CodeArtifactGoNoSumDB != "" {
+			s.sessionEnv["GONOSUMDB"] = profile.CodeArtifactGoNoSumDB
+		}
+		return nil
+
+	default:
+		return fmt.Errorf("unknown CodeArtifact format '%s', valid options are: npm, pypi, maven, go", repository.Format)
+	}
+}
+
+// authenticatedURL embeds the token as basic auth, the username is always "aws"
+func authenticatedURL(endpoint, token string) string {
+	return strings.Replace(endpoint, "https://", "https://aws:"+token+"@", 1)
+}
+
+func npmrcPath() (string, error) {
+	if path := os.Getenv("NPM_CONFIG_USERCONFIG"); path != "" {
+		return path, nil
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %w", err)
+	}
+	return filepath.Join(home, ".npmrc"), nil
+}
+
+func pipConfigPath() (string, error) {
+	if path := os.Getenv("PIP_CONFIG_FILE"); path != "" {
+		return path, nil
+	}
+
+	// ~/.config/pip/pip.conf on Linux, ~/Library/Application Support/pip/pip.conf on macOS
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get config directory: %w", err)
+	}
+	return filepath.Join(configDir, "pip", "pip.conf"), nil
+}
+
+func mavenSettingsPath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %w", err)
+	}
+	return filepath.Join(home, ".m2", "settings.xml"), nil
+}
+
+// writeNpmrc stores the token for the repository and points the scope at it, every
+// other setting is kept.  The global registry is only replaced when asked to, the
+// user's own registry is left behind as a comment so it can be restored.
+func writeNpmrc(path, endpoint, token, scope string, globalRegistry bool) error {
+	lines, err := readLines(path)
+	if err != nil {
+		return err
+	}
+
+	// npm keys tokens by the registry URL without the scheme
+	tokenKey := "//" + strings.TrimPrefix(endpoint, "https://") + ":_authToken="
+
+	scopeKey := ""
+	if scope != "" {
+		scopeKey = "@" + strings.TrimPrefix(scope, "@") + ":registry="
+	}
+
+	kept := make([]string, 0, len(lines)+3)
+	for _, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(trimmed, tokenKey):
+			continue
+		case scopeKey != "" && strings.HasPrefix(trimmed, scopeKey):
+			continue
+		case globalRegistry && strings.HasPrefix(trimmed, "registry="):
+			// Our own registry from an earlier login is simply replaced
+			if !strings.Contains(trimmed, ".codeartifact.") {
+				kept = append(kept, "; replaced by aws-login: "+trimmed)
+			}
+			continue
+		}
+		kept = append(kept, line)
+	}
+
+	if scopeKey != "" {
+		kept = append(kept, scopeKey+endpoint)
+	}
+	if globalRegistry {
+		kept = append(kept, "registry="+endpoint)
+	}
+	kept = append(kept, tokenKey+token)
+
+	return writePrivateFile(path, strings.Join(kept, "\n")+"\n")
+}
+
+// writePipConfig sets index-url in the [global] section, creating the section when
+// the file doesn't have one
+func writePipConfig(path, indexURL string) error {
+	lines, err := readLines(path)
+	if err != nil {
+		return err
+	}
+
+	var output []string
+	inGlobal, written := false, false
+	for _, line := range lines {
+		trimmed := strings.TrimSpace(line)
+
+		if strings.HasPrefix(trimmed, "[") {
+			// Leaving [global] without finding index-url, add it at the end of the section
+			if inGlobal && !written {
+				output = append(output, "index-url = "+indexURL)
+				written = true
+			}
+			inGlobal = trimmed == "[global]"
+		} else if inGlobal {
+			if key, _, ok := strings.Cut(trimmed, "="); ok && strings.TrimSpace(key) == "index-url" {
+				if !written {
+					output = append(output, "index-url = "+indexURL)
+					written = true
+				}
+				continue
+			}
+		}
+
+		output = append(output, line)
+	}
+
+	if inGlobal && !written {
+		output = append(output, "index-url = "+indexURL)
+		written = true
+	}
+	if !written {
+		output = append(output, "[global]", "index-url = "+indexURL)
+	}
+
+	return writePrivateFile(path, strings.Join(output, "\n")+"\n")
+}
+
+// Maven settings are XML and commonly hand edited, round tripping them through
+// encoding/xml would drop comments, so we manage our own blocks between markers
+const mavenSettingsTemplate = `<?xml version="1.0" encoding="UTF-8"?>
+<settings xmlns="http://maven.apache.org/SETTINGS/1.0.0"
+          xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance"
+          xsi:schemaLocation="http://maven.apache.org/SETTINGS/1.0.0 https://maven.apache.org/xsd/settings-1.0.0.xsd">
+</settings>
+`
+
+// writeMavenSettings adds a server holding the token and an active profile pointing
+// at the repository, both with the same id so pom.xml files can reference it
+func writeMavenSettings(path, id, endpoint, token string) error {
+	raw, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	content := string(raw)
+	if strings.TrimSpace(content) == "" {
+		content = mavenSettingsTemplate
+	}
+
+	server := fmt.Sprintf(`    <server>
+      <id>%s</id>
+      <username>aws</username>
+      <password>%s</password>
+    </server>`, id, token)
+
+	profile := fmt.Sprintf(`    <profile>
+      <id>%[1]s</id>
+      <activation>
+        <activeByDefault>true</activeByDefault>
+      </activation>
+      <repositories>
+        <repository>
+          <id>%[1]s</id>
+          <url>%[2]s</url>
+        </repository>
+      </repositories>
+    </profile>`, id, endpoint)
+
+	content, err = upsertXMLBlock(content, "servers", "aws-login server "+id, server)
+	if err != nil {
+		return fmt.Errorf("failed to update %s: %w", path, err)
+	}
+	content, err = upsertXMLBlock(content, "profiles", "aws-login profile "+id, profile)
+	if err != nil {
+		return fmt.Errorf("failed to update %s: %w", path, err)
+	}
+
+	return writePrivateFile(path, content)
+}
+
+// upsertXMLBlock replaces the block between the marker comments, or inserts it into
+// the parent element (creating the parent inside <settings> when it is missing)
+func upsertXMLBlock(content, parent, marker, block string) (string, error) {
+	begin := fmt.Sprintf("<!-- begin %s -->", marker)
+	end := fmt.Sprintf("<!-- end %s -->", marker)
+	wrapped := fmt.Sprintf("    %s\n%s\n    %s", begin, block, end)
+
+	if start := strings.Index(content, begin); start >= 0 {
+		if stop := strings.Index(content[start:], end); stop >= 0 {
+			// Replace from the start of the line so indentation doesn't drift
+			lineStart := strings.LastIndex(content[:start], "\n") + 1
+			return content[:lineStart] + wrapped + content[start+stop+len(end):], nil
+		}
+	}
+
+	closing := "</" + parent + ">"
+	if i := strings.Index(content, closing); i >= 0 {
+		lineStart := strings.LastIndex(content[:i], "\n") + 1
+		return content[:lineStart] + wrapped + "\n" + content[lineStart:], nil
+	}
+
+	i := strings.LastIndex(content, "</settings>")
+	if i < 0 {
+		return "", fmt.Errorf("no <settings> element found")
+	}
+	element := fmt.Sprintf("  <%s>\n%s\n  %s\n", parent, wrapped, closing)
+	return content[:i] + element + content[i:], nil
+}
+
+// readLines returns the lines of the file, a missing file has no lines
+func readLines(path string) ([]string, error) {
+	raw, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	content := strings.TrimRight(string(raw), "\n")
+	if content == "" {
+		return nil, nil
+	}
+	return strings.Split(content, "\n"), nil
+}
+
+// writePrivateFile writes a file that contains a token, only the user may read it
+func writePrivateFile(path, content string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("failed to create %s: %w", filepath.Dir(path), err)
+	}
+
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+
+	// WriteFile keeps the mode of an existing file
+	return os.Chmod(path, 0600)
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
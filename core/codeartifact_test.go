@@ -0,0 +1,245 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/alexmk92/aws-login/core/aws_client"
+	"github.com/alexmk92/aws-login/core/types"
+)
+
+func TestAWSService_LoginToCodeArtifact(t *testing.T) {
+	cr := NewCredentialReader()
+	cr.clearCredentials()
+	err := cr.loadCredentialsFromContent(`[prd]
+aws_access_key_id = AKIAI44QH8DHBEXAMPLE
+aws_secret_access_key = je7MtGbClwBF/2Zp9Utk/h3yCo8nvbEXAMPLEKEY
+mfa_serial = arn:aws:iam::123456789012:mfa/prd-user
+account_id = 123456789012
+region = eu-west-2
+codeartifact_repositories = npm:acme/npm-store, pypi:acme/pypi-store, maven:acme/maven-releases, go:acme/go-proxy, cargo:acme/crates
+codeartifact_go_nosumdb = github.com/acme/*
+codeartifact_npm_scope = @acme`)
+	if err != nil {
+		t.Fatalf("Failed to load test credentials: %v", err)
+	}
+
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		fmt.Fprint(w, `{"authorizationToken":"ca-token","expiration":4070908800}`)
+	}))
+	defer server.Close()
+
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("NPM_CONFIG_USERCONFIG", filepath.Join(home, ".npmrc"))
+	t.Setenv("PIP_CONFIG_FILE", filepath.Join(home, "pip.conf"))
+	t.Setenv("AWS_PROFILE", "prd")
+
+	sessionFile := filepath.Join(home, "aws-session.json")
+	awsService := &AWSService{
+		credentialReader:         cr,
+		attemptCodeArtifactLogin: true,
+		sessionFilePath:          sessionFile,
+		activeCredentials:        &types.Credentials{AccessKeyId: "ASIA", SecretAccessKey: "secret", SessionToken: "token", Profile: "prd"},
+		apiClient:                aws_client.NewClient(aws_client.Config{CodeArtifactEndpoint: server.URL}),
+	}
+
+	results, err := awsService.LoginToCodeArtifact()
+	if err == nil {
+		t.Errorf("Expected an error for the unsupported cargo format")
+	}
+	if requests != 1 {
+		t.Errorf("Expected a single token request for the domain, got %d", requests)
+	}
+	if len(results) != 5 {
+		t.Fatalf("Expected a result per repository, got %d", len(results))
+	}
+	for _, result := range results {
+		if (result.Err != nil) != (result.Repository.Format == "cargo") {
+			t.Errorf("Unexpected result for %s: %v", result.Repository.Format, result.Err)
+		}
+	}
+
+	endpoint := "acme-123456789012.d.codeartifact.eu-west-2.amazonaws.com"
+
+	npmrc, _ := os.ReadFile(filepath.Join(home, ".npmrc"))
+	if !strings.Contains(string(npmrc), "@acme:registry=https://"+endpoint+"/npm/npm-store/\n") ||
+		!strings.Contains(string(npmrc), "//"+endpoint+"/npm/npm-store/:_authToken=ca-token") {
+		t.Errorf("Unexpected .npmrc:\n%s", npmrc)
+	}
+
+	pipConf, _ := os.ReadFile(filepath.Join(home, "pip.conf"))
+	if string(pipConf) != "[global]\nindex-url = https://aws:ca-token@"+endpoint+"/pypi/pypi-store/simple/\n" {
+		t.Errorf("Unexpected pip.conf:\n%s", pipConf)
+	}
+
+	settings, _ := os.ReadFile(filepath.Join(home, ".m2", "settings.xml"))
+	if !strings.Contains(string(settings), "<id>acme-maven-releases</id>") ||
+		!strings.Contains(string(settings), "<password>ca-token</password>") ||
+		!strings.Contains(string(settings), "<url>https://"+endpoint+"/maven/maven-releases/</url>") {
+		t.Errorf("Unexpected settings.xml:\n%s", settings)
+	}
+
+	var session types.SessionFile
+	raw, _ := os.ReadFile(sessionFile)
+	if err := json.Unmarshal(raw, &session); err != nil {
+		t.Fatalf("Failed to parse the session file: %v", err)
+	}
+	if session.Env["GOPROXY"] != "https://aws:ca-token@"+endpoint+"/go/go-proxy/,direct" {
+		t.Errorf("Unexpected GOPROXY '%s'", session.Env["GOPROXY"])
+	}
+	if session.Env["GONOSUMDB"] != "github.com/acme/*" {
+		t.Errorf("Unexpected GONOSUMDB '%s'", session.Env["GONOSUMDB"])
+	}
+}
+
+func TestWriteNpmrc(t *testing.T) {
+	endpoint := "https://acme.d.codeartifact.eu-west-2.amazonaws.com/npm/store/"
+	tokenLine := "//acme.d.codeartifact.eu-west-2.amazonaws.com/npm/store/:_authToken="
+
+	tests := []struct {
+		name           string
+		existing       string
+		scope          string
+		globalRegistry bool
+		expected       string
+	}{
+		{
+			name:     "only the token by default",
+			existing: "save-exact=true\nregistry=https://registry.npmjs.org/\n" + tokenLine + "old-token\n",
+			expected: "save-exact=true\nregistry=https://registry.npmjs.org/\n" + tokenLine + "new-token\n",
+		},
+		{
+			name:     "scoped registry",
+			existing: "registry=https://registry.npmjs.org/\n@acme:registry=https://old.example/\n",
+			scope:    "acme",
+			expected: "registry=https://registry.npmjs.org/\n@acme:registry=" + endpoint + "\n" + tokenLine + "new-token\n",
+		},
+		{
+			name:           "global registry keeps the user's registry as a comment",
+			existing:       "registry=https://registry.npmjs.org/\n",
+			globalRegistry: true,
+			expected:       "; replaced by aws-login: registry=https://registry.npmjs.org/\nregistry=" + endpoint + "\n" + tokenLine + "new-token\n",
+		},
+		{
+			name:           "global registry from an earlier login is replaced",
+			existing:       "; replaced by aws-login: registry=https://registry.npmjs.org/\nregistry=" + endpoint + "\n" + tokenLine + "old-token\n",
+			globalRegistry: true,
+			expected:       "; replaced by aws-login: registry=https://registry.npmjs.org/\nregistry=" + endpoint + "\n" + tokenLine + "new-token\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), ".npmrc")
+			if err := os.WriteFile(path, []byte(tt.existing), 0644); err != nil {
+				t.Fatalf("Failed to write .npmrc: %v", err)
+			}
+
+			if err := writeNpmrc(path, endpoint, "new-token", tt.scope, tt.globalRegistry); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			content, _ := os.ReadFile(path)
+			if string(content) != tt.expected {
+				t.Errorf("Expected:\n%s\ngot:\n%s", tt.expected, content)
+			}
+
+			info, _ := os.Stat(path)
+			if info.Mode().Perm() != 0600 {
+				t.Errorf("Expected mode 0600, got %o", info.Mode().Perm())
+			}
+		})
+	}
+}
+
+func TestWritePipConfig(t *testing.T) {
+	tests := []struct {
+		name     string
+		existing string
+		expected string
+	}{
+		{
+			name:     "new file",
+			expected: "[global]\nindex-url = https://new/simple/\n",
+		},
+		{
+			name:     "replaces index-url",
+			existing: "[global]\ntimeout = 60\nindex-url = https://old/simple/\n\n[install]\nuser = true\n",
+			expected: "[global]\ntimeout = 60\nindex-url = https://new/simple/\n\n[install]\nuser = true\n",
+		},
+		{
+			name:     "adds to an existing global section",
+			existing: "[global]\ntimeout = 60\n[install]\nuser = true\n",
+			expected: "[global]\ntimeout = 60\nindex-url = https://new/simple/\n[install]\nuser = true\n",
+		},
+		{
+			name:     "adds a global section",
+			existing: "[install]\nuser = true\n",
+			expected: "[install]\nuser = true\n[global]\nindex-url = https://new/simple/\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "pip.conf")
+			if tt.existing != "" {
+				if err := os.WriteFile(path, []byte(tt.existing), 0600); err != nil {
+					t.Fatalf("Failed to write pip.conf: %v", err)
+				}
+			}
+
+			if err := writePipConfig(path, "https://new/simple/"); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			content, _ := os.ReadFile(path)
+			if string(content) != tt.expected {
+				t.Errorf("Expected:\n%s\ngot:\n%s", tt.expected, content)
+			}
+		})
+	}
+}
+
+func TestWriteMavenSettings_UpdatesInPlace(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "settings.xml")
+	existing := `<settings>
+  <!-- keep me -->
+  <servers>
+    <server>
+      <id>nexus</id>
+    </server>
+  </servers>
+</settings>
+`
+	if err := os.WriteFile(path, []byte(existing), 0600); err != nil {
+		t.Fatalf("Failed to write settings.xml: %v", err)
+	}
+
+	for _, token := range []string{"first-token", "second-token"} {
+		if err := writeMavenSettings(path, "acme-releases", "https://acme/maven/releases/", token); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	content, _ := os.ReadFile(path)
+	settings := string(content)
+
+	if !strings.Contains(settings, "<!-- keep me -->") || !strings.Contains(settings, "<id>nexus</id>") {
+		t.Errorf("Expected existing content to be kept:\n%s", settings)
+	}
+	if strings.Contains(settings, "first-token") || strings.Count(settings, "<password>second-token</password>") != 1 {
+		t.Errorf("Expected the server to be replaced rather than duplicated:\n%s", settings)
+	}
+	if strings.Count(settings, "<profiles>") != 1 || strings.Count(settings, "<url>https://acme/maven/releases/</url>") != 1 {
+		t.Errorf("Expected a single profiles element with the repository:\n%s", settings)
+	}
+}
@@ -0,0 +1,98 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"runtime"
+	"strings"
+
+	"github.com/alexmk92/aws-login/core/aws_client"
+	"github.com/alexmk92/aws-login/core/types"
+)
+
+// ConsoleIssuer is shown by the console when the federated session expires
+const ConsoleIssuer = "aws-login"
+
+// ConsoleURL exchanges the active role session for a sign-in URL that logs the browser
+// in to the AWS console, so there's no need to go through MFA a second time.
+//
+// The destination may be a full console URL, a service path such as "s3" or
+// "ec2/home#Instances", or empty for the console home page.  When the destination
+// doesn't pick a region we use the profile's region.
+func (s *AWSService) ConsoleURL(destination string) (string, error) {
+	if s.activeCredentials == nil {
+		return "", fmt.Errorf("no active session, log in first")
+	}
+
+	// The federation endpoint only accepts role credentials
+	if s.assumedRoleArn == "" {
+		return "", fmt.Errorf("the console needs a role session, the MFA session for '%s' can't be federated (log in with --role)", s.sessionProfile)
+	}
+
+	signinToken, err := s.apiClient.GetSigninToken(context.Background(), *s.activeCredentials)
+	if err != nil {
+		return "", classifyError("failed to get console sign-in token", err)
+	}
+
+	region := s.regionFor(os.Getenv("AWS_PROFILE"), s.sessionProfile)
+
+	return s.apiClient.ConsoleLoginURL(signinToken, ConsoleIssuer, consoleDestination(destination, region)), nil
+}
+
+// CanOpenConsole reports whether the active session can be federated into the console
+func (s *AWSService) CanOpenConsole() bool {
+	return s.activeCredentials != nil && s.assumedRoleArn != ""
+}
+
+// consoleDestination resolves the destination against the console, adding the region
+// unless the destination already has one
+func consoleDestination(destination, region string) string {
+	destination = strings.TrimSpace(destination)
+	if strings.HasPrefix(destination, "https://") {
+		return destination
+	}
+
+	path := strings.TrimPrefix(destination, "/")
+	if path == "" {
+		path = "console/home"
+	}
+	target := aws_client.DefaultConsoleURL + path
+
+	if region == "" || strings.Contains(target, "region=") {
+		return target
+	}
+
+	// The fragment has to stay at the end, i.e. ec2/home?region=eu-west-2#Instances
+	base, fragment, hasFragment := strings.Cut(target, "#")
+	separator := "?"
+	if strings.Contains(base, "?") {
+		separator = "&"
+	}
+	target = base + separator + "region=" + url.QueryEscape(region)
+	if hasFragment {
+		target += "#" + fragment
+	}
+
+	return target
+}
+
+// OpenURL opens the URL in the default browser
+func (s *AWSService) OpenURL(target string) error {
+	var cmd types.Command
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = types.Command{Name: "open", Args: []string{target}}
+	case "windows":
+		cmd = types.Command{Name: "rundll32", Args: []string{"url.dll,FileProtocolHandler", target}}
+	default:
+		cmd = types.Command{Name: "xdg-open", Args: []string{target}}
+	}
+
+	if _, err := s.Runner().Run(cmd); err != nil {
+		return fmt.Errorf("failed to open the browser: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,90 @@
+package core
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/alexmk92/aws-login/core/aws_client"
+	"github.com/alexmk92/aws-login/core/types"
+)
+
+func TestConsoleDestination(t *testing.T) {
+	tests := []struct {
+		destination string
+		region      string
+		expected    string
+	}{
+		{"", "", "https://console.aws.amazon.com/console/home"},
+		{"", "eu-west-2", "https://console.aws.amazon.com/console/home?region=eu-west-2"},
+		{"s3", "eu-west-2", "https://console.aws.amazon.com/s3?region=eu-west-2"},
+		{"/ec2/home#Instances", "eu-west-2", "https://console.aws.amazon.com/ec2/home?region=eu-west-2#Instances"},
+		{"cloudwatch/home?region=us-east-1", "eu-west-2", "https://console.aws.amazon.com/cloudwatch/home?region=us-east-1"},
+		{"lambda/home?tab=code", "eu-west-2", "https://console.aws.amazon.com/lambda/home?tab=code&region=eu-west-2"},
+		{"https://eu-west-2.console.aws.amazon.com/rds/home", "us-east-1", "https://eu-west-2.console.aws.amazon.com/rds/home"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.destination, func(t *testing.T) {
+			if got := consoleDestination(tt.destination, tt.region); got != tt.expected {
+				t.Errorf("Expected '%s', got '%s'", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestAWSService_ConsoleURL(t *testing.T) {
+	cr := NewCredentialReader()
+	cr.clearCredentials()
+	err := cr.loadCredentialsFromContent(`[prd]
+aws_access_key_id = AKIAI44QH8DHBEXAMPLE
+aws_secret_access_key = je7MtGbClwBF/2Zp9Utk/h3yCo8nvbEXAMPLEKEY
+mfa_serial = arn:aws:iam::123456789012:mfa/prd-user
+region = eu-west-2`)
+	if err != nil {
+		t.Fatalf("Failed to load test credentials: %v", err)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"SigninToken":"signin-token"}`)
+	}))
+	defer server.Close()
+
+	t.Setenv("AWS_PROFILE", "prd")
+
+	awsService := &AWSService{
+		credentialReader:  cr,
+		sessionProfile:    "prd",
+		activeCredentials: &types.Credentials{AccessKeyId: "ASIA", SecretAccessKey: "secret", SessionToken: "token"},
+		apiClient:         aws_client.NewClient(aws_client.Config{SigninEndpoint: server.URL}),
+	}
+
+	// GetSessionToken credentials are rejected by the federation endpoint
+	if awsService.CanOpenConsole() {
+		t.Errorf("Expected the MFA session not to be able to open the console")
+	}
+	if _, err := awsService.ConsoleURL(""); err == nil || !strings.Contains(err.Error(), "--role") {
+		t.Errorf("Expected an error suggesting --role, got %v", err)
+	}
+
+	awsService.assumedRoleArn = "arn:aws:iam::123456789012:role/admin"
+	if !awsService.CanOpenConsole() {
+		t.Errorf("Expected the role session to be able to open the console")
+	}
+
+	consoleURL, err := awsService.ConsoleURL("s3")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	parsed, _ := url.Parse(consoleURL)
+	if parsed.Query().Get("SigninToken") != "signin-token" {
+		t.Errorf("Expected the sign-in token in the URL, got '%s'", consoleURL)
+	}
+	if parsed.Query().Get("Destination") != "https://console.aws.amazon.com/s3?region=eu-west-2" {
+		t.Errorf("Unexpected destination '%s'", parsed.Query().Get("Destination"))
+	}
+}
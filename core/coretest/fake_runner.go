@@ -0,0 +1,91 @@
+// Package coretest holds test doubles shared by the core packages' tests, nothing
+// in here should be imported by the binary.
+package coretest
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/alexmk92/aws-login/core/types"
+)
+
+// FakeRunner is a recording Runner for tests, it returns canned results for known
+// command lines and remembers every command it was asked to run.
+//
+//	runner := coretest.NewFakeRunner().
+//		On("op item get prd --otp", types.CommandResult{Stdout: "123456\n"}).
+//		On("docker login", types.CommandResult{Stderr: "denied", ExitCode: 1})
+//
+// Command lines are matched on the longest registered prefix, so "docker login"
+// matches regardless of which registry is passed.  Unknown commands behave like a
+// missing binary and exit with 127.
+type FakeRunner struct {
+	mu        sync.Mutex
+	responses map[string]types.CommandResult
+	Calls     []types.Command
+}
+
+var _ types.Runner = (*FakeRunner)(nil)
+
+// NewFakeRunner creates a fake runner with no canned results
+func NewFakeRunner() *FakeRunner {
+	return &FakeRunner{
+		responses: make(map[string]types.CommandResult),
+	}
+}
+
+// On registers the result for any command line starting with commandLine
+func (f *FakeRunner) On(commandLine string, result types.CommandResult) *FakeRunner {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.responses[commandLine] = result
+	return f
+}
+
+// Run records the command and returns the canned result, a non-zero exit code is
+// turned into an error just like core.ExecRunner does.
+func (f *FakeRunner) Run(cmd types.Command) (types.CommandResult, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.Calls = append(f.Calls, cmd)
+
+	commandLine := CommandLine(cmd)
+	match, found := "", false
+	for prefix := range f.responses {
+		if (commandLine == prefix || strings.HasPrefix(commandLine, prefix+" ")) && len(prefix) >= len(match) {
+			match, found = prefix, true
+		}
+	}
+
+	if !found {
+		result := types.CommandResult{Stderr: cmd.Name + ": command not found", ExitCode: 127}
+		return result, &types.CommandError{Command: cmd.Name, Result: result, Err: fmt.Errorf("exit status 127")}
+	}
+
+	result := f.responses[match]
+	if result.ExitCode != 0 {
+		return result, &types.CommandError{Command: cmd.Name, Result: result, Err: fmt.Errorf("exit status %d", result.ExitCode)}
+	}
+
+	return result, nil
+}
+
+// CommandLines returns every recorded command as a single string, handy for asserting order
+func (f *FakeRunner) CommandLines() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	lines := make([]string, len(f.Calls))
+	for i, cmd := range f.Calls {
+		lines[i] = CommandLine(cmd)
+	}
+	return lines
+}
+
+// CommandLine joins the command name and its arguments with spaces
+func CommandLine(cmd types.Command) string {
+	return strings.TrimSpace(cmd.Name + " " + strings.Join(cmd.Args, " "))
+}
@@ -0,0 +1,32 @@
+package coretest
+
+import (
+	"testing"
+
+	"github.com/alexmk92/aws-login/core/types"
+)
+
+func TestFakeRunner_Run(t *testing.T) {
+	runner := NewFakeRunner().
+		On("docker login", types.CommandResult{Stdout: "Login Succeeded"}).
+		On("docker login --username AWS bad.example.com", types.CommandResult{Stderr: "denied", ExitCode: 1})
+
+	result, err := runner.Run(types.Command{Name: "docker", Args: []string{"login", "--username", "AWS", "good.example.com"}})
+	if err != nil || result.Stdout != "Login Succeeded" {
+		t.Errorf("Expected the prefix match to succeed, got %v %v", result, err)
+	}
+
+	result, err = runner.Run(types.Command{Name: "docker", Args: []string{"login", "--username", "AWS", "bad.example.com"}})
+	if err == nil || result.Stderr != "denied" {
+		t.Errorf("Expected the longest prefix to win and fail, got %v %v", result, err)
+	}
+
+	result, err = runner.Run(types.Command{Name: "podman", Args: []string{"login"}})
+	if err == nil || result.ExitCode != 127 {
+		t.Errorf("Expected unknown commands to exit with 127, got %v %v", result, err)
+	}
+
+	if len(runner.CommandLines()) != 3 {
+		t.Errorf("Expected 3 recorded calls, got %v", runner.CommandLines())
+	}
+}
@@ -2,9 +2,14 @@ package core
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
 
@@ -13,8 +18,8 @@ import (
 
 // CredentialReader handles reading and parsing AWS credentials file
 type CredentialReader struct {
-	credentials      map[string]types.StaticCredential
-	roleArnToProfile map[string]string // Maps role ARN to profile name for quick lookup
+	credentials map[string]types.StaticCredential
+	ssoSessions map[string]types.SSOSession // [sso-session name] sections from the config files
 }
 
 // Make this a doOnce singleton
@@ -24,8 +29,8 @@ var credentialReaderOnce sync.Once
 func NewCredentialReader() *CredentialReader {
 	credentialReaderOnce.Do(func() {
 		credentialReaderInstance = &CredentialReader{
-			credentials:      make(map[string]types.StaticCredential),
-			roleArnToProfile: make(map[string]string),
+			credentials: make(map[string]types.StaticCredential),
+			ssoSessions: make(map[string]types.SSOSession),
 		}
 	})
 	return credentialReaderInstance
@@ -39,53 +44,155 @@ func GetCredentialReader() *CredentialReader {
 	return credentialReaderInstance
 }
 
-// LoadCredentialsFile loads and parses the AWS credentials file
-func (cr *CredentialReader) LoadCredentialsFile() error {
+// CredentialFiles lists the AWS files to load, when a profile appears in more than
+// one file the later file wins key by key.
+type CredentialFiles struct {
+	Credentials []string
+	Config      []string
+}
+
+// DefaultCredentialFiles resolves the standard AWS file locations, honouring the
+// AWS_SHARED_CREDENTIALS_FILE and AWS_CONFIG_FILE environment variables before
+// falling back to ~/.aws/credentials and ~/.aws/config.
+func DefaultCredentialFiles() (CredentialFiles, error) {
 	homeDir, err := os.UserHomeDir()
 	if err != nil {
-		return fmt.Errorf("failed to get home directory: %w", err)
+		return CredentialFiles{}, fmt.Errorf("failed to get home directory: %w", err)
 	}
 
 	credentialsPath := filepath.Join(homeDir, ".aws", "credentials")
-	file, err := os.Open(credentialsPath)
+	if envPath := os.Getenv("AWS_SHARED_CREDENTIALS_FILE"); envPath != "" {
+		credentialsPath = ExpandHome(envPath, homeDir)
+	}
+
+	configPath := filepath.Join(homeDir, ".aws", "config")
+	if envPath := os.Getenv("AWS_CONFIG_FILE"); envPath != "" {
+		configPath = ExpandHome(envPath, homeDir)
+	}
+
+	return CredentialFiles{
+		Credentials: []string{credentialsPath},
+		Config:      []string{configPath},
+	}, nil
+}
+
+// ExpandHome replaces a leading ~ with homeDir the same way the AWS CLI does for its
+// env variables
+func ExpandHome(path, homeDir string) string {
+	if path == "~" {
+		return homeDir
+	}
+
+	if rest, ok := strings.CutPrefix(path, "~/"); ok {
+		return filepath.Join(homeDir, rest)
+	}
+
+	return path
+}
+
+// LoadFiles loads every credentials file followed by every config file, the
+// config files are merged into the profiles read from the credentials files.
+//
+// Any of the files may be missing, IAM Identity Center users often only have a
+// config file and plenty of setups never create one.  It's only an error when
+// none of them exist or they don't define a single profile.
+func (cr *CredentialReader) LoadFiles(files CredentialFiles) error {
+	loaded := false
+
+	for _, path := range files.Credentials {
+		err := cr.loadFile(path, false)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to load credentials file %s: %w", path, err)
+		}
+		loaded = true
+	}
+
+	for _, path := range files.Config {
+		err := cr.loadFile(path, true)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to load config file %s: %w", path, err)
+		}
+		loaded = true
+	}
+
+	if !loaded {
+		return fmt.Errorf("no AWS credentials or config file found, looked for %s", strings.Join(slices.Concat(files.Credentials, files.Config), ", "))
+	}
+	if len(cr.credentials) == 0 {
+		return fmt.Errorf("no profiles found in %s", strings.Join(slices.Concat(files.Credentials, files.Config), ", "))
+	}
+
+	return nil
+}
+
+func (cr *CredentialReader) loadFile(path string, isConfig bool) error {
+	file, err := os.Open(path)
 	if err != nil {
-		return fmt.Errorf("failed to open credentials file: %w", err)
+		return err
 	}
 	defer file.Close()
 
-	scanner := bufio.NewScanner(file)
+	return cr.parse(file, isConfig)
+}
+
+// parse reads an ini formatted AWS file and merges every profile into the reader.
+//
+// The credentials file names sections [profile_name] whereas the config file uses
+// [profile profile_name] (except for [default]), anything else in the config file
+// such as [sso-session name] or [services name] isn't a profile and is skipped.
+func (cr *CredentialReader) parse(r io.Reader, isConfig bool) error {
+	scanner := bufio.NewScanner(r)
 	var currentProfile string
 	var currentCredential types.StaticCredential
+	var currentSSOSession *types.SSOSession
 
 	for scanner.Scan() {
 		line := strings.TrimSpace(scanner.Text())
 
 		// Skip empty lines and comments
-		if line == "" || strings.HasPrefix(line, "#") {
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
 			continue
 		}
 
 		// Check for profile header [profile_name]
 		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
-			// Save previous profile if it exists
+			// Save previous profile (or sso-session) if it exists
 			if currentProfile != "" {
 				cr.credentials[currentProfile] = currentCredential
-				// Add to role ARN lookup map if this profile has an assumable role
-				if currentCredential.AssumableRoleID != "" {
-					cr.roleArnToProfile[currentCredential.AssumableRoleID] = currentProfile
-				}
+			}
+			if currentSSOSession != nil {
+				cr.ssoSessions[currentSSOSession.Name] = *currentSSOSession
+				currentSSOSession = nil
+			}
+
+			section := strings.TrimSpace(strings.Trim(line, "[]"))
+			if name, ok := strings.CutPrefix(section, "sso-session "); ok && isConfig {
+				name = strings.TrimSpace(name)
+				session := cr.ssoSessions[name]
+				session.Name = name
+				currentSSOSession = &session
 			}
 
-			// Start new profile
-			currentProfile = strings.Trim(line, "[]")
-			currentCredential = types.StaticCredential{
-				ProfileName: currentProfile,
+			// Start new profile, merging into anything we've already read for it
+			currentProfile = sectionProfileName(section, isConfig)
+			if existing, exists := cr.credentials[currentProfile]; exists {
+				currentCredential = existing
+			} else {
+				currentCredential = types.StaticCredential{
+					ProfileName: currentProfile,
+				}
 			}
 			continue
 		}
 
 		// Parse key-value pairs
-		if currentProfile != "" && strings.Contains(line, "=") {
+		if (currentProfile != "" || currentSSOSession != nil) && strings.Contains(line, "=") {
 			parts := strings.SplitN(line, "=", 2)
 			if len(parts) == 2 {
 				key := strings.TrimSpace(parts[0])
@@ -96,56 +203,256 @@ func (cr *CredentialReader) LoadCredentialsFile() error {
 					continue
 				}
 
-				switch key {
-				case "aws_access_key_id":
-					currentCredential.AccessKey = value
-				case "aws_secret_access_key":
-					currentCredential.AccessSecret = value
-				case "account_id", "aws_account_id":
-					currentCredential.AccountID = value
-				case "mfa_serial":
-					currentCredential.MfaSerial = value
-				case "assumable_role_id":
-					currentCredential.AssumableRoleID = value
-				case "vault_key":
-					currentCredential.VaultKey = value
+				if currentSSOSession != nil {
+					applySSOSessionKey(currentSSOSession, key, value)
+					continue
 				}
+
+				applyCredentialKey(&currentCredential, key, value)
 			}
 		}
 	}
 
-	// Save the last profile
+	// Save the last profile (or sso-session)
 	if currentProfile != "" {
 		cr.credentials[currentProfile] = currentCredential
-		// Add to role ARN lookup map if this profile has an assumable role
-		if currentCredential.AssumableRoleID != "" {
-			cr.roleArnToProfile[currentCredential.AssumableRoleID] = currentProfile
+	}
+	if currentSSOSession != nil {
+		cr.ssoSessions[currentSSOSession.Name] = *currentSSOSession
+	}
+
+	return scanner.Err()
+}
+
+// sectionProfileName returns the profile a section header refers to, or an empty
+// string when the section is not a profile.
+func sectionProfileName(section string, isConfig bool) string {
+	if !isConfig || section == "default" {
+		return section
+	}
+
+	if name, ok := strings.CutPrefix(section, "profile "); ok {
+		return strings.TrimSpace(name)
+	}
+
+	return ""
+}
+
+// applyCredentialKey sets the field matching key, unknown keys are ignored so that
+// settings only the AWS CLI understands don't break parsing.
+func applyCredentialKey(credential *types.StaticCredential, key, value string) {
+	switch key {
+	case "aws_access_key_id":
+		credential.AccessKey = value
+	case "aws_secret_access_key":
+		credential.AccessSecret = value
+	case "account_id", "aws_account_id":
+		credential.AccountID = value
+	case "mfa_serial":
+		credential.MfaSerial = value
+	case "assumable_role_id", "role_arn":
+		credential.AssumableRoleID = value
+	case "vault_key":
+		credential.VaultKey = value
+	case "keepassxc_database":
+		credential.KeePassXCDatabase = value
+	case "source_profile":
+		credential.SourceProfile = value
+	case "assumable_roles":
+		credential.AssumableRoles = nil
+		for _, pattern := range strings.Split(value, ",") {
+			if pattern = strings.TrimSpace(pattern); pattern != "" {
+				credential.AssumableRoles = append(credential.AssumableRoles, pattern)
+			}
+		}
+	case "region":
+		credential.Region = value
+	case "duration_seconds":
+		if seconds, err := strconv.Atoi(value); err == nil {
+			credential.DurationSeconds = seconds
+		}
+	case "session_duration_seconds":
+		if seconds, err := strconv.Atoi(value); err == nil {
+			credential.SessionDurationSeconds = seconds
+		}
+	case "external_id":
+		credential.ExternalID = value
+	case "role_session_name":
+		credential.RoleSessionName = value
+	case "source_identity":
+		credential.SourceIdentity = value
+	case "session_tags":
+		credential.SessionTags = ParseSessionTags(value)
+	case "ecr_registries":
+		credential.ECRRegistries = ParseECRRegistries(value)
+	case "codeartifact_repositories":
+		credential.CodeArtifactRepositories = ParseCodeArtifactRepositories(value)
+	case "codeartifact_domain_owner":
+		credential.CodeArtifactDomainOwner = value
+	case "codeartifact_region":
+		credential.CodeArtifactRegion = value
+	case "codeartifact_go_nosumdb":
+		credential.CodeArtifactGoNoSumDB = value
+	case "codeartifact_npm_scope":
+		credential.CodeArtifactNpmScope = value
+	case "codeartifact_npm_global_registry":
+		credential.CodeArtifactNpmGlobalRegistry, _ = strconv.ParseBool(value)
+	case "sso_session":
+		credential.SSOSession = value
+	case "sso_start_url":
+		credential.SSOStartURL = value
+	case "sso_region":
+		credential.SSORegion = value
+	case "sso_account_id":
+		credential.SSOAccountID = value
+	case "sso_role_name":
+		credential.SSORoleName = value
+	case "eks_clusters":
+		credential.EKSClusters = ParseEKSClusters(value)
+	case "ecr_login_targets":
+		// Unknown targets are reported when we try to log in to them, failing
+		// to parse the whole file over a typo would be far more disruptive
+		for _, target := range strings.Split(value, ",") {
+			if target = strings.ToLower(strings.TrimSpace(target)); target != "" {
+				credential.ECRTargets = append(credential.ECRTargets, target)
+			}
 		}
 	}
+}
 
-	if err := scanner.Err(); err != nil {
-		return fmt.Errorf("error reading credentials file: %w", err)
+// applySSOSessionKey sets the field matching key on an [sso-session] section
+func applySSOSessionKey(session *types.SSOSession, key, value string) {
+	switch key {
+	case "sso_start_url":
+		session.StartURL = value
+	case "sso_region":
+		session.Region = value
+	case "sso_registration_scopes":
+		session.RegistrationScopes = nil
+		for _, scope := range strings.Split(value, ",") {
+			if scope = strings.TrimSpace(scope); scope != "" {
+				session.RegistrationScopes = append(session.RegistrationScopes, scope)
+			}
+		}
 	}
+}
 
-	return nil
+// ParseCodeArtifactRepositories parses a comma separated list of FORMAT:DOMAIN/REPOSITORY
+// entries, i.e. npm:acme/npm-store.  Malformed entries are ignored.
+func ParseCodeArtifactRepositories(value string) []types.CodeArtifactRepository {
+	var repositories []types.CodeArtifactRepository
+	for _, entry := range strings.Split(value, ",") {
+		format, path, ok := strings.Cut(strings.TrimSpace(entry), ":")
+		if !ok {
+			continue
+		}
+
+		domain, repository, ok := strings.Cut(path, "/")
+		if !ok || format == "" || domain == "" || repository == "" {
+			continue
+		}
+
+		repositories = append(repositories, types.CodeArtifactRepository{
+			Format:     strings.ToLower(format),
+			Domain:     domain,
+			Repository: repository,
+		})
+	}
+
+	return repositories
+}
+
+// ParseEKSClusters parses a comma separated list of cluster names, each optionally
+// followed by :REGION when the cluster isn't in the profile's region
+func ParseEKSClusters(value string) []types.EKSCluster {
+	var clusters []types.EKSCluster
+	for _, entry := range strings.Split(value, ",") {
+		name, region, _ := strings.Cut(strings.TrimSpace(entry), ":")
+		if name = strings.TrimSpace(name); name == "" {
+			continue
+		}
+		clusters = append(clusters, types.EKSCluster{Name: name, Region: strings.TrimSpace(region)})
+	}
+
+	return clusters
+}
+
+// ParseECRRegistries parses a comma separated list of ACCOUNT:REGION pairs, full
+// registry hostnames (ACCOUNT.dkr.ecr.REGION.amazonaws.com) are accepted too so the
+// value can be copied straight from an image URI.  Malformed entries are ignored.
+func ParseECRRegistries(value string) []types.ECRRegistry {
+	var registries []types.ECRRegistry
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+
+		if accountID, region, ok := strings.Cut(entry, ":"); ok && accountID != "" && region != "" {
+			registries = append(registries, types.ECRRegistry{AccountID: accountID, Region: region})
+			continue
+		}
+
+		// 123456789012.dkr.ecr.us-east-1.amazonaws.com
+		parts := strings.Split(entry, ".")
+		if len(parts) >= 5 && parts[1] == "dkr" && parts[2] == "ecr" {
+			registries = append(registries, types.ECRRegistry{AccountID: parts[0], Region: parts[3]})
+		}
+	}
+
+	return registries
+}
+
+// ParseSessionTags parses a comma separated list of Key=Value pairs, entries without
+// an = are ignored
+func ParseSessionTags(value string) map[string]string {
+	tags := make(map[string]string)
+	for _, pair := range strings.Split(value, ",") {
+		key, tagValue, ok := strings.Cut(pair, "=")
+		if !ok || strings.TrimSpace(key) == "" {
+			continue
+		}
+		tags[strings.TrimSpace(key)] = strings.TrimSpace(tagValue)
+	}
+
+	return tags
 }
 
 // Returns a list of all profile names that we can attempt to assume a role
 // for.  If we only define the vault key or role arn, then we don't want
 // to include is as an authable entity.  It could however still be consumed
 // by another profile (such as prd acting as int via an assumable role)
+//
+// IAM Identity Center profiles log in through the browser instead, so they are
+// valid without any keys.
 func (cr *CredentialReader) GetValidProfiles() []string {
 	profiles := make([]string, 0, len(cr.credentials))
 
 	for profile, credential := range cr.credentials {
 		if credential.AccessKey != "" && credential.AccessSecret != "" && credential.MfaSerial != "" {
 			profiles = append(profiles, profile)
+		} else if credential.UsesSSO() {
+			profiles = append(profiles, profile)
 		}
 	}
 
 	return profiles
 }
 
+// GetProfileNames returns every profile name (valid or not) in alphabetical order
+func (cr *CredentialReader) GetProfileNames() []string {
+	profiles := make([]string, 0, len(cr.credentials))
+	for profile := range cr.credentials {
+		profiles = append(profiles, profile)
+	}
+	sort.Strings(profiles)
+
+	return profiles
+}
+
+// GetSSOSession returns the [sso-session name] section
+func (cr *CredentialReader) GetSSOSession(name string) (types.SSOSession, bool) {
+	session, exists := cr.ssoSessions[name]
+	return session, exists
+}
+
 // GetCredential returns the credential for a specific profile
 func (cr *CredentialReader) GetCredential(profile string) (types.StaticCredential, bool) {
 	credential, exists := cr.credentials[profile]
@@ -154,25 +461,103 @@ func (cr *CredentialReader) GetCredential(profile string) (types.StaticCredentia
 
 // GetAssumableRoles returns the list of roles that can be assumed for a profile
 // This now returns all profiles that have an assumable_role_id (except the current profile)
-func (cr *CredentialReader) GetAssumableRoles(profile string) []string {
-	var assumableRoles []string
+// that the profile's assumable_roles allows.
+//
+// Several profiles may declare the same role (i.e. with a different region or session
+// name), so each entry is identified by its profile and they are ordered by profile name.
+func (cr *CredentialReader) GetAssumableRoles(profile string) []types.AssumableRole {
+	var assumableRoles []types.AssumableRole
 
-	for profileName, credential := range cr.credentials {
+	for _, profileName := range cr.GetProfileNames() {
 		// Skip the current profile - it can't assume itself
 		if profileName == profile {
 			continue
 		}
 
 		// Only include profiles that have an assumable_role_id
-		if credential.AssumableRoleID != "" {
-			assumableRoles = append(assumableRoles, credential.AssumableRoleID)
+		credential := cr.credentials[profileName]
+		if credential.AssumableRoleID == "" {
+			continue
+		}
+
+		role := NewAssumableRole(profileName, credential.AssumableRoleID)
+		if cr.IsRoleAllowed(profile, role) {
+			assumableRoles = append(assumableRoles, role)
 		}
 	}
 
 	return assumableRoles
 }
 
-// GetProfileByRoleArn returns the profile name that has the given assumable_role_id
-func (cr *CredentialReader) GetProfileByRoleArn(roleArn string) string {
-	return cr.roleArnToProfile[roleArn]
+// IsRoleAllowed reports whether the profile's assumable_roles allows the role, every
+// role is allowed when the profile doesn't set it.  Each entry is a glob (* and ?)
+// matched against the role's profile name, ARN and account ID, so `int`, `stg-*`,
+// `arn:aws:iam::*:role/ReadOnly` and `123456789012` are all valid entries.
+func (cr *CredentialReader) IsRoleAllowed(profile string, role types.AssumableRole) bool {
+	credential, exists := cr.credentials[profile]
+	if !exists || len(credential.AssumableRoles) == 0 {
+		return true
+	}
+
+	for _, pattern := range credential.AssumableRoles {
+		for _, value := range []string{role.Profile, role.Arn, role.AccountID} {
+			if value != "" && matchGlob(pattern, value) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// matchGlob matches value against a pattern where * matches any run of characters
+// (including the / in role paths, unlike path.Match) and ? matches a single one
+func matchGlob(pattern, value string) bool {
+	if pattern == "" {
+		return value == ""
+	}
+
+	switch pattern[0] {
+	case '*':
+		for i := 0; i <= len(value); i++ {
+			if matchGlob(pattern[1:], value[i:]) {
+				return true
+			}
+		}
+		return false
+	case '?':
+		return value != "" && matchGlob(pattern[1:], value[1:])
+	default:
+		return value != "" && value[0] == pattern[0] && matchGlob(pattern[1:], value[1:])
+	}
+}
+
+// ProfilesForRoleArn returns every profile that declares the role, in alphabetical order
+func (cr *CredentialReader) ProfilesForRoleArn(roleArn string) []string {
+	var profiles []string
+	if roleArn == "" {
+		return profiles
+	}
+
+	for _, profile := range cr.GetProfileNames() {
+		if cr.credentials[profile].AssumableRoleID == roleArn {
+			profiles = append(profiles, profile)
+		}
+	}
+
+	return profiles
+}
+
+// NewAssumableRole describes the role declared by a profile, the account and role name
+// are taken from the ARN (arn:aws:iam::ACCOUNT_ID:role/PATH/NAME)
+func NewAssumableRole(profile, roleArn string) types.AssumableRole {
+	role := types.AssumableRole{Arn: roleArn, Profile: profile, DisplayName: roleArn}
+
+	parts := strings.SplitN(roleArn, ":", 6)
+	if len(parts) == 6 {
+		role.AccountID = parts[4]
+		role.DisplayName = parts[5][strings.LastIndex(parts[5], "/")+1:]
+	}
+
+	return role
 }
@@ -4,6 +4,7 @@
 package core
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
@@ -71,7 +72,7 @@ aws_secret_access_key = je7MtGbClwBF/2Zp9Utk/h3yCo8nvbEXAMPLEKEY`,
 			name:               "empty credentials file",
 			credentialsContent: ``,
 			expectedProfiles:   []string{},
-			expectedError:      false,
+			expectedError:      true,
 		},
 	}
 
@@ -86,15 +87,13 @@ aws_secret_access_key = je7MtGbClwBF/2Zp9Utk/h3yCo8nvbEXAMPLEKEY`,
 				t.Fatalf("Failed to create test credentials file: %v", err)
 			}
 
-			// Create credential reader and override the credentials path
+			// Create credential reader and load the temporary credentials file
 			cr := NewCredentialReader()
 
 			// Clear any existing credentials from previous tests
 			cr.clearCredentials()
 
-			// We need to modify the LoadCredentialsFile method to accept a custom path
-			// For now, let's test the public methods with a mock setup
-			err = cr.loadCredentialsFromContent(tt.credentialsContent)
+			err = cr.LoadFiles(CredentialFiles{Credentials: []string{credentialsPath}})
 
 			if tt.expectedError && err == nil {
 				t.Errorf("Expected error but got none")
@@ -262,77 +261,17 @@ aws_secret_access_key = je7MtGbClwBF/2Zp9Utk/h3yCo8nvbEXAMPLEKEY2`
 // Helper method to clear credentials for testing
 func (cr *CredentialReader) clearCredentials() {
 	cr.credentials = make(map[string]types.StaticCredential)
-	cr.roleArnToProfile = make(map[string]string)
+	cr.ssoSessions = make(map[string]types.SSOSession)
 }
 
 // Helper method to load credentials from content for testing
 func (cr *CredentialReader) loadCredentialsFromContent(content string) error {
-	lines := strings.Split(content, "\n")
-	var currentProfile string
-	var currentCredential types.StaticCredential
-
-	for _, line := range lines {
-		line = strings.TrimSpace(line)
-
-		// Skip empty lines and comments
-		if line == "" || strings.HasPrefix(line, "#") {
-			continue
-		}
-
-		// Check for profile header [profile_name]
-		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
-			// Save previous profile if it exists
-			if currentProfile != "" {
-				cr.credentials[currentProfile] = currentCredential
-				// Add to role ARN lookup map if this profile has an assumable role
-				if currentCredential.AssumableRoleID != "" {
-					cr.roleArnToProfile[currentCredential.AssumableRoleID] = currentProfile
-				}
-			}
-
-			// Start new profile
-			currentProfile = strings.Trim(line, "[]")
-			currentCredential = types.StaticCredential{
-				ProfileName: currentProfile,
-			}
-			continue
-		}
-
-		// Parse key-value pairs
-		if currentProfile != "" && strings.Contains(line, "=") {
-			parts := strings.SplitN(line, "=", 2)
-			if len(parts) == 2 {
-				key := strings.TrimSpace(parts[0])
-				value := strings.TrimSpace(parts[1])
-
-				switch key {
-				case "aws_access_key_id":
-					currentCredential.AccessKey = value
-				case "aws_secret_access_key":
-					currentCredential.AccessSecret = value
-				case "account_id", "aws_account_id":
-					currentCredential.AccountID = value
-				case "mfa_serial":
-					currentCredential.MfaSerial = value
-				case "assumable_role_id":
-					currentCredential.AssumableRoleID = value
-				case "vault_key":
-					currentCredential.VaultKey = value
-				}
-			}
-		}
-	}
-
-	// Save the last profile
-	if currentProfile != "" {
-		cr.credentials[currentProfile] = currentCredential
-		// Add to role ARN lookup map if this profile has an assumable role
-		if currentCredential.AssumableRoleID != "" {
-			cr.roleArnToProfile[currentCredential.AssumableRoleID] = currentProfile
-		}
-	}
+	return cr.parse(strings.NewReader(content), false)
+}
 
-	return nil
+// Helper method to load config from content for testing
+func (cr *CredentialReader) loadConfigFromContent(content string) error {
+	return cr.parse(strings.NewReader(content), true)
 }
 
 func TestCredentialReader_GetAssumableRoles(t *testing.T) {
@@ -432,7 +371,7 @@ assumable_role_id = arn:aws:iam::555555555555:role/OrganizationAccountAccessRole
 			for _, expectedRole := range tt.expectedRoles {
 				found := false
 				for _, actualRole := range roles {
-					if actualRole == expectedRole {
+					if actualRole.Arn == expectedRole {
 						found = true
 						break
 					}
@@ -447,7 +386,7 @@ assumable_role_id = arn:aws:iam::555555555555:role/OrganizationAccountAccessRole
 				cred, exists := cr.GetCredential(tt.profile)
 				if exists && cred.AssumableRoleID != "" {
 					for _, role := range roles {
-						if role == cred.AssumableRoleID {
+						if role.Arn == cred.AssumableRoleID {
 							t.Errorf("Profile '%s' should not be able to assume its own role '%s'", tt.profile, cred.AssumableRoleID)
 						}
 					}
@@ -457,7 +396,157 @@ assumable_role_id = arn:aws:iam::555555555555:role/OrganizationAccountAccessRole
 	}
 }
 
-func TestCredentialReader_GetProfileByRoleArn(t *testing.T) {
+func TestCredentialReader_GetAssumableRoles_SharedRoleArn(t *testing.T) {
+	cr := NewCredentialReader()
+	cr.clearCredentials()
+	err := cr.loadCredentialsFromContent(`[prd]
+aws_access_key_id = AKIAI44QH8DHBEXAMPLE
+aws_secret_access_key = je7MtGbClwBF/2Zp9Utk/h3yCo8nvbEXAMPLEKEY
+mfa_serial = arn:aws:iam::123456789012:mfa/prd-user
+
+[int-us]
+assumable_role_id = arn:aws:iam::987654321098:role/ops/OrganizationAccountAccessRole
+region = us-east-1
+
+[int-eu]
+assumable_role_id = arn:aws:iam::987654321098:role/ops/OrganizationAccountAccessRole
+region = eu-west-2`)
+	if err != nil {
+		t.Fatalf("Failed to load test credentials: %v", err)
+	}
+
+	// Both profiles are listed, in order, rather than one silently winning
+	roles := cr.GetAssumableRoles("prd")
+	expected := []types.AssumableRole{
+		{
+			Arn:         "arn:aws:iam::987654321098:role/ops/OrganizationAccountAccessRole",
+			Profile:     "int-eu",
+			AccountID:   "987654321098",
+			DisplayName: "OrganizationAccountAccessRole",
+		},
+		{
+			Arn:         "arn:aws:iam::987654321098:role/ops/OrganizationAccountAccessRole",
+			Profile:     "int-us",
+			AccountID:   "987654321098",
+			DisplayName: "OrganizationAccountAccessRole",
+		},
+	}
+	if len(roles) != len(expected) {
+		t.Fatalf("Expected %d roles, got %+v", len(expected), roles)
+	}
+	for i := range expected {
+		if roles[i] != expected[i] {
+			t.Errorf("Expected %+v, got %+v", expected[i], roles[i])
+		}
+	}
+}
+
+func TestCredentialReader_GetAssumableRoles_AllowList(t *testing.T) {
+	cr := NewCredentialReader()
+	cr.clearCredentials()
+	err := cr.loadCredentialsFromContent(`[work]
+aws_access_key_id = AKIAI44QH8DHBEXAMPLE
+aws_secret_access_key = je7MtGbClwBF/2Zp9Utk/h3yCo8nvbEXAMPLEKEY
+mfa_serial = arn:aws:iam::123456789012:mfa/work-user
+
+[personal]
+aws_access_key_id = AKIAI44QH8DHBEXAMPLE2
+aws_secret_access_key = je7MtGbClwBF/2Zp9Utk/h3yCo8nvbEXAMPLEKEY2
+mfa_serial = arn:aws:iam::999999999999:mfa/me
+assumable_roles = sandbox, stg-*, arn:aws:iam::*:role/ops/ReadOnly
+
+[sandbox]
+assumable_role_id = arn:aws:iam::999999999998:role/Admin
+
+[stg-eu]
+assumable_role_id = arn:aws:iam::222222222222:role/Admin
+
+[prd]
+assumable_role_id = arn:aws:iam::333333333333:role/Admin
+
+[prd-readonly]
+assumable_role_id = arn:aws:iam::333333333333:role/ops/ReadOnly
+
+[accounts]
+aws_access_key_id = AKIAI44QH8DHBEXAMPLE3
+aws_secret_access_key = je7MtGbClwBF/2Zp9Utk/h3yCo8nvbEXAMPLEKEY3
+mfa_serial = arn:aws:iam::444444444444:mfa/me
+assumable_roles = 333333333333`)
+	if err != nil {
+		t.Fatalf("Failed to load test credentials: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		profile  string
+		expected []string
+	}{
+		{
+			name:     "no allow-list offers every role",
+			profile:  "work",
+			expected: []string{"prd", "prd-readonly", "sandbox", "stg-eu"},
+		},
+		{
+			name:     "profile names, globs and role ARNs",
+			profile:  "personal",
+			expected: []string{"prd-readonly", "sandbox", "stg-eu"},
+		},
+		{
+			name:     "account ID",
+			profile:  "accounts",
+			expected: []string{"prd", "prd-readonly"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var profiles []string
+			for _, role := range cr.GetAssumableRoles(tt.profile) {
+				profiles = append(profiles, role.Profile)
+			}
+			if strings.Join(profiles, ",") != strings.Join(tt.expected, ",") {
+				t.Errorf("Expected roles %v, got %v", tt.expected, profiles)
+			}
+		})
+	}
+
+	// --role is held to the same allow-list
+	awsService := &AWSService{credentialReader: cr}
+	if _, err := awsService.ResolveAssumableRole("personal", "prd"); err == nil || !strings.Contains(err.Error(), "assumable_roles") {
+		t.Errorf("Expected prd to be rejected for personal, got %v", err)
+	}
+	if _, err := awsService.ResolveAssumableRole("personal", "arn:aws:iam::333333333333:role/Admin"); err == nil {
+		t.Errorf("Expected the prd role ARN to be rejected for personal")
+	}
+	if role, err := awsService.ResolveAssumableRole("personal", "stg-eu"); err != nil || role.Profile != "stg-eu" {
+		t.Errorf("Expected stg-eu to be allowed for personal, got %+v, %v", role, err)
+	}
+}
+
+func TestMatchGlob(t *testing.T) {
+	tests := []struct {
+		pattern string
+		value   string
+		matches bool
+	}{
+		{"int", "int", true},
+		{"int", "int-us", false},
+		{"stg-*", "stg-eu", true},
+		{"stg-*", "stg-", true},
+		{"*", "", true},
+		{"arn:aws:iam::*:role/*", "arn:aws:iam::123456789012:role/ops/Admin", true},
+		{"12345678901?", "123456789012", true},
+		{"12345678901?", "12345678901", false},
+	}
+
+	for _, tt := range tests {
+		if matchGlob(tt.pattern, tt.value) != tt.matches {
+			t.Errorf("Expected matchGlob(%q, %q) to be %v", tt.pattern, tt.value, tt.matches)
+		}
+	}
+}
+
+func TestCredentialReader_ProfilesForRoleArn(t *testing.T) {
 	cr := NewCredentialReader()
 
 	credentialsContent := `[prd]
@@ -470,6 +559,10 @@ aws_access_key_id = AKIAI44QH8DHBEXAMPLE2
 aws_secret_access_key = je7MtGbClwBF/2Zp9Utk/h3yCo8nvbEXAMPLEKEY2
 assumable_role_id = arn:aws:iam::987654321098:role/OrganizationAccountAccessRole
 
+[int-us]
+assumable_role_id = arn:aws:iam::987654321098:role/OrganizationAccountAccessRole
+region = us-east-1
+
 [dev]
 aws_access_key_id = AKIAI44QH8DHBEXAMPLE3
 aws_secret_access_key = je7MtGbClwBF/2Zp9Utk/h3yCo8nvbEXAMPLEKEY3
@@ -483,37 +576,35 @@ aws_secret_access_key = je7MtGbClwBF/2Zp9Utk/h3yCo8nvbEXAMPLEKEY3
 	}
 
 	tests := []struct {
-		name            string
-		roleArn         string
-		expectedProfile string
+		name             string
+		roleArn          string
+		expectedProfiles []string
 	}{
 		{
-			name:            "valid role ARN for prd profile",
-			roleArn:         "arn:aws:iam::123456789012:role/OrganizationAccountAccessRole",
-			expectedProfile: "prd",
+			name:             "valid role ARN for prd profile",
+			roleArn:          "arn:aws:iam::123456789012:role/OrganizationAccountAccessRole",
+			expectedProfiles: []string{"prd"},
 		},
 		{
-			name:            "valid role ARN for int profile",
-			roleArn:         "arn:aws:iam::987654321098:role/OrganizationAccountAccessRole",
-			expectedProfile: "int",
+			name:             "role ARN shared by int profiles",
+			roleArn:          "arn:aws:iam::987654321098:role/OrganizationAccountAccessRole",
+			expectedProfiles: []string{"int", "int-us"},
 		},
 		{
-			name:            "nonexistent role ARN",
-			roleArn:         "arn:aws:iam::999999999999:role/NonexistentRole",
-			expectedProfile: "",
+			name:    "nonexistent role ARN",
+			roleArn: "arn:aws:iam::999999999999:role/NonexistentRole",
 		},
 		{
-			name:            "empty role ARN",
-			roleArn:         "",
-			expectedProfile: "",
+			name:    "empty role ARN",
+			roleArn: "",
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			profile := cr.GetProfileByRoleArn(tt.roleArn)
-			if profile != tt.expectedProfile {
-				t.Errorf("Expected profile '%s', got '%s'", tt.expectedProfile, profile)
+			profiles := cr.ProfilesForRoleArn(tt.roleArn)
+			if strings.Join(profiles, ",") != strings.Join(tt.expectedProfiles, ",") {
+				t.Errorf("Expected profiles %v, got %v", tt.expectedProfiles, profiles)
 			}
 		})
 	}
@@ -569,19 +660,19 @@ aws_secret_access_key = je7MtGbClwBF/2Zp9Utk/h3yCo8nvbEXAMPLEKEY3
 		t.Errorf("Expected empty assumable_role_id, got '%s'", cred3.AssumableRoleID)
 	}
 
-	// Test that role ARN lookup map is correctly populated
-	profile1 := cr.GetProfileByRoleArn("arn:aws:iam::123456789012:role/TestRole")
-	if profile1 != "test-profile" {
-		t.Errorf("Expected profile 'test-profile', got '%s'", profile1)
+	// Test that role ARN lookups find the declaring profile
+	profiles1 := cr.ProfilesForRoleArn("arn:aws:iam::123456789012:role/TestRole")
+	if len(profiles1) != 1 || profiles1[0] != "test-profile" {
+		t.Errorf("Expected profile 'test-profile', got %v", profiles1)
 	}
 
-	profile2 := cr.GetProfileByRoleArn("arn:aws:iam::987654321098:role/AnotherRole")
-	if profile2 != "test-profile-2" {
-		t.Errorf("Expected profile 'test-profile-2', got '%s'", profile2)
+	profiles2 := cr.ProfilesForRoleArn("arn:aws:iam::987654321098:role/AnotherRole")
+	if len(profiles2) != 1 || profiles2[0] != "test-profile-2" {
+		t.Errorf("Expected profile 'test-profile-2', got %v", profiles2)
 	}
 }
 
-func TestAWSService_GetAssumedProfileName(t *testing.T) {
+func TestAWSService_ResolveAssumableRole(t *testing.T) {
 	// Create a mock credential reader
 	cr := NewCredentialReader()
 
@@ -594,7 +685,11 @@ assumable_role_id = arn:aws:iam::123456789012:role/OrganizationAccountAccessRole
 [int]
 aws_access_key_id = AKIAI44QH8DHBEXAMPLE2
 aws_secret_access_key = je7MtGbClwBF/2Zp9Utk/h3yCo8nvbEXAMPLEKEY2
-assumable_role_id = arn:aws:iam::987654321098:role/OrganizationAccountAccessRole`
+assumable_role_id = arn:aws:iam::987654321098:role/OrganizationAccountAccessRole
+
+[int-us]
+assumable_role_id = arn:aws:iam::987654321098:role/OrganizationAccountAccessRole
+region = us-east-1`
 
 	// Clear any existing credentials from previous tests
 	cr.clearCredentials()
@@ -610,49 +705,346 @@ assumable_role_id = arn:aws:iam::987654321098:role/OrganizationAccountAccessRole
 
 	tests := []struct {
 		name            string
-		roleArn         string
+		role            string
+		expectedArn     string
 		expectedProfile string
 	}{
 		{
 			name:            "valid role ARN for prd profile",
-			roleArn:         "arn:aws:iam::123456789012:role/OrganizationAccountAccessRole",
+			role:            "arn:aws:iam::123456789012:role/OrganizationAccountAccessRole",
+			expectedArn:     "arn:aws:iam::123456789012:role/OrganizationAccountAccessRole",
 			expectedProfile: "prd",
 		},
 		{
-			name:            "valid role ARN for int profile",
-			roleArn:         "arn:aws:iam::987654321098:role/OrganizationAccountAccessRole",
-			expectedProfile: "int",
+			name:            "role ARN shared by several profiles",
+			role:            "arn:aws:iam::987654321098:role/OrganizationAccountAccessRole",
+			expectedArn:     "arn:aws:iam::987654321098:role/OrganizationAccountAccessRole",
+			expectedProfile: "",
+		},
+		{
+			name:            "profile sharing a role ARN",
+			role:            "int-us",
+			expectedArn:     "arn:aws:iam::987654321098:role/OrganizationAccountAccessRole",
+			expectedProfile: "int-us",
 		},
 		{
 			name:            "nonexistent role ARN",
-			roleArn:         "arn:aws:iam::999999999999:role/NonexistentRole",
+			role:            "arn:aws:iam::999999999999:role/NonexistentRole",
+			expectedArn:     "arn:aws:iam::999999999999:role/NonexistentRole",
 			expectedProfile: "",
 		},
 		{
-			name:            "empty role ARN",
-			roleArn:         "",
+			name:            "empty role",
+			role:            "",
+			expectedArn:     "",
 			expectedProfile: "",
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			profile := awsService.GetAssumedProfileName(tt.roleArn)
-			if profile != tt.expectedProfile {
-				t.Errorf("Expected profile '%s', got '%s'", tt.expectedProfile, profile)
+			role, err := awsService.ResolveAssumableRole("prd", tt.role)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if role.Arn != tt.expectedArn {
+				t.Errorf("Expected ARN '%s', got '%s'", tt.expectedArn, role.Arn)
+			}
+			if role.Profile != tt.expectedProfile {
+				t.Errorf("Expected profile '%s', got '%s'", tt.expectedProfile, role.Profile)
 			}
 		})
 	}
 }
 
-func TestAWSService_GetAssumedProfileName_NilCredentialReader(t *testing.T) {
+func TestAWSService_ResolveAssumableRole_NilCredentialReader(t *testing.T) {
 	// Create AWS service with nil credential reader
 	awsService := &AWSService{
 		credentialReader: nil,
 	}
 
-	profile := awsService.GetAssumedProfileName("arn:aws:iam::123456789012:role/TestRole")
-	if profile != "" {
-		t.Errorf("Expected empty profile for nil credential reader, got '%s'", profile)
+	role, err := awsService.ResolveAssumableRole("prd", "arn:aws:iam::123456789012:role/TestRole")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if role.Profile != "" {
+		t.Errorf("Expected empty profile for nil credential reader, got '%s'", role.Profile)
+	}
+}
+
+func TestCredentialReader_ConfigFileMerging(t *testing.T) {
+	cr := NewCredentialReader()
+
+	credentialsContent := `[prd]
+aws_access_key_id = AKIAI44QH8DHBEXAMPLE
+aws_secret_access_key = je7MtGbClwBF/2Zp9Utk/h3yCo8nvbEXAMPLEKEY`
+
+	configContent := `[default]
+region = us-east-1
+
+[profile prd]
+mfa_serial = arn:aws:iam::123456789012:mfa/prd-user
+region = eu-west-2
+
+; standard AWS role profile
+[profile int]
+role_arn = arn:aws:iam::987654321098:role/OrganizationAccountAccessRole
+source_profile = prd
+mfa_serial = arn:aws:iam::123456789012:mfa/prd-user
+region = eu-west-1
+duration_seconds = 43200
+external_id = int-external-id
+
+[sso-session my-sso]
+sso_region = eu-west-2
+
+[services local]
+sts =
+  endpoint_url = http://localhost:4566`
+
+	cr.clearCredentials()
+	if err := cr.loadCredentialsFromContent(credentialsContent); err != nil {
+		t.Fatalf("Failed to load test credentials: %v", err)
+	}
+	if err := cr.loadConfigFromContent(configContent); err != nil {
+		t.Fatalf("Failed to load test config: %v", err)
+	}
+
+	prd, exists := cr.GetCredential("prd")
+	if !exists {
+		t.Fatal("prd should exist")
+	}
+	if prd.AccessKey != "AKIAI44QH8DHBEXAMPLE" {
+		t.Errorf("Expected AccessKey from the credentials file, got '%s'", prd.AccessKey)
+	}
+	if prd.MfaSerial != "arn:aws:iam::123456789012:mfa/prd-user" {
+		t.Errorf("Expected MfaSerial from the config file, got '%s'", prd.MfaSerial)
+	}
+	if prd.Region != "eu-west-2" {
+		t.Errorf("Expected Region 'eu-west-2', got '%s'", prd.Region)
+	}
+
+	// Merging the config makes prd a valid profile
+	profiles := cr.GetValidProfiles()
+	if len(profiles) != 1 || profiles[0] != "prd" {
+		t.Errorf("Expected valid profiles [prd], got %v", profiles)
+	}
+
+	intProfile, exists := cr.GetCredential("int")
+	if !exists {
+		t.Fatal("int should exist")
+	}
+	if intProfile.AssumableRoleID != "arn:aws:iam::987654321098:role/OrganizationAccountAccessRole" {
+		t.Errorf("Expected role_arn to populate AssumableRoleID, got '%s'", intProfile.AssumableRoleID)
+	}
+	if intProfile.SourceProfile != "prd" {
+		t.Errorf("Expected SourceProfile 'prd', got '%s'", intProfile.SourceProfile)
+	}
+	if intProfile.DurationSeconds != 43200 {
+		t.Errorf("Expected DurationSeconds 43200, got %d", intProfile.DurationSeconds)
+	}
+	if intProfile.ExternalID != "int-external-id" {
+		t.Errorf("Expected ExternalID 'int-external-id', got '%s'", intProfile.ExternalID)
+	}
+	if profiles := cr.ProfilesForRoleArn(intProfile.AssumableRoleID); len(profiles) != 1 || profiles[0] != "int" {
+		t.Errorf("Expected role ARN lookup to resolve to 'int'")
+	}
+
+	defaultProfile, exists := cr.GetCredential("default")
+	if !exists || defaultProfile.Region != "us-east-1" {
+		t.Errorf("Expected [default] to be read from the config file")
+	}
+
+	// Non-profile sections must not leak in as profiles
+	for _, name := range []string{"sso-session my-sso", "my-sso", "services local", "local", ""} {
+		if _, exists := cr.GetCredential(name); exists {
+			t.Errorf("Section '%s' should not be treated as a profile", name)
+		}
+	}
+}
+
+func TestDefaultCredentialFiles(t *testing.T) {
+	homeDir := t.TempDir()
+	t.Setenv("HOME", homeDir)
+
+	tests := []struct {
+		name                string
+		credentialsEnv      string
+		configEnv           string
+		expectedCredentials string
+		expectedConfig      string
+	}{
+		{
+			name:                "defaults to ~/.aws",
+			expectedCredentials: filepath.Join(homeDir, ".aws", "credentials"),
+			expectedConfig:      filepath.Join(homeDir, ".aws", "config"),
+		},
+		{
+			name:                "environment variables override the defaults",
+			credentialsEnv:      "/etc/aws/credentials",
+			configEnv:           "/etc/aws/config",
+			expectedCredentials: "/etc/aws/credentials",
+			expectedConfig:      "/etc/aws/config",
+		},
+		{
+			name:                "environment variables expand the home directory",
+			credentialsEnv:      "~/work/credentials",
+			configEnv:           "~/work/config",
+			expectedCredentials: filepath.Join(homeDir, "work", "credentials"),
+			expectedConfig:      filepath.Join(homeDir, "work", "config"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("AWS_SHARED_CREDENTIALS_FILE", tt.credentialsEnv)
+			t.Setenv("AWS_CONFIG_FILE", tt.configEnv)
+
+			files, err := DefaultCredentialFiles()
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if len(files.Credentials) != 1 || files.Credentials[0] != tt.expectedCredentials {
+				t.Errorf("Expected credentials [%s], got %v", tt.expectedCredentials, files.Credentials)
+			}
+			if len(files.Config) != 1 || files.Config[0] != tt.expectedConfig {
+				t.Errorf("Expected config [%s], got %v", tt.expectedConfig, files.Config)
+			}
+		})
+	}
+}
+
+func TestCredentialReader_LoadFiles(t *testing.T) {
+	tempDir := t.TempDir()
+
+	workPath := filepath.Join(tempDir, "work")
+	personalPath := filepath.Join(tempDir, "personal")
+	configPath := filepath.Join(tempDir, "config")
+
+	files := map[string]string{
+		workPath: `[prd]
+aws_access_key_id = AKIAI44QH8DHBEXAMPLE
+aws_secret_access_key = je7MtGbClwBF/2Zp9Utk/h3yCo8nvbEXAMPLEKEY
+mfa_serial = arn:aws:iam::123456789012:mfa/prd-user
+vault_key = work-key`,
+		personalPath: `[personal]
+aws_access_key_id = AKIAI44QH8DHBEXAMPLE2
+aws_secret_access_key = je7MtGbClwBF/2Zp9Utk/h3yCo8nvbEXAMPLEKEY2
+mfa_serial = arn:aws:iam::555555555555:mfa/me
+
+[prd]
+vault_key = overridden-key`,
+		configPath: `[profile prd]
+region = eu-west-2`,
+	}
+	for path, content := range files {
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatalf("Failed to write %s: %v", path, err)
+		}
+	}
+
+	t.Run("merges files in order", func(t *testing.T) {
+		cr := NewCredentialReader()
+		cr.clearCredentials()
+
+		err := cr.LoadFiles(CredentialFiles{
+			Credentials: []string{workPath, personalPath},
+			Config:      []string{configPath, filepath.Join(tempDir, "missing-config")},
+		})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		if len(cr.GetValidProfiles()) != 2 {
+			t.Errorf("Expected 2 valid profiles, got %v", cr.GetValidProfiles())
+		}
+
+		prd, _ := cr.GetCredential("prd")
+		if prd.VaultKey != "overridden-key" {
+			t.Errorf("Expected the later file to win, got VaultKey '%s'", prd.VaultKey)
+		}
+		if prd.AccessKey != "AKIAI44QH8DHBEXAMPLE" {
+			t.Errorf("Expected keys missing from the later file to be kept, got AccessKey '%s'", prd.AccessKey)
+		}
+		if prd.Region != "eu-west-2" {
+			t.Errorf("Expected Region from the config file, got '%s'", prd.Region)
+		}
+	})
+
+	t.Run("config file without a credentials file", func(t *testing.T) {
+		ssoConfigPath := filepath.Join(tempDir, "sso-config")
+		if err := os.WriteFile(ssoConfigPath, []byte(`[profile corp]
+sso_session = corp
+
+[sso-session corp]
+sso_start_url = https://corp.awsapps.com/start
+sso_region = eu-west-2`), 0600); err != nil {
+			t.Fatalf("Failed to write %s: %v", ssoConfigPath, err)
+		}
+
+		cr := NewCredentialReader()
+		cr.clearCredentials()
+
+		err := cr.LoadFiles(CredentialFiles{
+			Credentials: []string{filepath.Join(tempDir, "missing-credentials")},
+			Config:      []string{ssoConfigPath},
+		})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		if profiles := cr.GetValidProfiles(); len(profiles) != 1 || profiles[0] != "corp" {
+			t.Errorf("Expected the corp profile, got %v", profiles)
+		}
+	})
+
+	t.Run("missing files are an error", func(t *testing.T) {
+		cr := NewCredentialReader()
+		cr.clearCredentials()
+
+		err := cr.LoadFiles(CredentialFiles{
+			Credentials: []string{filepath.Join(tempDir, "missing-credentials")},
+			Config:      []string{filepath.Join(tempDir, "missing-config")},
+		})
+		if err == nil {
+			t.Errorf("Expected error but got none")
+		}
+	})
+}
+
+func TestParseECRRegistries(t *testing.T) {
+	tests := []struct {
+		name     string
+		value    string
+		expected []types.ECRRegistry
+	}{
+		{
+			name:  "account and region pairs",
+			value: "123456789012:us-east-1, 210987654321:ap-southeast-2",
+			expected: []types.ECRRegistry{
+				{AccountID: "123456789012", Region: "us-east-1"},
+				{AccountID: "210987654321", Region: "ap-southeast-2"},
+			},
+		},
+		{
+			name:     "registry hostname",
+			value:    "123456789012.dkr.ecr.eu-west-1.amazonaws.com",
+			expected: []types.ECRRegistry{{AccountID: "123456789012", Region: "eu-west-1"}},
+		},
+		{
+			name:     "malformed entries are ignored",
+			value:    "123456789012, :us-east-1, 123456789012:eu-west-2",
+			expected: []types.ECRRegistry{{AccountID: "123456789012", Region: "eu-west-2"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			registries := ParseECRRegistries(tt.value)
+			if fmt.Sprint(registries) != fmt.Sprint(tt.expected) {
+				t.Errorf("Expected %v, got %v", tt.expected, registries)
+			}
+		})
 	}
 }
@@ -0,0 +1,103 @@
+package core
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// DefaultDockerConfigPath returns the docker client config, honouring DOCKER_CONFIG
+// (which points at the directory, not the file) just like the docker CLI does.
+func DefaultDockerConfigPath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %w", err)
+	}
+
+	if dir := os.Getenv("DOCKER_CONFIG"); dir != "" {
+		return filepath.Join(ExpandHome(dir, home), "config.json"), nil
+	}
+
+	return filepath.Join(home, ".docker", "config.json"), nil
+}
+
+// WriteDockerAuth stores the credentials for the registry in the auths section of the
+// docker config, the same place `docker login` writes to when no credential store is
+// configured.  Every other key in the file is preserved as-is, which is why we only
+// decode the top level (and the auths map) rather than the whole document.
+//
+// Buildah, Kaniko, crane and friends all read this file, so it works without a daemon.
+func WriteDockerAuth(path, registry, username, password string) error {
+	config := make(map[string]json.RawMessage)
+
+	raw, err := os.ReadFile(path)
+	switch {
+	case err == nil:
+		if err := json.Unmarshal(raw, &config); err != nil {
+			return fmt.Errorf("failed to parse docker config %s: %w", path, err)
+		}
+	case errors.Is(err, fs.ErrNotExist):
+		// First login on this machine, we'll create the file
+	default:
+		return fmt.Errorf("failed to read docker config %s: %w", path, err)
+	}
+
+	auths := make(map[string]json.RawMessage)
+	if existing, ok := config["auths"]; ok {
+		if err := json.Unmarshal(existing, &auths); err != nil {
+			return fmt.Errorf("failed to parse auths in docker config %s: %w", path, err)
+		}
+	}
+
+	entry, err := json.Marshal(map[string]string{
+		"auth": base64.StdEncoding.EncodeToString([]byte(username + ":" + password)),
+	})
+	if err != nil {
+		return err
+	}
+	auths[registry] = entry
+
+	if config["auths"], err = json.Marshal(auths); err != nil {
+		return err
+	}
+
+	output, err := json.MarshalIndent(config, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	// The file holds registry passwords, keep it private to the user
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("failed to create docker config directory: %w", err)
+	}
+
+	// Write to a temporary file and rename so a concurrent docker command never
+	// reads a half written config
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".config.json-*")
+	if err != nil {
+		return fmt.Errorf("failed to write docker config: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(append(output, '\n')); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write docker config: %w", err)
+	}
+	if err := tmp.Chmod(0600); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write docker config: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write docker config: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to write docker config: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,101 @@
+package core
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteDockerAuth(t *testing.T) {
+	t.Run("creates the config", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "docker", "config.json")
+
+		if err := WriteDockerAuth(path, "123456789012.dkr.ecr.eu-west-2.amazonaws.com", "AWS", "ecr-password"); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatalf("Expected the config to exist: %v", err)
+		}
+		if info.Mode().Perm() != 0600 {
+			t.Errorf("Expected mode 0600, got %o", info.Mode().Perm())
+		}
+
+		var config struct {
+			Auths map[string]struct {
+				Auth string `json:"auth"`
+			} `json:"auths"`
+		}
+		raw, _ := os.ReadFile(path)
+		if err := json.Unmarshal(raw, &config); err != nil {
+			t.Fatalf("Failed to parse the written config: %v", err)
+		}
+
+		expected := base64.StdEncoding.EncodeToString([]byte("AWS:ecr-password"))
+		if got := config.Auths["123456789012.dkr.ecr.eu-west-2.amazonaws.com"].Auth; got != expected {
+			t.Errorf("Expected auth '%s', got '%s'", expected, got)
+		}
+	})
+
+	t.Run("preserves existing settings", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "config.json")
+		existing := `{
+	"auths": {"ghcr.io": {"auth": "Z2hjcg=="}},
+	"credHelpers": {"gcr.io": "gcloud"},
+	"psFormat": "table {{.ID}}"
+}`
+		if err := os.WriteFile(path, []byte(existing), 0600); err != nil {
+			t.Fatalf("Failed to write the existing config: %v", err)
+		}
+
+		if err := WriteDockerAuth(path, "123456789012.dkr.ecr.eu-west-2.amazonaws.com", "AWS", "ecr-password"); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		var config map[string]any
+		raw, _ := os.ReadFile(path)
+		if err := json.Unmarshal(raw, &config); err != nil {
+			t.Fatalf("Failed to parse the written config: %v", err)
+		}
+
+		auths := config["auths"].(map[string]any)
+		if _, ok := auths["ghcr.io"]; !ok {
+			t.Errorf("Expected the existing ghcr.io auth to be kept")
+		}
+		if _, ok := auths["123456789012.dkr.ecr.eu-west-2.amazonaws.com"]; !ok {
+			t.Errorf("Expected the ECR auth to be added")
+		}
+		if config["psFormat"] != "table {{.ID}}" {
+			t.Errorf("Expected unrelated settings to be kept, got %v", config["psFormat"])
+		}
+		if config["credHelpers"].(map[string]any)["gcr.io"] != "gcloud" {
+			t.Errorf("Expected credHelpers to be kept, got %v", config["credHelpers"])
+		}
+	})
+
+	t.Run("invalid config is an error", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "config.json")
+		if err := os.WriteFile(path, []byte("not json"), 0600); err != nil {
+			t.Fatalf("Failed to write the existing config: %v", err)
+		}
+
+		if err := WriteDockerAuth(path, "registry", "AWS", "password"); err == nil {
+			t.Errorf("Expected error but got none")
+		}
+	})
+}
+
+func TestDefaultDockerConfigPath(t *testing.T) {
+	t.Setenv("DOCKER_CONFIG", "/etc/docker-ci")
+
+	path, err := DefaultDockerConfigPath()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if path != "/etc/docker-ci/config.json" {
+		t.Errorf("Expected DOCKER_CONFIG to be honoured, got '%s'", path)
+	}
+}
@@ -0,0 +1,96 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/alexmk92/aws-login/core/types"
+)
+
+// ECR login targets, every target is handed the same ECR password for the registry
+const (
+	ECRTargetDocker       = "docker"
+	ECRTargetDockerConfig = "docker-config" // Writes ~/.docker/config.json directly, no daemon needed
+	ECRTargetPodman       = "podman"
+	ECRTargetNerdctl      = "nerdctl"
+	ECRTargetHelm         = "helm"
+	ECRTargetOras         = "oras"
+)
+
+// DefaultECRTargets is used when neither the profile nor the flags choose targets
+var DefaultECRTargets = []string{ECRTargetDocker}
+
+// ecrLoginCommands builds the login command for every CLI based target, they all
+// accept the password on stdin so it never shows up in the process list.
+var ecrLoginCommands = map[string]func(host, username string) types.Command{
+	ECRTargetDocker: func(host, username string) types.Command {
+		return types.Command{Name: "docker", Args: []string{"login", "--username", username, "--password-stdin", host}}
+	},
+	ECRTargetPodman: func(host, username string) types.Command {
+		return types.Command{Name: "podman", Args: []string{"login", "--username", username, "--password-stdin", host}}
+	},
+	ECRTargetNerdctl: func(host, username string) types.Command {
+		return types.Command{Name: "nerdctl", Args: []string{"login", "--username", username, "--password-stdin", host}}
+	},
+	ECRTargetHelm: func(host, username string) types.Command {
+		return types.Command{Name: "helm", Args: []string{"registry", "login", "--username", username, "--password-stdin", host}}
+	},
+	ECRTargetOras: func(host, username string) types.Command {
+		return types.Command{Name: "oras", Args: []string{"login", "--username", username, "--password-stdin", host}}
+	},
+}
+
+// ParseECRTargets parses a comma separated list of login targets, unknown targets
+// are an error so typos don't silently skip a login
+func ParseECRTargets(value string) ([]string, error) {
+	var targets []string
+	for _, target := range strings.Split(value, ",") {
+		target = strings.ToLower(strings.TrimSpace(target))
+		if target == "" {
+			continue
+		}
+
+		if err := ValidateECRTarget(target); err != nil {
+			return nil, err
+		}
+		targets = append(targets, target)
+	}
+
+	return targets, nil
+}
+
+// ValidateECRTarget returns an error for targets we don't know how to log in to
+func ValidateECRTarget(target string) error {
+	if _, ok := ecrLoginCommands[target]; ok || target == ECRTargetDockerConfig {
+		return nil
+	}
+
+	return fmt.Errorf("unknown ECR login target '%s', valid options are: docker, docker-config, podman, nerdctl, helm, oras", target)
+}
+
+// loginTarget hands the registry credentials to a single target
+func (s *AWSService) loginTarget(target string, registry types.ECRRegistry, username, password string) error {
+	if target == ECRTargetDockerConfig {
+		path := s.dockerConfigPath
+		if path == "" {
+			var err error
+			if path, err = DefaultDockerConfigPath(); err != nil {
+				return err
+			}
+		}
+		return WriteDockerAuth(path, registry.Host(), username, password)
+	}
+
+	buildCommand, ok := ecrLoginCommands[target]
+	if !ok {
+		return ValidateECRTarget(target)
+	}
+
+	cmd := buildCommand(registry.Host(), username)
+	cmd.Stdin = password
+	if _, err := s.Runner().Run(cmd); err != nil {
+		return classifyError(fmt.Sprintf("failed to login to ECR with %s", target), err)
+	}
+
+	return nil
+}
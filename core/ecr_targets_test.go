@@ -0,0 +1,138 @@
+package core
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/alexmk92/aws-login/core/aws_client"
+	"github.com/alexmk92/aws-login/core/coretest"
+	"github.com/alexmk92/aws-login/core/types"
+)
+
+func TestParseECRTargets(t *testing.T) {
+	tests := []struct {
+		name        string
+		value       string
+		expected    []string
+		expectError bool
+	}{
+		{name: "single target", value: "docker", expected: []string{"docker"}},
+		{name: "several targets", value: "Podman, helm,oras", expected: []string{"podman", "helm", "oras"}},
+		{name: "docker config", value: "docker-config", expected: []string{"docker-config"}},
+		{name: "empty", value: "", expected: nil},
+		{name: "unknown target", value: "docker,skopeo", expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			targets, err := ParseECRTargets(tt.value)
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("Expected error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if fmt.Sprint(targets) != fmt.Sprint(tt.expected) {
+				t.Errorf("Expected %v, got %v", tt.expected, targets)
+			}
+		})
+	}
+}
+
+func TestAWSService_LoginToECR_Targets(t *testing.T) {
+	cr := NewCredentialReader()
+	cr.clearCredentials()
+	err := cr.loadCredentialsFromContent(`[prd]
+aws_access_key_id = AKIAI44QH8DHBEXAMPLE
+aws_secret_access_key = je7MtGbClwBF/2Zp9Utk/h3yCo8nvbEXAMPLEKEY
+mfa_serial = arn:aws:iam::123456789012:mfa/prd-user
+account_id = 123456789012
+region = us-east-1
+ecr_login_targets = podman, helm, oras, nerdctl, docker-config`)
+	if err != nil {
+		t.Fatalf("Failed to load test credentials: %v", err)
+	}
+
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		token := base64.StdEncoding.EncodeToString([]byte("AWS:ecr-password"))
+		fmt.Fprintf(w, `{"authorizationData":[{"authorizationToken":"%s","expiresAt":4070908800}]}`, token)
+	}))
+	defer server.Close()
+
+	t.Setenv("AWS_PROFILE", "prd")
+
+	runner := coretest.NewFakeRunner().
+		On("podman login", types.CommandResult{}).
+		On("helm registry login", types.CommandResult{}).
+		On("oras login", types.CommandResult{}).
+		On("nerdctl login", types.CommandResult{Stderr: "nerdctl: not running", ExitCode: 1})
+
+	dockerConfigPath := filepath.Join(t.TempDir(), "config.json")
+	awsService := &AWSService{
+		credentialReader:  cr,
+		attemptECRLogin:   true,
+		activeCredentials: &types.Credentials{AccessKeyId: "ASIA", SecretAccessKey: "secret", SessionToken: "token"},
+		apiClient:         aws_client.NewClient(aws_client.Config{ECREndpoint: server.URL}),
+		runner:            runner,
+		dockerConfigPath:  dockerConfigPath,
+	}
+
+	results, err := awsService.LoginToECR()
+	if err == nil {
+		t.Errorf("Expected an error when a target fails")
+	}
+	if requests != 1 {
+		t.Errorf("Expected a single token request for the registry, got %d", requests)
+	}
+
+	host := "123456789012.dkr.ecr.us-east-1.amazonaws.com"
+	expected := []string{
+		"podman login --username AWS --password-stdin " + host,
+		"helm registry login --username AWS --password-stdin " + host,
+		"oras login --username AWS --password-stdin " + host,
+		"nerdctl login --username AWS --password-stdin " + host,
+	}
+	if strings.Join(runner.CommandLines(), "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Expected commands %v, got %v", expected, runner.CommandLines())
+	}
+	for _, call := range runner.Calls {
+		if call.Stdin != "ecr-password" {
+			t.Errorf("Expected the ECR password on stdin for %s, got '%s'", call.Name, call.Stdin)
+		}
+	}
+
+	if len(results) != 5 {
+		t.Fatalf("Expected a result per target, got %d", len(results))
+	}
+	for _, result := range results {
+		if (result.Err != nil) != (result.Target == ECRTargetNerdctl) {
+			t.Errorf("Unexpected result for %s: %v", result.Target, result.Err)
+		}
+	}
+
+	if _, err := os.Stat(dockerConfigPath); err != nil {
+		t.Errorf("Expected the docker config to be written: %v", err)
+	}
+
+	// The flags win over the profile
+	runner.Calls = nil
+	awsService.SetECRTargets([]string{ECRTargetDocker})
+	runner.On("docker login", types.CommandResult{})
+	if _, err := awsService.LoginToECR(); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if strings.Join(runner.CommandLines(), "\n") != "docker login --username AWS --password-stdin "+host {
+		t.Errorf("Expected only docker login, got %v", runner.CommandLines())
+	}
+}
@@ -0,0 +1,177 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/alexmk92/aws-login/core/types"
+)
+
+// ExecCredentialAPIVersion is the client.authentication.k8s.io version we write to the
+// kubeconfig and answer with, v1beta1 is understood by every supported kubectl
+const ExecCredentialAPIVersion = "client.authentication.k8s.io/v1beta1"
+
+// KubeconfigExecCommand is the binary kubectl runs to fetch a token, it must be on the
+// PATH of whoever runs kubectl
+const KubeconfigExecCommand = "aws-login"
+
+// SetAttemptEKSLogin enables updating the kubeconfig after the session is established
+func (s *AWSService) SetAttemptEKSLogin(attempt bool) {
+	s.attemptEKSLogin = attempt
+}
+
+// SetKubeconfigPath changes the kubeconfig we update, an empty path leaves the choice
+// to kubectl (KUBECONFIG, then ~/.kube/config)
+func (s *AWSService) SetKubeconfigPath(path string) {
+	s.kubeconfigPath = path
+}
+
+// UpdateKubeconfig adds every cluster in eks_clusters on the active profile to the
+// kubeconfig, much like `aws eks update-kubeconfig`.  Rather than baking in the AWS CLI,
+// the user entry runs `aws-login eks-token` so kubectl reuses our cached MFA session.
+//
+// The entries are written with `kubectl config` so the rest of the file (and its
+// formatting) is left alone, each context is named after the cluster ARN.  Like
+// LoginToECR, a result is returned per cluster and the error is non-nil when nothing
+// could be attempted or any cluster failed.
+func (s *AWSService) UpdateKubeconfig() ([]types.EKSLoginResult, error) {
+	if !s.attemptEKSLogin {
+		return nil, fmt.Errorf("attempt to update the kubeconfig is disabled")
+	}
+
+	if s.activeCredentials == nil {
+		return nil, fmt.Errorf("no active session, log in first")
+	}
+
+	profile := os.Getenv("AWS_PROFILE")
+	clusters := s.eksClustersFor(profile, s.sessionProfile)
+	if len(clusters) == 0 {
+		return nil, fmt.Errorf("no eks_clusters configured for profile '%s'", profile)
+	}
+
+	results := make([]types.EKSLoginResult, 0, len(clusters))
+	failed := 0
+	for _, cluster := range clusters {
+		result := types.EKSLoginResult{Cluster: cluster}
+
+		region := firstNonEmpty(cluster.Region, s.regionFor(profile, s.sessionProfile))
+		if region == "" {
+			result.Err = fmt.Errorf("no region configured for EKS cluster '%s', use eks_clusters = %s:REGION", cluster.Name, cluster.Name)
+		} else {
+			result.Context, result.Err = s.addKubeconfigCluster(cluster.Name, region, profile)
+		}
+
+		if result.Err != nil {
+			failed++
+		}
+		results = append(results, result)
+	}
+
+	if failed > 0 {
+		return results, fmt.Errorf("failed to add %d of %d EKS clusters to the kubeconfig", failed, len(results))
+	}
+
+	return results, nil
+}
+
+// addKubeconfigCluster writes the cluster, user and context entries for a single
+// cluster, returning the context name
+func (s *AWSService) addKubeconfigCluster(name, region, profile string) (string, error) {
+	cluster, err := s.apiClient.DescribeCluster(context.Background(), *s.activeCredentials, region, name)
+	if err != nil {
+		return "", classifyError(fmt.Sprintf("failed to describe EKS cluster %s", name), err)
+	}
+
+	// kubectl has to log in the same way we did, a role profile is assumed from the
+	// session profile
+	execArgs := []string{"eks-token", "--cluster", name, "--region", region, "--profile", s.sessionProfile}
+	if profile != "" && profile != s.sessionProfile {
+		execArgs = append(execArgs, "--role", profile)
+	} else if s.assumedRoleArn != "" {
+		// A raw role ARN, or an IAM Identity Center role picked from the list, has no
+		// profile of its own
+		execArgs = append(execArgs, "--role", s.assumedRoleArn)
+	}
+
+	user := []string{"config", "set-credentials", cluster.Arn,
+		"--exec-api-version=" + ExecCredentialAPIVersion,
+		"--exec-command=" + KubeconfigExecCommand,
+	}
+	for _, arg := range execArgs {
+		user = append(user, "--exec-arg="+arg)
+	}
+
+	commands := [][]string{
+		{"config", "set-cluster", cluster.Arn, "--server=" + cluster.Endpoint},
+		// set-cluster can only embed a CA from a file, set decodes the base64 for us
+		{"config", "set", "clusters." + cluster.Arn + ".certificate-authority-data", cluster.CertificateAuthorityData},
+		user,
+		{"config", "set-context", cluster.Arn, "--cluster=" + cluster.Arn, "--user=" + cluster.Arn},
+	}
+
+	for _, args := range commands {
+		if s.kubeconfigPath != "" {
+			args = append(args, "--kubeconfig="+s.kubeconfigPath)
+		}
+		if _, err := s.Runner().Run(types.Command{Name: "kubectl", Args: args}); err != nil {
+			return "", classifyError(fmt.Sprintf("failed to add EKS cluster %s to the kubeconfig", name), err)
+		}
+	}
+
+	return cluster.Arn, nil
+}
+
+// EKSExecCredential returns a token for the cluster from the active session in the
+// shape kubectl expects from an exec plugin.  When the region is empty we look for
+// the cluster in eks_clusters before falling back to the profile's region.
+func (s *AWSService) EKSExecCredential(clusterName, region string) (*types.ExecCredential, error) {
+	if s.activeCredentials == nil {
+		return nil, fmt.Errorf("no active session, log in first")
+	}
+
+	profile := os.Getenv("AWS_PROFILE")
+	if region == "" {
+		for _, cluster := range s.eksClustersFor(profile, s.sessionProfile) {
+			if cluster.Name == clusterName && cluster.Region != "" {
+				region = cluster.Region
+				break
+			}
+		}
+	}
+	region = firstNonEmpty(region, s.regionFor(profile, s.sessionProfile))
+	if region == "" {
+		return nil, fmt.Errorf("no region configured for EKS cluster '%s', pass --region", clusterName)
+	}
+
+	token, expiration, err := s.apiClient.GetEKSToken(*s.activeCredentials, region, clusterName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create EKS token: %w", err)
+	}
+
+	// There's no point in kubectl holding on to a token past the end of the session
+	if sessionExpiration, err := time.Parse(time.RFC3339, s.activeCredentials.Expiration); err == nil && sessionExpiration.Before(expiration) {
+		expiration = sessionExpiration
+	}
+
+	return &types.ExecCredential{
+		Kind:       "ExecCredential",
+		APIVersion: ExecCredentialAPIVersion,
+		Status: types.ExecCredentialStatus{
+			ExpirationTimestamp: expiration.UTC().Format(time.RFC3339),
+			Token:               token,
+		},
+	}, nil
+}
+
+// eksClustersFor returns the clusters configured on the first profile that has any
+func (s *AWSService) eksClustersFor(profiles ...string) []types.EKSCluster {
+	for _, profile := range profiles {
+		if credentials, err := s.GetCredentials(profile); err == nil && len(credentials.EKSClusters) > 0 {
+			return credentials.EKSClusters
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,153 @@
+package core
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alexmk92/aws-login/core/aws_client"
+	"github.com/alexmk92/aws-login/core/coretest"
+	"github.com/alexmk92/aws-login/core/types"
+)
+
+func TestParseEKSClusters(t *testing.T) {
+	clusters := ParseEKSClusters("prd, staging:us-east-1,, :eu-west-1")
+
+	expected := []types.EKSCluster{{Name: "prd"}, {Name: "staging", Region: "us-east-1"}}
+	if len(clusters) != len(expected) {
+		t.Fatalf("Expected %d clusters, got %v", len(expected), clusters)
+	}
+	for i := range expected {
+		if clusters[i] != expected[i] {
+			t.Errorf("Expected %+v, got %+v", expected[i], clusters[i])
+		}
+	}
+}
+
+func newEKSTestService(t *testing.T, runner *coretest.FakeRunner) *AWSService {
+	t.Helper()
+
+	cr := NewCredentialReader()
+	cr.clearCredentials()
+	err := cr.loadCredentialsFromContent(`[prd]
+aws_access_key_id = AKIAI44QH8DHBEXAMPLE
+aws_secret_access_key = je7MtGbClwBF/2Zp9Utk/h3yCo8nvbEXAMPLEKEY
+mfa_serial = arn:aws:iam::123456789012:mfa/prd-user
+region = eu-west-2
+
+[int]
+assumable_role_id = arn:aws:iam::210987654321:role/int
+eks_clusters = int, tools:us-east-1`)
+	if err != nil {
+		t.Fatalf("Failed to load test credentials: %v", err)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := strings.TrimPrefix(r.URL.Path, "/clusters/")
+		if name == "tools" {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"message":"No cluster found for name: tools."}`)
+			return
+		}
+
+		fmt.Fprintf(w, `{"cluster":{"name":"%s","arn":"arn:aws:eks:eu-west-2:210987654321:cluster/%s",
+			"endpoint":"https://%s.eks.example","certificateAuthority":{"data":"Q0E="}}}`, name, name, name)
+	}))
+	t.Cleanup(server.Close)
+
+	t.Setenv("AWS_PROFILE", "int")
+
+	return &AWSService{
+		credentialReader:  cr,
+		attemptEKSLogin:   true,
+		kubeconfigPath:    "/tmp/kubeconfig",
+		sessionProfile:    "prd",
+		activeCredentials: &types.Credentials{AccessKeyId: "ASIA", SecretAccessKey: "secret", SessionToken: "token", Profile: "int"},
+		apiClient:         aws_client.NewClient(aws_client.Config{EKSEndpoint: server.URL}),
+		runner:            runner,
+	}
+}
+
+func TestAWSService_UpdateKubeconfig(t *testing.T) {
+	runner := coretest.NewFakeRunner().On("kubectl config", types.CommandResult{})
+	awsService := newEKSTestService(t, runner)
+
+	results, err := awsService.UpdateKubeconfig()
+	if err == nil {
+		t.Errorf("Expected an error when a cluster can't be described")
+	}
+	if len(results) != 2 {
+		t.Fatalf("Expected a result per cluster, got %d", len(results))
+	}
+	if results[0].Err != nil || results[0].Context != "arn:aws:eks:eu-west-2:210987654321:cluster/int" {
+		t.Errorf("Expected the int cluster to be added, got %+v", results[0])
+	}
+	if results[1].Err == nil {
+		t.Errorf("Expected the tools cluster to fail")
+	}
+
+	arn := "arn:aws:eks:eu-west-2:210987654321:cluster/int"
+	expected := []string{
+		"kubectl config set-cluster " + arn + " --server=https://int.eks.example --kubeconfig=/tmp/kubeconfig",
+		"kubectl config set clusters." + arn + ".certificate-authority-data Q0E= --kubeconfig=/tmp/kubeconfig",
+		"kubectl config set-credentials " + arn + " --exec-api-version=client.authentication.k8s.io/v1beta1 --exec-command=aws-login" +
+			" --exec-arg=eks-token --exec-arg=--cluster --exec-arg=int --exec-arg=--region --exec-arg=eu-west-2" +
+			" --exec-arg=--profile --exec-arg=prd --exec-arg=--role --exec-arg=int --kubeconfig=/tmp/kubeconfig",
+		"kubectl config set-context " + arn + " --cluster=" + arn + " --user=" + arn + " --kubeconfig=/tmp/kubeconfig",
+	}
+
+	calls := runner.CommandLines()
+	if len(calls) != len(expected) {
+		t.Fatalf("Expected %d kubectl calls, got %v", len(expected), calls)
+	}
+	for i := range expected {
+		if calls[i] != expected[i] {
+			t.Errorf("Expected:\n%s\ngot:\n%s", expected[i], calls[i])
+		}
+	}
+}
+
+func TestAWSService_UpdateKubeconfig_RawRoleArn(t *testing.T) {
+	runner := coretest.NewFakeRunner().On("kubectl config", types.CommandResult{})
+	awsService := newEKSTestService(t, runner)
+
+	// The role was passed as an ARN, so the active profile is the session profile
+	awsService.assumedRoleArn = "arn:aws:iam::210987654321:role/int"
+	awsService.activeCredentials.Profile = "prd"
+
+	if _, err := awsService.addKubeconfigCluster("int", "eu-west-2", "prd"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	calls := runner.CommandLines()
+	if len(calls) != 4 {
+		t.Fatalf("Expected 4 kubectl calls, got %v", calls)
+	}
+	if !strings.Contains(calls[2], "--exec-arg=--profile --exec-arg=prd --exec-arg=--role --exec-arg=arn:aws:iam::210987654321:role/int ") {
+		t.Errorf("Expected the token to be minted for the assumed role ARN, got:\n%s", calls[2])
+	}
+}
+
+func TestAWSService_EKSExecCredential(t *testing.T) {
+	awsService := newEKSTestService(t, coretest.NewFakeRunner())
+	awsService.activeCredentials.Expiration = time.Now().Add(5 * time.Minute).UTC().Format(time.RFC3339)
+
+	credential, err := awsService.EKSExecCredential("tools", "")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if credential.Kind != "ExecCredential" || credential.APIVersion != ExecCredentialAPIVersion {
+		t.Errorf("Unexpected document %+v", credential)
+	}
+	if !strings.HasPrefix(credential.Status.Token, "k8s-aws-v1.") {
+		t.Errorf("Expected an EKS token, got '%s'", credential.Status.Token)
+	}
+	if credential.Status.ExpirationTimestamp != awsService.activeCredentials.Expiration {
+		t.Errorf("Expected the token to expire with the session at %s, got %s",
+			awsService.activeCredentials.Expiration, credential.Status.ExpirationTimestamp)
+	}
+}
@@ -0,0 +1,192 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/alexmk92/aws-login/core/aws_client"
+	"github.com/alexmk92/aws-login/core/types"
+)
+
+// ErrorKind classifies why a login step failed so the caller can explain it
+type ErrorKind int
+
+const (
+	ErrorKindUnknown ErrorKind = iota
+	ErrorKindInvalidMFACode
+	ErrorKindMFACodeReused
+	ErrorKindExpiredAccessKey
+	ErrorKindAccessDenied
+	ErrorKindClockSkew
+	ErrorKindNetwork
+	ErrorKindSSOSessionExpired
+)
+
+// String returns the string representation of the error kind
+func (k ErrorKind) String() string {
+	switch k {
+	case ErrorKindInvalidMFACode:
+		return "invalid-mfa-code"
+	case ErrorKindMFACodeReused:
+		return "mfa-code-reused"
+	case ErrorKindExpiredAccessKey:
+		return "expired-access-key"
+	case ErrorKindAccessDenied:
+		return "access-denied"
+	case ErrorKindClockSkew:
+		return "clock-skew"
+	case ErrorKindNetwork:
+		return "network"
+	case ErrorKindSSOSessionExpired:
+		return "sso-session-expired"
+	default:
+		return "unknown"
+	}
+}
+
+// LoginError is returned by every AWSService step that talks to AWS or spawns a
+// process, use errors.As to get at the kind, explanation and suggested fix.
+type LoginError struct {
+	Kind    ErrorKind
+	Op      string // What we were doing, i.e. "failed to get AWS session token"
+	Message string // The message AWS (or the CLI) gave us
+	Err     error
+}
+
+func (e *LoginError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Op, e.Message)
+}
+
+func (e *LoginError) Unwrap() error {
+	return e.Err
+}
+
+// Explanation describes the failure in plain English, it is empty for unknown errors
+func (e *LoginError) Explanation() string {
+	switch e.Kind {
+	case ErrorKindInvalidMFACode:
+		return "AWS rejected the MFA code."
+	case ErrorKindMFACodeReused:
+		return "This MFA code has already been used, AWS only accepts each code once."
+	case ErrorKindExpiredAccessKey:
+		return "The access key for this profile is invalid, expired or has been deactivated."
+	case ErrorKindAccessDenied:
+		return "AWS denied the request, you are not allowed to assume this role."
+	case ErrorKindClockSkew:
+		return "Your system clock is out of sync with AWS, so the request signature was rejected."
+	case ErrorKindNetwork:
+		return "Unable to reach AWS."
+	case ErrorKindSSOSessionExpired:
+		return "Your IAM Identity Center session has expired or was revoked."
+	default:
+		return ""
+	}
+}
+
+// Suggestion describes how the user can fix the failure, it is empty for unknown errors
+func (e *LoginError) Suggestion() string {
+	switch e.Kind {
+	case ErrorKindInvalidMFACode:
+		return "Check the code belongs to the device in mfa_serial and that your authenticator's clock is correct."
+	case ErrorKindMFACodeReused:
+		return "Wait for your authenticator to show a new code (at most 30 seconds) and try again."
+	case ErrorKindExpiredAccessKey:
+		return "Create a new access key in the IAM console and update aws_access_key_id/aws_secret_access_key."
+	case ErrorKindAccessDenied:
+		return "Check the role's trust policy allows your user and that the role ARN (and external_id) is correct."
+	case ErrorKindClockSkew:
+		return "Enable automatic time synchronisation (NTP) on this machine and try again."
+	case ErrorKindNetwork:
+		return "Check your network connection, VPN or proxy settings and any custom endpoint URLs."
+	case ErrorKindSSOSessionExpired:
+		return "Log in again and approve the new session in your browser."
+	default:
+		return ""
+	}
+}
+
+// IsErrorKind reports whether err is a LoginError of the given kind
+func IsErrorKind(err error, kind ErrorKind) bool {
+	var loginErr *LoginError
+	return errors.As(err, &loginErr) && loginErr.Kind == kind
+}
+
+// classifyError wraps err in a LoginError, working out the kind from the AWS error
+// code and message, or from the type of network/command failure.
+func classifyError(op string, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	loginErr := &LoginError{
+		Kind:    ErrorKindUnknown,
+		Op:      op,
+		Message: err.Error(),
+		Err:     err,
+	}
+
+	var apiErr *aws_client.APIError
+	var commandErr *types.CommandError
+	var netErr net.Error
+
+	switch {
+	case errors.As(err, &apiErr):
+		loginErr.Message = apiErr.Message
+		if loginErr.Message == "" {
+			loginErr.Message = apiErr.Error()
+		}
+		loginErr.Kind = classifyAPIError(apiErr)
+
+	case errors.As(err, &commandErr):
+		loginErr.Message = strings.TrimSpace(commandErr.Result.Stderr)
+		if loginErr.Message == "" {
+			loginErr.Message = commandErr.Error()
+		}
+
+	case errors.As(err, &netErr), errors.Is(err, context.DeadlineExceeded):
+		loginErr.Kind = ErrorKindNetwork
+	}
+
+	return loginErr
+}
+
+func classifyAPIError(apiErr *aws_client.APIError) ErrorKind {
+	message := strings.ToLower(apiErr.Message)
+
+	switch apiErr.Code {
+	case "InvalidClientTokenId", "ExpiredToken", "ExpiredTokenException", "UnrecognizedClientException":
+		return ErrorKindExpiredAccessKey
+
+	case "RequestExpired", "SignatureDoesNotMatch", "InvalidSignatureException":
+		if strings.Contains(message, "signature expired") || strings.Contains(message, "not yet current") || apiErr.Code == "RequestExpired" {
+			return ErrorKindClockSkew
+		}
+
+	case "UnauthorizedException", "expired_token", "invalid_grant":
+		return ErrorKindSSOSessionExpired
+
+	case "access_denied":
+		return ErrorKindAccessDenied
+
+	case "":
+		// The portal sends its error code in a header, a 401 can only mean the token
+		if apiErr.StatusCode == 401 {
+			return ErrorKindSSOSessionExpired
+		}
+
+	case "AccessDenied", "AccessDeniedException":
+		switch {
+		case strings.Contains(message, "invalid mfa one time pass code"):
+			return ErrorKindInvalidMFACode
+		case strings.Contains(message, "unable to validate mfa code"), strings.Contains(message, "already been used"):
+			return ErrorKindMFACodeReused
+		default:
+			return ErrorKindAccessDenied
+		}
+	}
+
+	return ErrorKindUnknown
+}
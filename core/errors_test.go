@@ -0,0 +1,102 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/alexmk92/aws-login/core/aws_client"
+	"github.com/alexmk92/aws-login/core/types"
+)
+
+func TestClassifyError(t *testing.T) {
+	tests := []struct {
+		name            string
+		err             error
+		expectedKind    ErrorKind
+		expectedMessage string
+	}{
+		{
+			name: "invalid MFA code",
+			err: &aws_client.APIError{
+				StatusCode: 403,
+				Code:       "AccessDenied",
+				Message:    "MultiFactorAuthentication failed with invalid MFA one time pass code.",
+			},
+			expectedKind:    ErrorKindInvalidMFACode,
+			expectedMessage: "MultiFactorAuthentication failed with invalid MFA one time pass code.",
+		},
+		{
+			name: "MFA code already used",
+			err: &aws_client.APIError{
+				StatusCode: 403,
+				Code:       "AccessDenied",
+				Message:    "MultiFactorAuthentication failed, unable to validate MFA code.",
+			},
+			expectedKind: ErrorKindMFACodeReused,
+		},
+		{
+			name:         "expired access key",
+			err:          &aws_client.APIError{StatusCode: 403, Code: "InvalidClientTokenId", Message: "The security token included in the request is invalid."},
+			expectedKind: ErrorKindExpiredAccessKey,
+		},
+		{
+			name:         "access denied on assume role",
+			err:          &aws_client.APIError{StatusCode: 403, Code: "AccessDenied", Message: "User is not authorized to perform: sts:AssumeRole"},
+			expectedKind: ErrorKindAccessDenied,
+		},
+		{
+			name:         "clock skew",
+			err:          &aws_client.APIError{StatusCode: 403, Code: "SignatureDoesNotMatch", Message: "Signature expired: 20250101T000000Z is now earlier than 20250101T001500Z"},
+			expectedKind: ErrorKindClockSkew,
+		},
+		{
+			name:         "bad signature is not clock skew",
+			err:          &aws_client.APIError{StatusCode: 403, Code: "SignatureDoesNotMatch", Message: "The request signature we calculated does not match"},
+			expectedKind: ErrorKindUnknown,
+		},
+		{
+			name:         "network failure",
+			err:          fmt.Errorf("post: %w", context.DeadlineExceeded),
+			expectedKind: ErrorKindNetwork,
+		},
+		{
+			name: "command failure uses stderr",
+			err: &types.CommandError{
+				Command: "docker login",
+				Result:  types.CommandResult{Stderr: "Error: Cannot connect to the Docker daemon\n", ExitCode: 1},
+				Err:     errors.New("exit status 1"),
+			},
+			expectedKind:    ErrorKindUnknown,
+			expectedMessage: "Error: Cannot connect to the Docker daemon",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := classifyError("failed to do the thing", tt.err)
+
+			var loginErr *LoginError
+			if !errors.As(err, &loginErr) {
+				t.Fatalf("Expected a LoginError, got %v", err)
+			}
+			if loginErr.Kind != tt.expectedKind {
+				t.Errorf("Expected kind '%s', got '%s'", tt.expectedKind, loginErr.Kind)
+			}
+			if tt.expectedMessage != "" && loginErr.Message != tt.expectedMessage {
+				t.Errorf("Expected message '%s', got '%s'", tt.expectedMessage, loginErr.Message)
+			}
+			if !errors.Is(err, tt.err) {
+				t.Errorf("Expected the original error to be wrapped")
+			}
+			if (tt.expectedKind == ErrorKindUnknown) != (loginErr.Suggestion() == "") {
+				t.Errorf("Expected a suggestion only for classified errors, got '%s'", loginErr.Suggestion())
+			}
+		})
+	}
+
+	if classifyError("noop", nil) != nil {
+		t.Errorf("Expected nil error to stay nil")
+	}
+}
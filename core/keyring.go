@@ -0,0 +1,64 @@
+package core
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+
+	"github.com/alexmk92/aws-login/core/types"
+)
+
+// KeyringService is the service name our secrets are stored under in the OS keyring
+const KeyringService = "aws-login"
+
+// KeyringGet reads a secret from the OS keyring, the macOS login keychain or the
+// Secret Service (GNOME Keyring, KWallet) on Linux via secret-tool
+func KeyringGet(runner types.Runner, account string) (string, error) {
+	var cmd types.Command
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = types.Command{Name: "security", Args: []string{"find-generic-password", "-s", KeyringService, "-a", account, "-w"}}
+	case "linux", "freebsd", "openbsd":
+		cmd = types.Command{Name: "secret-tool", Args: []string{"lookup", "service", KeyringService, "account", account}}
+	default:
+		return "", fmt.Errorf("the OS keyring is not supported on %s", runtime.GOOS)
+	}
+
+	result, err := RunnerOrDefault(runner).Run(cmd)
+	if err != nil {
+		return "", fmt.Errorf("failed to read '%s' from the keyring: %w", account, err)
+	}
+
+	secret := strings.TrimRight(result.Stdout, "\r\n")
+	if secret == "" {
+		return "", fmt.Errorf("'%s' is not in the keyring", account)
+	}
+
+	return secret, nil
+}
+
+// KeyringSet stores a secret in the OS keyring, replacing any existing value.  The
+// secret is passed on stdin so it never shows up in the process list.
+func KeyringSet(runner types.Runner, account, secret string) error {
+	var cmd types.Command
+	switch runtime.GOOS {
+	case "darwin":
+		// security -i reads commands from stdin, the secret must not contain quotes
+		if strings.ContainsAny(secret, "\"\n") {
+			return fmt.Errorf("secret can't be stored in the keychain")
+		}
+		cmd = types.Command{Name: "security", Args: []string{"-i"},
+			Stdin: fmt.Sprintf("add-generic-password -U -s %s -a %s -w \"%s\"\n", KeyringService, account, secret)}
+	case "linux", "freebsd", "openbsd":
+		cmd = types.Command{Name: "secret-tool", Args: []string{"store", "--label", KeyringService + " " + account, "service", KeyringService, "account", account},
+			Stdin: secret}
+	default:
+		return fmt.Errorf("the OS keyring is not supported on %s", runtime.GOOS)
+	}
+
+	if _, err := RunnerOrDefault(runner).Run(cmd); err != nil {
+		return fmt.Errorf("failed to store '%s' in the keyring: %w", account, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,76 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/alexmk92/aws-login/core/types"
+)
+
+// ExecRunner runs commands as real processes
+type ExecRunner struct{}
+
+// This is a type assertion to the compiler to ensure that ExecRunner implements the Runner interface
+var _ types.Runner = ExecRunner{}
+
+// Run executes the command, capturing stdout and stderr separately so that error
+// output never ends up being parsed as a result.
+func (ExecRunner) Run(command types.Command) (types.CommandResult, error) {
+	ctx := context.Background()
+	if command.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, command.Timeout)
+		defer cancel()
+	}
+
+	cmd := exec.CommandContext(ctx, command.Name, command.Args...)
+	// Don't wait on children that outlive a killed command and hold its output open
+	cmd.WaitDelay = time.Second
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if command.Stdin != "" {
+		cmd.Stdin = strings.NewReader(command.Stdin)
+	}
+	if len(command.Env) > 0 {
+		cmd.Env = append(os.Environ(), command.Env...)
+	}
+
+	err := cmd.Run()
+
+	result := types.CommandResult{
+		Stdout: stdout.String(),
+		Stderr: stderr.String(),
+	}
+
+	if err == nil {
+		return result, nil
+	}
+
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		result.ExitCode = exitErr.ExitCode()
+	}
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		err = fmt.Errorf("%w after %s", types.ErrCommandTimeout, command.Timeout)
+	}
+
+	return result, &types.CommandError{Command: command.Name, Result: result, Err: err}
+}
+
+// RunnerOrDefault returns the runner, falling back to ExecRunner when it is nil so
+// zero value structs keep working.
+func RunnerOrDefault(runner types.Runner) types.Runner {
+	if runner == nil {
+		return ExecRunner{}
+	}
+	return runner
+}
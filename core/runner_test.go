@@ -0,0 +1,46 @@
+package core
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alexmk92/aws-login/core/types"
+)
+
+func TestExecRunner_Run(t *testing.T) {
+	result, err := ExecRunner{}.Run(types.Command{
+		Name:  "sh",
+		Args:  []string{"-c", `read line; echo "out:$line:$EXTRA"; echo err >&2; exit 3`},
+		Stdin: "input\n",
+		Env:   []string{"EXTRA=extra"},
+	})
+
+	if err == nil {
+		t.Errorf("Expected an error for a non-zero exit code")
+	}
+	if result.ExitCode != 3 {
+		t.Errorf("Expected exit code 3, got %d", result.ExitCode)
+	}
+	if result.Stdout != "out:input:extra\n" {
+		t.Errorf("Expected stdout 'out:input:extra', got '%s'", result.Stdout)
+	}
+	if result.Stderr != "err\n" {
+		t.Errorf("Expected stderr to be captured separately, got '%s'", result.Stderr)
+	}
+}
+
+func TestExecRunner_Timeout(t *testing.T) {
+	start := time.Now()
+	_, err := ExecRunner{}.Run(types.Command{Name: "sh", Args: []string{"-c", "echo waiting >&2; sleep 10"}, Timeout: 100 * time.Millisecond})
+
+	if !errors.Is(err, types.ErrCommandTimeout) {
+		t.Errorf("Expected a timeout error, got %v", err)
+	}
+	if err == nil || err.Error() != "sh: timed out after 100ms: waiting" {
+		t.Errorf("Expected the timeout and stderr in the message, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Expected the command to be killed, it ran for %s", elapsed)
+	}
+}
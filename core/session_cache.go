@@ -0,0 +1,97 @@
+package core
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/alexmk92/aws-login/core/types"
+)
+
+// DefaultRefreshThreshold is the minimum remaining lifetime a cached session must
+// have before we reuse it, anything shorter is refreshed with a new MFA code.
+const DefaultRefreshThreshold = 15 * time.Minute
+
+// SessionCache persists STS credentials on disk so that unexpired sessions can be
+// reused across terminals without prompting for MFA again.  Each entry is keyed by
+// the base profile and the role ARN that was assumed (empty for the MFA session).
+type SessionCache struct {
+	dir              string
+	refreshThreshold time.Duration
+	now              func() time.Time // Overridable so tests can travel through time
+}
+
+// NewSessionCache creates a cache rooted at dir, the directory is created lazily
+// on the first write.
+func NewSessionCache(dir string, refreshThreshold time.Duration) *SessionCache {
+	return &SessionCache{
+		dir:              dir,
+		refreshThreshold: refreshThreshold,
+		now:              time.Now,
+	}
+}
+
+// DefaultSessionCacheDir returns the per-user cache directory, i.e.
+// ~/.cache/aws-login/sessions on Linux or ~/Library/Caches/aws-login/sessions on macOS
+func DefaultSessionCacheDir() (string, error) {
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get cache directory: %w", err)
+	}
+
+	return filepath.Join(cacheDir, "aws-login", "sessions"), nil
+}
+
+// Get returns the cached credentials for the profile and role, as long as they
+// outlive the refresh threshold.
+func (c *SessionCache) Get(profile, roleArn string) (*types.Credentials, bool) {
+	data, err := os.ReadFile(c.path(profile, roleArn))
+	if err != nil {
+		return nil, false
+	}
+
+	var credentials types.Credentials
+	if err := json.Unmarshal(data, &credentials); err != nil {
+		return nil, false
+	}
+
+	expiration, err := time.Parse(time.RFC3339, credentials.Expiration)
+	if err != nil {
+		return nil, false
+	}
+
+	if expiration.Sub(c.now()) < c.refreshThreshold {
+		return nil, false
+	}
+
+	return &credentials, true
+}
+
+// Put stores the credentials for the profile and role, the file is only readable
+// by the current user as it holds a live session.
+func (c *SessionCache) Put(profile, roleArn string, credentials *types.Credentials) error {
+	if err := os.MkdirAll(c.dir, 0700); err != nil {
+		return fmt.Errorf("failed to create session cache directory: %w", err)
+	}
+
+	data, err := json.MarshalIndent(credentials, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal cached session: %w", err)
+	}
+
+	if err := os.WriteFile(c.path(profile, roleArn), data, 0600); err != nil {
+		return fmt.Errorf("failed to write cached session: %w", err)
+	}
+
+	return nil
+}
+
+// path hashes the key so profile names and ARNs never have to be escaped
+func (c *SessionCache) path(profile, roleArn string) string {
+	sum := sha256.Sum256([]byte(profile + "\x00" + roleArn))
+	return filepath.Join(c.dir, hex.EncodeToString(sum[:])+".json")
+}
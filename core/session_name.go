@@ -0,0 +1,65 @@
+package core
+
+import (
+	"os"
+	"os/user"
+	"strings"
+)
+
+// STS limits role session names (and source identities) to 64 characters from this set
+const (
+	maxSessionNameLength = 64
+	sessionNameChars     = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789+=,.@-_"
+)
+
+// expandSessionName replaces the {user}, {host} and {profile} placeholders so the
+// session shows up in CloudTrail as something identifiable, i.e. "{user}-{host}"
+// becomes "alex-macbook".  Characters STS would reject are replaced with a dash.
+func expandSessionName(template, profile string) string {
+	if template == "" {
+		return ""
+	}
+
+	name := strings.NewReplacer(
+		"{user}", currentUsername(),
+		"{host}", shortHostname(),
+		"{profile}", profile,
+	).Replace(template)
+
+	name = strings.Map(func(r rune) rune {
+		if strings.ContainsRune(sessionNameChars, r) {
+			return r
+		}
+		return '-'
+	}, name)
+
+	if len(name) > maxSessionNameLength {
+		name = name[:maxSessionNameLength]
+	}
+
+	return name
+}
+
+func currentUsername() string {
+	if current, err := user.Current(); err == nil && current.Username != "" {
+		// Windows usernames are DOMAIN\user, only the user part is interesting
+		username := current.Username
+		if i := strings.LastIndex(username, `\`); i >= 0 {
+			username = username[i+1:]
+		}
+		return username
+	}
+
+	return os.Getenv("USER")
+}
+
+func shortHostname() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		return ""
+	}
+
+	// macbook.local -> macbook
+	hostname, _, _ = strings.Cut(hostname, ".")
+	return hostname
+}
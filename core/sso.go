@@ -0,0 +1,370 @@
+package core
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/alexmk92/aws-login/core/aws_client"
+	"github.com/alexmk92/aws-login/core/types"
+)
+
+// SSOClientName is how we register with IAM Identity Center, it's shown to the user
+// when they approve the login
+const SSOClientName = "aws-login"
+
+// A cached SSO token is only reused while it has at least this long left, otherwise
+// it could expire half way through fetching role credentials
+const ssoTokenRefreshThreshold = time.Minute
+
+// ssoCachedToken matches the files the AWS CLI writes to ~/.aws/sso/cache, so a login
+// with `aws sso login` is picked up by us and vice versa
+type ssoCachedToken struct {
+	StartURL              string `json:"startUrl"`
+	Region                string `json:"region"`
+	AccessToken           string `json:"accessToken,omitempty"`
+	ExpiresAt             string `json:"expiresAt,omitempty"`
+	ClientID              string `json:"clientId,omitempty"`
+	ClientSecret          string `json:"clientSecret,omitempty"`
+	RegistrationExpiresAt string `json:"registrationExpiresAt,omitempty"`
+}
+
+// DefaultSSOCacheDir returns the AWS CLI's SSO token cache, ~/.aws/sso/cache
+func DefaultSSOCacheDir() (string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %w", err)
+	}
+
+	return filepath.Join(homeDir, ".aws", "sso", "cache"), nil
+}
+
+// SetSSOCacheDir changes where SSO tokens are cached, an empty dir keeps them in memory
+func (s *AWSService) SetSSOCacheDir(dir string) {
+	s.ssoCacheDir = dir
+}
+
+// IsSSOProfile reports whether the profile logs in through IAM Identity Center
+func (s *AWSService) IsSSOProfile(profile string) bool {
+	credentials, err := s.GetCredentials(profile)
+	return err == nil && credentials.UsesSSO()
+}
+
+// ssoSessionFor resolves the start URL and region for the profile, either from the
+// [sso-session] it names or from the legacy keys on the profile itself
+func (s *AWSService) ssoSessionFor(profile string) (types.SSOSession, error) {
+	credentials, err := s.GetCredentials(profile)
+	if err != nil {
+		return types.SSOSession{}, err
+	}
+
+	session := types.SSOSession{StartURL: credentials.SSOStartURL, Region: credentials.SSORegion}
+	if credentials.SSOSession != "" {
+		configured, ok := s.credentialReader.GetSSOSession(credentials.SSOSession)
+		if !ok {
+			return types.SSOSession{}, fmt.Errorf("profile '%s' uses sso_session '%s' but there is no [sso-session %s] section", profile, credentials.SSOSession, credentials.SSOSession)
+		}
+		session = configured
+	}
+
+	if session.StartURL == "" || session.Region == "" {
+		return types.SSOSession{}, fmt.Errorf("sso_start_url and sso_region are required for profile '%s'", profile)
+	}
+
+	return session, nil
+}
+
+// ssoCacheKey names the cache file the same way the AWS CLI does, by the session name
+// when there is one and by the start URL otherwise
+func ssoCacheKey(session types.SSOSession) string {
+	key := session.StartURL
+	if session.Name != "" {
+		key = session.Name
+	}
+
+	sum := sha1.Sum([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+func (s *AWSService) readSSOCache(session types.SSOSession) (ssoCachedToken, bool) {
+	key := ssoCacheKey(session)
+	if cached, ok := s.ssoTokens[key]; ok {
+		return cached, true
+	}
+
+	if s.ssoCacheDir == "" {
+		return ssoCachedToken{}, false
+	}
+
+	data, err := os.ReadFile(filepath.Join(s.ssoCacheDir, key+".json"))
+	if err != nil {
+		return ssoCachedToken{}, false
+	}
+
+	var cached ssoCachedToken
+	if err := json.Unmarshal(data, &cached); err != nil {
+		return ssoCachedToken{}, false
+	}
+
+	return cached, true
+}
+
+// writeSSOCache keeps the token in memory and, when there is a cache directory, on
+// disk for the next login (and the AWS CLI).  Failing to write the file is not
+// fatal as the token still works for this login.
+func (s *AWSService) writeSSOCache(session types.SSOSession, cached ssoCachedToken) {
+	key := ssoCacheKey(session)
+	if s.ssoTokens == nil {
+		s.ssoTokens = make(map[string]ssoCachedToken)
+	}
+	s.ssoTokens[key] = cached
+
+	if s.ssoCacheDir == "" {
+		return
+	}
+
+	data, err := json.MarshalIndent(cached, "", "  ")
+	if err != nil {
+		return
+	}
+	if err := os.MkdirAll(s.ssoCacheDir, 0700); err != nil {
+		return
+	}
+	_ = os.WriteFile(filepath.Join(s.ssoCacheDir, key+".json"), data, 0600)
+}
+
+// parseSSOTime reads the timestamps in the cache, older AWS CLI versions wrote
+// them as 2006-01-02T15:04:05UTC rather than RFC 3339
+func parseSSOTime(value string) (time.Time, bool) {
+	for _, layout := range []string{time.RFC3339, "2006-01-02T15:04:05UTC"} {
+		if parsed, err := time.Parse(layout, value); err == nil {
+			return parsed, true
+		}
+	}
+
+	return time.Time{}, false
+}
+
+// ssoAccessToken returns the cached access token for the profile, as long as it has
+// more than ssoTokenRefreshThreshold left
+func (s *AWSService) ssoAccessToken(profile string) (string, types.SSOSession, bool) {
+	session, err := s.ssoSessionFor(profile)
+	if err != nil {
+		return "", session, false
+	}
+
+	cached, ok := s.readSSOCache(session)
+	if !ok || cached.AccessToken == "" {
+		return "", session, false
+	}
+
+	expiresAt, ok := parseSSOTime(cached.ExpiresAt)
+	if !ok || time.Until(expiresAt) < ssoTokenRefreshThreshold {
+		return "", session, false
+	}
+
+	return cached.AccessToken, session, true
+}
+
+// HasSSOToken reports whether the browser login can be skipped for the profile
+func (s *AWSService) HasSSOToken(profile string) bool {
+	_, _, ok := s.ssoAccessToken(profile)
+	return ok
+}
+
+// StartSSOLogin registers with IAM Identity Center (reusing a cached registration)
+// and starts a device authorization, the user must approve it in the browser at
+// VerificationURIComplete before WaitForSSOLogin returns.
+func (s *AWSService) StartSSOLogin(profile string) (*aws_client.SSODeviceAuthorization, error) {
+	session, err := s.ssoSessionFor(profile)
+	if err != nil {
+		return nil, err
+	}
+
+	cached, _ := s.readSSOCache(session)
+	cached.StartURL = session.StartURL
+	cached.Region = session.Region
+
+	registration := aws_client.SSOClientRegistration{ClientID: cached.ClientID, ClientSecret: cached.ClientSecret}
+	registrationExpiresAt, ok := parseSSOTime(cached.RegistrationExpiresAt)
+	if cached.ClientID == "" || !ok || time.Until(registrationExpiresAt) < time.Hour {
+		registered, err := s.apiClient.RegisterClient(context.Background(), session.Region, SSOClientName, session.RegistrationScopes)
+		if err != nil {
+			return nil, classifyError("failed to register with IAM Identity Center", err)
+		}
+		registration = *registered
+
+		cached.ClientID = registration.ClientID
+		cached.ClientSecret = registration.ClientSecret
+		cached.RegistrationExpiresAt = registration.ExpiresAt.UTC().Format(time.RFC3339)
+		s.writeSSOCache(session, cached)
+	}
+
+	authorization, err := s.apiClient.StartDeviceAuthorization(context.Background(), session.Region, registration, session.StartURL)
+	if err != nil {
+		return nil, classifyError("failed to start IAM Identity Center login", err)
+	}
+
+	return authorization, nil
+}
+
+// WaitForSSOLogin polls until the user approves the device authorization, the
+// authorization expires or the context is cancelled.  The access token is cached
+// for the next login.
+func (s *AWSService) WaitForSSOLogin(ctx context.Context, profile string, authorization *aws_client.SSODeviceAuthorization) error {
+	session, err := s.ssoSessionFor(profile)
+	if err != nil {
+		return err
+	}
+
+	cached, _ := s.readSSOCache(session)
+	registration := aws_client.SSOClientRegistration{ClientID: cached.ClientID, ClientSecret: cached.ClientSecret}
+
+	interval := authorization.Interval
+	for {
+		token, err := s.apiClient.CreateToken(ctx, session.Region, registration, authorization.DeviceCode)
+		if err == nil {
+			cached.StartURL = session.StartURL
+			cached.Region = session.Region
+			cached.AccessToken = token.AccessToken
+			cached.ExpiresAt = token.ExpiresAt.UTC().Format(time.RFC3339)
+			s.writeSSOCache(session, cached)
+			return nil
+		}
+
+		var apiErr *aws_client.APIError
+		if !errors.As(err, &apiErr) || (apiErr.Code != aws_client.SSOErrorAuthorizationPending && apiErr.Code != aws_client.SSOErrorSlowDown) {
+			return classifyError("failed to complete IAM Identity Center login", err)
+		}
+
+		// RFC 8628 asks us to back off by 5 seconds every time we're told to slow down
+		if apiErr.Code == aws_client.SSOErrorSlowDown {
+			interval += 5 * time.Second
+		}
+
+		if time.Now().Add(interval).After(authorization.ExpiresAt) {
+			return fmt.Errorf("the IAM Identity Center login was not approved in time, log in again")
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(interval):
+		}
+	}
+}
+
+// GetSSORoles lists every role the user can use across all of their accounts,
+// ordered by account name then role name
+func (s *AWSService) GetSSORoles(profile string) ([]types.SSORole, error) {
+	accessToken, session, ok := s.ssoAccessToken(profile)
+	if !ok {
+		return nil, fmt.Errorf("no IAM Identity Center session for profile '%s', log in first", profile)
+	}
+
+	accounts, err := s.apiClient.ListAccounts(context.Background(), session.Region, accessToken)
+	if err != nil {
+		return nil, s.ssoError(session, "failed to list IAM Identity Center accounts", err)
+	}
+
+	var roles []types.SSORole
+	for _, account := range accounts {
+		roleNames, err := s.apiClient.ListAccountRoles(context.Background(), session.Region, accessToken, account.AccountID)
+		if err != nil {
+			return nil, s.ssoError(session, fmt.Sprintf("failed to list roles for account %s", account.AccountID), err)
+		}
+
+		for _, roleName := range roleNames {
+			roles = append(roles, types.SSORole{AccountID: account.AccountID, AccountName: account.AccountName, RoleName: roleName})
+		}
+	}
+
+	sort.SliceStable(roles, func(i, j int) bool {
+		if roles[i].AccountName != roles[j].AccountName {
+			return roles[i].AccountName < roles[j].AccountName
+		}
+		return roles[i].RoleName < roles[j].RoleName
+	})
+
+	return roles, nil
+}
+
+// resolveSSORole converts the role value supplied by the user into ACCOUNT_ID/ROLE_NAME.
+// The role may already be in that format, or name a profile with sso_account_id and
+// sso_role_name.  An empty role uses the account and role configured on the profile,
+// and is empty itself when the user still has to pick one.
+func (s *AWSService) resolveSSORole(profile, role string) (string, error) {
+	if role == "" {
+		role = profile
+	}
+
+	if accountID, roleName, ok := strings.Cut(role, "/"); ok {
+		if accountID == "" || roleName == "" {
+			return "", fmt.Errorf("expected ACCOUNT_ID/ROLE_NAME, got '%s'", role)
+		}
+		return role, nil
+	}
+
+	credentials, err := s.GetCredentials(role)
+	if err != nil {
+		return "", err
+	}
+
+	if credentials.SSOAccountID == "" || credentials.SSORoleName == "" {
+		if role == profile {
+			return "", nil
+		}
+		return "", fmt.Errorf("profile '%s' does not define sso_account_id and sso_role_name", role)
+	}
+
+	return types.SSORole{AccountID: credentials.SSOAccountID, RoleName: credentials.SSORoleName}.Key(), nil
+}
+
+// SSOLogin exchanges the IAM Identity Center token for credentials for the role, which
+// is given as ACCOUNT_ID/ROLE_NAME.  Like GetSessionToken the credentials are cached,
+// persisted to the environment and written to the session file.
+func (s *AWSService) SSOLogin(profile, role string) (bool, error) {
+	accountID, roleName, ok := strings.Cut(role, "/")
+	if !ok {
+		return false, fmt.Errorf("expected ACCOUNT_ID/ROLE_NAME, got '%s'", role)
+	}
+
+	accessToken, session, ok := s.ssoAccessToken(profile)
+	if !ok {
+		return false, fmt.Errorf("no IAM Identity Center session for profile '%s', log in first", profile)
+	}
+
+	credentials, err := s.apiClient.GetRoleCredentials(context.Background(), session.Region, accessToken, accountID, roleName)
+	if err != nil {
+		return false, s.ssoError(session, fmt.Sprintf("failed to get credentials for %s", role), err)
+	}
+
+	s.sessionProfile = profile
+	s.assumedRoleArn = role
+	s.cacheCredentials(profile, role, credentials)
+
+	return s.persistCredentials(credentials, profile)
+}
+
+// ssoError classifies the error, forgetting the cached token when IAM Identity Center
+// no longer accepts it so the next login goes back to the browser
+func (s *AWSService) ssoError(session types.SSOSession, op string, err error) error {
+	classified := classifyError(op, err)
+	if IsErrorKind(classified, ErrorKindSSOSessionExpired) {
+		if cached, ok := s.readSSOCache(session); ok {
+			cached.AccessToken = ""
+			cached.ExpiresAt = ""
+			s.writeSSOCache(session, cached)
+		}
+	}
+
+	return classified
+}
@@ -0,0 +1,233 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/alexmk92/aws-login/core/aws_client"
+	"github.com/alexmk92/aws-login/core/types"
+)
+
+const ssoTestConfig = `[profile work]
+sso_session = corp
+region = eu-west-2
+
+[profile work-admin]
+sso_session = corp
+sso_account_id = 111111111111
+sso_role_name = Admin
+
+[profile legacy]
+sso_start_url = https://legacy.awsapps.com/start
+sso_region = us-east-1
+
+[sso-session corp]
+sso_start_url = https://corp.awsapps.com/start
+sso_region = eu-west-2
+sso_registration_scopes = sso:account:access`
+
+func newSSOTestCredentialReader(t *testing.T) *CredentialReader {
+	t.Helper()
+
+	cr := NewCredentialReader()
+	cr.clearCredentials()
+	if err := cr.loadConfigFromContent(ssoTestConfig); err != nil {
+		t.Fatalf("Failed to load test config: %v", err)
+	}
+
+	return cr
+}
+
+func TestCredentialReader_SSOSessions(t *testing.T) {
+	cr := newSSOTestCredentialReader(t)
+
+	session, ok := cr.GetSSOSession("corp")
+	if !ok {
+		t.Fatalf("Expected the corp sso-session to be parsed")
+	}
+	if session.StartURL != "https://corp.awsapps.com/start" || session.Region != "eu-west-2" {
+		t.Errorf("Unexpected sso-session %+v", session)
+	}
+	if len(session.RegistrationScopes) != 1 || session.RegistrationScopes[0] != "sso:account:access" {
+		t.Errorf("Expected the registration scopes, got %v", session.RegistrationScopes)
+	}
+
+	// The sso-session section must not turn into a profile
+	if _, ok := cr.GetCredential("corp"); ok {
+		t.Errorf("Expected no 'corp' profile")
+	}
+
+	admin, ok := cr.GetCredential("work-admin")
+	if !ok {
+		t.Fatalf("Expected the work-admin profile")
+	}
+	if !admin.UsesSSO() || admin.SSOAccountID != "111111111111" || admin.SSORoleName != "Admin" {
+		t.Errorf("Unexpected profile %+v", admin)
+	}
+
+	valid := cr.GetValidProfiles()
+	for _, profile := range []string{"work", "work-admin", "legacy"} {
+		found := false
+		for _, name := range valid {
+			found = found || name == profile
+		}
+		if !found {
+			t.Errorf("Expected '%s' in the valid profiles, got %v", profile, valid)
+		}
+	}
+}
+
+func TestAWSService_ResolveSSORole(t *testing.T) {
+	awsService := &AWSService{credentialReader: newSSOTestCredentialReader(t)}
+
+	tests := []struct {
+		name        string
+		profile     string
+		role        string
+		expected    string
+		expectError bool
+	}{
+		{name: "account and role", profile: "work", role: "222222222222/ReadOnly", expected: "222222222222/ReadOnly"},
+		{name: "profile naming a role", profile: "work", role: "work-admin", expected: "111111111111/Admin"},
+		{name: "role configured on the profile", profile: "work-admin", expected: "111111111111/Admin"},
+		{name: "no role configured", profile: "work", expected: ""},
+		{name: "profile without a role", profile: "work", role: "legacy", expectError: true},
+		{name: "missing role name", profile: "work", role: "222222222222/", expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			role, err := awsService.ResolveRole(tt.profile, tt.role)
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("Expected error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if role != tt.expected {
+				t.Errorf("Expected '%s', got '%s'", tt.expected, role)
+			}
+		})
+	}
+}
+
+func TestAWSService_SSOLogin(t *testing.T) {
+	expired := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if expired {
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprint(w, `{"message":"Session token not found or invalid"}`)
+			return
+		}
+
+		switch r.URL.Path {
+		case "/client/register":
+			fmt.Fprint(w, `{"clientId":"client","clientSecret":"secret","clientSecretExpiresAt":4070908800}`)
+		case "/device_authorization":
+			fmt.Fprint(w, `{"deviceCode":"device","userCode":"ABCD-EFGH","verificationUri":"https://device.sso.example",
+				"verificationUriComplete":"https://device.sso.example?user_code=ABCD-EFGH","expiresIn":600,"interval":1}`)
+		case "/token":
+			fmt.Fprint(w, `{"accessToken":"access-token","expiresIn":28800}`)
+		case "/assignment/accounts":
+			fmt.Fprint(w, `{"accountList":[{"accountId":"222222222222","accountName":"prd"},{"accountId":"111111111111","accountName":"int"}]}`)
+		case "/assignment/roles":
+			fmt.Fprint(w, `{"roleList":[{"roleName":"ReadOnly"},{"roleName":"Admin"}]}`)
+		case "/federation/credentials":
+			fmt.Fprint(w, `{"roleCredentials":{"accessKeyId":"ASIASSO","secretAccessKey":"secret","sessionToken":"token","expiration":4070908800000}}`)
+		default:
+			t.Errorf("Unexpected path %s", r.URL.Path)
+		}
+	}))
+	defer server.Close()
+
+	t.Setenv("AWS_ACCESS_KEY_ID", "")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "")
+	t.Setenv("AWS_SESSION_TOKEN", "")
+	t.Setenv("AWS_PROFILE", "")
+
+	cacheDir := t.TempDir()
+	awsService := &AWSService{
+		credentialReader: newSSOTestCredentialReader(t),
+		apiClient:        aws_client.NewClient(aws_client.Config{SSOOIDCEndpoint: server.URL, SSOEndpoint: server.URL}),
+		sessionCache:     NewSessionCache(t.TempDir(), DefaultRefreshThreshold),
+		ssoCacheDir:      cacheDir,
+	}
+
+	if !awsService.IsSSOProfile("work") || awsService.HasSSOToken("work") {
+		t.Fatalf("Expected an SSO profile without a token")
+	}
+
+	authorization, err := awsService.StartSSOLogin("work")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if authorization.UserCode != "ABCD-EFGH" {
+		t.Errorf("Expected the user code, got %+v", authorization)
+	}
+	if err := awsService.WaitForSSOLogin(context.Background(), "work", authorization); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// The token is cached where the AWS CLI looks for it, keyed by the session name
+	data, err := os.ReadFile(filepath.Join(cacheDir, ssoCacheKey(types.SSOSession{Name: "corp"})+".json"))
+	if err != nil {
+		t.Fatalf("Expected the token to be cached: %v", err)
+	}
+	var cached ssoCachedToken
+	if err := json.Unmarshal(data, &cached); err != nil {
+		t.Fatalf("Failed to parse the cached token: %v", err)
+	}
+	if cached.AccessToken != "access-token" || cached.StartURL != "https://corp.awsapps.com/start" || cached.ClientID != "client" {
+		t.Errorf("Unexpected cached token %+v", cached)
+	}
+
+	// A fresh service picks the token up from disk, as does any profile using the session
+	restored := &AWSService{credentialReader: awsService.credentialReader, ssoCacheDir: cacheDir}
+	if !restored.HasSSOToken("work-admin") {
+		t.Errorf("Expected the cached token to be shared by the session's profiles")
+	}
+
+	roles, err := awsService.GetSSORoles("work")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := []string{"111111111111/Admin", "111111111111/ReadOnly", "222222222222/Admin", "222222222222/ReadOnly"}
+	if len(roles) != len(expected) {
+		t.Fatalf("Expected %d roles, got %+v", len(expected), roles)
+	}
+	for i := range expected {
+		if roles[i].Key() != expected[i] {
+			t.Errorf("Expected role %d to be '%s', got '%s'", i, expected[i], roles[i].Key())
+		}
+	}
+
+	if _, err := awsService.SSOLogin("work", "111111111111/Admin"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if awsService.assumedRoleArn != "111111111111/Admin" || !awsService.HasCachedSession("work", "111111111111/Admin", "work") {
+		t.Errorf("Expected the role session to be cached")
+	}
+	if os.Getenv("AWS_ACCESS_KEY_ID") != "ASIASSO" || os.Getenv("AWS_PROFILE") != "work" {
+		t.Errorf("Expected the role credentials to be persisted to the environment")
+	}
+
+	// Once IAM Identity Center rejects the token we forget it, so the next login
+	// goes back to the browser
+	expired = true
+	_, err = awsService.SSOLogin("work", "222222222222/Admin")
+	if !IsErrorKind(err, ErrorKindSSOSessionExpired) {
+		t.Errorf("Expected an expired SSO session error, got %v", err)
+	}
+	if awsService.HasSSOToken("work") {
+		t.Errorf("Expected the rejected token to be cleared")
+	}
+}
@@ -0,0 +1,151 @@
+package core
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alexmk92/aws-login/core/types"
+)
+
+// ParseTOTPSeed parses an otpauth:// URI (the text encoded in an authenticator QR code)
+// or a bare base32 secret, anything the URI leaves out falls back to the RFC 6238
+// defaults of 6 digits every 30 seconds with SHA1, which is what AWS uses.
+//
+//	otpauth://totp/Amazon%20Web%20Services:alex@prd?secret=JBSWY3DPEHPK3PXP&issuer=Amazon%20Web%20Services
+func ParseTOTPSeed(value string) (types.TOTPSeed, error) {
+	value = strings.TrimSpace(value)
+	seed := types.TOTPSeed{Algorithm: "SHA1", Digits: 6, Period: int(MFACodePeriod.Seconds())}
+
+	if !strings.HasPrefix(strings.ToLower(value), "otpauth://") {
+		seed.Secret = normaliseTOTPSecret(value)
+		if _, err := decodeTOTPSecret(seed.Secret); err != nil {
+			return seed, err
+		}
+		return seed, nil
+	}
+
+	uri, err := url.Parse(value)
+	if err != nil {
+		return seed, fmt.Errorf("invalid otpauth URI: %w", err)
+	}
+	if !strings.EqualFold(uri.Host, "totp") {
+		return seed, fmt.Errorf("unsupported OTP type '%s', only totp is supported", uri.Host)
+	}
+
+	// The label is ISSUER:ACCOUNT or just ACCOUNT
+	label := strings.TrimPrefix(uri.Path, "/")
+	if issuer, account, ok := strings.Cut(label, ":"); ok {
+		seed.Issuer, seed.Account = strings.TrimSpace(issuer), strings.TrimSpace(account)
+	} else {
+		seed.Account = strings.TrimSpace(label)
+	}
+
+	query := uri.Query()
+	if issuer := query.Get("issuer"); issuer != "" {
+		seed.Issuer = issuer
+	}
+
+	seed.Secret = normaliseTOTPSecret(query.Get("secret"))
+	if seed.Secret == "" {
+		return seed, fmt.Errorf("otpauth URI has no secret")
+	}
+	if _, err := decodeTOTPSecret(seed.Secret); err != nil {
+		return seed, err
+	}
+
+	if algorithm := query.Get("algorithm"); algorithm != "" {
+		seed.Algorithm = strings.ToUpper(algorithm)
+		if _, err := totpHash(seed.Algorithm); err != nil {
+			return seed, err
+		}
+	}
+	if digits := query.Get("digits"); digits != "" {
+		if seed.Digits, err = strconv.Atoi(digits); err != nil || seed.Digits < 6 || seed.Digits > 8 {
+			return seed, fmt.Errorf("invalid digits '%s', expected 6 to 8", digits)
+		}
+	}
+	if period := query.Get("period"); period != "" {
+		if seed.Period, err = strconv.Atoi(period); err != nil || seed.Period <= 0 {
+			return seed, fmt.Errorf("invalid period '%s'", period)
+		}
+	}
+
+	return seed, nil
+}
+
+// GenerateTOTP computes the RFC 6238 code for the seed at the given time
+func GenerateTOTP(seed types.TOTPSeed, now time.Time) (string, error) {
+	key, err := decodeTOTPSecret(seed.Secret)
+	if err != nil {
+		return "", err
+	}
+
+	newHash, err := totpHash(seed.Algorithm)
+	if err != nil {
+		return "", err
+	}
+
+	digits, period := seed.Digits, seed.Period
+	if digits == 0 {
+		digits = 6
+	}
+	if period == 0 {
+		period = int(MFACodePeriod.Seconds())
+	}
+
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], uint64(now.Unix()/int64(period)))
+
+	mac := hmac.New(newHash, key)
+	mac.Write(counter[:])
+	sum := mac.Sum(nil)
+
+	// Dynamic truncation, see https://datatracker.ietf.org/doc/html/rfc4226#section-5.3
+	offset := sum[len(sum)-1] & 0x0f
+	code := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	modulus := uint32(1)
+	for range digits {
+		modulus *= 10
+	}
+
+	return fmt.Sprintf("%0*d", digits, code%modulus), nil
+}
+
+// normaliseTOTPSecret strips the spaces and padding authenticator apps add to make
+// secrets readable
+func normaliseTOTPSecret(secret string) string {
+	secret = strings.ToUpper(strings.ReplaceAll(strings.TrimSpace(secret), " ", ""))
+	return strings.TrimRight(secret, "=")
+}
+
+func decodeTOTPSecret(secret string) ([]byte, error) {
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(normaliseTOTPSecret(secret))
+	if err != nil || len(key) == 0 {
+		return nil, fmt.Errorf("invalid TOTP secret, expected a base32 string")
+	}
+	return key, nil
+}
+
+func totpHash(algorithm string) (func() hash.Hash, error) {
+	switch strings.ToUpper(algorithm) {
+	case "", "SHA1":
+		return sha1.New, nil
+	case "SHA256":
+		return sha256.New, nil
+	case "SHA512":
+		return sha512.New, nil
+	default:
+		return nil, fmt.Errorf("unsupported TOTP algorithm '%s'", algorithm)
+	}
+}
@@ -0,0 +1,329 @@
+package core
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/alexmk92/aws-login/core/types"
+)
+
+// TOTPPassphraseEnv opts in to unlocking the TOTP store from the environment, i.e. on
+// a machine without a keyring where nobody is around to type the passphrase
+const TOTPPassphraseEnv = "AWS_LOGIN_TOTP_PASSPHRASE"
+
+// The keyring account holding the generated passphrase
+const totpKeyringAccount = "totp-store"
+
+// OWASP's recommendation for PBKDF2-HMAC-SHA256
+const defaultTOTPKeyIterations = 600000
+
+// ErrTOTPStoreMissing is returned when nothing has been imported yet
+var ErrTOTPStoreMissing = errors.New("no TOTP seeds have been imported, run `aws-login mfa import`")
+
+// ErrTOTPPassphraseNeeded is returned when the passphrase hasn't been entered and
+// can't be found in the environment or the keyring, so the user has to be asked for it
+var ErrTOTPPassphraseNeeded = errors.New("the TOTP store passphrase is needed")
+
+// TOTPStore keeps authenticator seeds in a file encrypted with AES-256-GCM, the key is
+// derived from a passphrase the user enters, or one taken from the OS keyring (or
+// AWS_LOGIN_TOTP_PASSPHRASE).  Seeds are keyed by name, which is the profile's
+// vault_key (or the profile name).
+type TOTPStore struct {
+	path       string
+	runner     types.Runner
+	passphrase string // Entered by the user, it is only ever held in memory
+	iterations int    // Overridable so tests don't spend a second deriving keys
+}
+
+// totpStoreFile is the on-disk document, only the seeds are encrypted
+type totpStoreFile struct {
+	Version    int    `json:"version"`
+	Iterations int    `json:"iterations"`
+	Salt       string `json:"salt"`
+	Nonce      string `json:"nonce"`
+	Ciphertext string `json:"ciphertext"`
+}
+
+// NewTOTPStore creates a store backed by the file at path, the runner is used to
+// reach the OS keyring
+func NewTOTPStore(path string, runner types.Runner) *TOTPStore {
+	return &TOTPStore{
+		path:       path,
+		runner:     RunnerOrDefault(runner),
+		iterations: defaultTOTPKeyIterations,
+	}
+}
+
+// DefaultTOTPStorePath returns the per-user store, i.e. ~/.config/aws-login/totp.json
+// on Linux or ~/Library/Application Support/aws-login/totp.json on macOS
+func DefaultTOTPStorePath() (string, error) {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get config directory: %w", err)
+	}
+
+	return filepath.Join(configDir, "aws-login", "totp.json"), nil
+}
+
+// Exists reports whether any seeds have been imported
+func (s *TOTPStore) Exists() bool {
+	_, err := os.Stat(s.path)
+	return err == nil
+}
+
+// SetPassphrase unlocks the store with a passphrase the user entered, it wins over the
+// environment and the keyring
+func (s *TOTPStore) SetPassphrase(passphrase string) {
+	s.passphrase = passphrase
+}
+
+// NeedsPassphrase reports whether the user has to enter the passphrase before the
+// store can be read
+func (s *TOTPStore) NeedsPassphrase() bool {
+	if !s.Exists() {
+		return false
+	}
+
+	_, err := s.Passphrase()
+	return err != nil
+}
+
+// Passphrase returns the passphrase that unlocks the store, the error wraps
+// ErrTOTPPassphraseNeeded when the user has to be asked for it
+func (s *TOTPStore) Passphrase() (string, error) {
+	if s.passphrase != "" {
+		return s.passphrase, nil
+	}
+	if passphrase := os.Getenv(TOTPPassphraseEnv); passphrase != "" {
+		return passphrase, nil
+	}
+
+	passphrase, err := KeyringGet(s.runner, totpKeyringAccount)
+	if err != nil {
+		return "", fmt.Errorf("%w, it isn't in the keyring: %w", ErrTOTPPassphraseNeeded, err)
+	}
+
+	return passphrase, nil
+}
+
+// Seed decrypts the store and returns the named seed
+func (s *TOTPStore) Seed(name string) (types.TOTPSeed, error) {
+	passphrase, err := s.Passphrase()
+	if err != nil {
+		return types.TOTPSeed{}, err
+	}
+
+	seeds, err := s.Load(passphrase)
+	if err != nil {
+		return types.TOTPSeed{}, err
+	}
+
+	seed, ok := seeds[name]
+	if !ok {
+		return seed, fmt.Errorf("no TOTP seed named '%s', run `aws-login mfa import %s`", name, name)
+	}
+
+	return seed, nil
+}
+
+// Import adds (or replaces) the named seed.  When the store is created and no
+// passphrase has been entered, a random one is generated and kept in the OS keyring.
+func (s *TOTPStore) Import(name string, seed types.TOTPSeed) error {
+	passphrase, err := s.Passphrase()
+	if err != nil {
+		if s.Exists() {
+			return err
+		}
+		if passphrase, err = s.createKeyringPassphrase(); err != nil {
+			return err
+		}
+	}
+
+	seeds := make(map[string]types.TOTPSeed)
+	if s.Exists() {
+		if seeds, err = s.Load(passphrase); err != nil {
+			return err
+		}
+	}
+
+	seeds[name] = seed
+	return s.Save(passphrase, seeds)
+}
+
+// Names returns the names of every imported seed
+func (s *TOTPStore) Names() ([]string, error) {
+	passphrase, err := s.Passphrase()
+	if err != nil {
+		return nil, err
+	}
+
+	seeds, err := s.Load(passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(seeds))
+	for name := range seeds {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names, nil
+}
+
+// Load decrypts every seed in the store
+func (s *TOTPStore) Load(passphrase string) (map[string]types.TOTPSeed, error) {
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrTOTPStoreMissing
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read TOTP store: %w", err)
+	}
+
+	var file totpStoreFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse TOTP store: %w", err)
+	}
+	if file.Version != 1 {
+		return nil, fmt.Errorf("unsupported TOTP store version %d", file.Version)
+	}
+
+	salt, saltErr := hex.DecodeString(file.Salt)
+	nonce, nonceErr := hex.DecodeString(file.Nonce)
+	ciphertext, ciphertextErr := hex.DecodeString(file.Ciphertext)
+	if err := errors.Join(saltErr, nonceErr, ciphertextErr); err != nil {
+		return nil, fmt.Errorf("failed to parse TOTP store: %w", err)
+	}
+
+	gcm, err := totpCipher(passphrase, salt, file.Iterations)
+	if err != nil {
+		return nil, err
+	}
+
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		// A rejected passphrase the user entered is forgotten so it's asked for again
+		if passphrase == s.passphrase {
+			s.passphrase = ""
+		}
+		return nil, fmt.Errorf("failed to decrypt TOTP store, is the passphrase correct?")
+	}
+
+	seeds := make(map[string]types.TOTPSeed)
+	if err := json.Unmarshal(plaintext, &seeds); err != nil {
+		return nil, fmt.Errorf("failed to parse TOTP seeds: %w", err)
+	}
+
+	return seeds, nil
+}
+
+// Save encrypts the seeds with a fresh salt and nonce, the file is only readable by
+// the current user
+func (s *TOTPStore) Save(passphrase string, seeds map[string]types.TOTPSeed) error {
+	plaintext, err := json.Marshal(seeds)
+	if err != nil {
+		return fmt.Errorf("failed to marshal TOTP seeds: %w", err)
+	}
+
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return fmt.Errorf("failed to generate salt: %w", err)
+	}
+
+	gcm, err := totpCipher(passphrase, salt, s.iterations)
+	if err != nil {
+		return err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	data, err := json.MarshalIndent(totpStoreFile{
+		Version:    1,
+		Iterations: s.iterations,
+		Salt:       hex.EncodeToString(salt),
+		Nonce:      hex.EncodeToString(nonce),
+		Ciphertext: hex.EncodeToString(gcm.Seal(nil, nonce, plaintext, nil)),
+	}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal TOTP store: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.path), 0700); err != nil {
+		return fmt.Errorf("failed to create TOTP store directory: %w", err)
+	}
+
+	// Write to a temporary file and rename so an interrupted import never leaves a
+	// truncated store behind, losing every seed in it
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), ".totp.json-*")
+	if err != nil {
+		return fmt.Errorf("failed to write TOTP store: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write TOTP store: %w", err)
+	}
+	if err := tmp.Chmod(0600); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write TOTP store: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write TOTP store: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return fmt.Errorf("failed to write TOTP store: %w", err)
+	}
+
+	return nil
+}
+
+// createKeyringPassphrase generates a random passphrase for a new store and keeps it
+// in the OS keyring, so nothing has to be typed to unlock the store.  Without a keyring
+// the user has to choose a passphrase instead.
+func (s *TOTPStore) createKeyringPassphrase() (string, error) {
+	random := make([]byte, 32)
+	if _, err := rand.Read(random); err != nil {
+		return "", fmt.Errorf("failed to generate passphrase: %w", err)
+	}
+	passphrase := hex.EncodeToString(random)
+
+	if err := KeyringSet(s.runner, totpKeyringAccount, passphrase); err != nil {
+		return "", fmt.Errorf("%w, the keyring can't hold a generated one: %w", ErrTOTPPassphraseNeeded, err)
+	}
+
+	return passphrase, nil
+}
+
+func totpCipher(passphrase string, salt []byte, iterations int) (cipher.AEAD, error) {
+	if passphrase == "" {
+		return nil, fmt.Errorf("empty TOTP store passphrase")
+	}
+
+	key, err := pbkdf2.Key(sha256.New, passphrase, salt, iterations, 32)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive TOTP store key: %w", err)
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,140 @@
+package core
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/alexmk92/aws-login/core/coretest"
+	"github.com/alexmk92/aws-login/core/types"
+)
+
+func newTestTOTPStore(t *testing.T) *TOTPStore {
+	t.Helper()
+
+	store := NewTOTPStore(filepath.Join(t.TempDir(), "aws-login", "totp.json"), coretest.NewFakeRunner())
+	store.iterations = 1
+	return store
+}
+
+func TestTOTPStore_ImportAndSeed(t *testing.T) {
+	t.Setenv(TOTPPassphraseEnv, "correct horse battery staple")
+	store := newTestTOTPStore(t)
+
+	if store.Exists() {
+		t.Fatalf("Expected a new store not to exist")
+	}
+	if _, err := store.Seed("prd"); !errors.Is(err, ErrTOTPStoreMissing) {
+		t.Errorf("Expected ErrTOTPStoreMissing, got %v", err)
+	}
+
+	prd := types.TOTPSeed{Secret: "JBSWY3DPEHPK3PXP", Algorithm: "SHA1", Digits: 6, Period: 30}
+	stg := types.TOTPSeed{Secret: "GEZDGNBVGY3TQOJQ", Algorithm: "SHA1", Digits: 6, Period: 30}
+	if err := store.Import("prd", prd); err != nil {
+		t.Fatalf("Failed to import seed: %v", err)
+	}
+	if err := store.Import("stg", stg); err != nil {
+		t.Fatalf("Failed to import seed: %v", err)
+	}
+
+	seed, err := store.Seed("prd")
+	if err != nil {
+		t.Fatalf("Failed to read seed: %v", err)
+	}
+	if seed != prd {
+		t.Errorf("Expected seed %+v, got %+v", prd, seed)
+	}
+
+	names, err := store.Names()
+	if err != nil || !slices.Equal(names, []string{"prd", "stg"}) {
+		t.Errorf("Expected names [prd stg], got %v (%v)", names, err)
+	}
+
+	if _, err := store.Seed("dev"); err == nil {
+		t.Errorf("Expected an error for an unknown seed")
+	}
+
+	// The secret must never be written in the clear
+	data, err := os.ReadFile(store.path)
+	if err != nil {
+		t.Fatalf("Failed to read store: %v", err)
+	}
+	if strings.Contains(string(data), prd.Secret) {
+		t.Errorf("Store contains the plaintext secret")
+	}
+
+	info, err := os.Stat(store.path)
+	if err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("Expected store to be 0600, got %v (%v)", info.Mode().Perm(), err)
+	}
+
+	// The store is renamed into place, no temporary files are left behind
+	entries, err := os.ReadDir(filepath.Dir(store.path))
+	if err != nil || len(entries) != 1 {
+		t.Errorf("Expected only the store in its directory, got %v (%v)", entries, err)
+	}
+}
+
+func TestTOTPStore_WrongPassphrase(t *testing.T) {
+	t.Setenv(TOTPPassphraseEnv, "correct horse battery staple")
+	store := newTestTOTPStore(t)
+
+	if err := store.Import("prd", types.TOTPSeed{Secret: "JBSWY3DPEHPK3PXP"}); err != nil {
+		t.Fatalf("Failed to import seed: %v", err)
+	}
+
+	if _, err := store.Load("Tr0ub4dor&3"); err == nil {
+		t.Errorf("Expected decrypting with the wrong passphrase to fail")
+	}
+
+	t.Setenv(TOTPPassphraseEnv, "Tr0ub4dor&3")
+	if err := store.Import("stg", types.TOTPSeed{Secret: "GEZDGNBVGY3TQOJQ"}); err == nil {
+		t.Errorf("Expected importing with the wrong passphrase to fail")
+	}
+}
+
+func TestTOTPStore_EnteredPassphrase(t *testing.T) {
+	// Neither the environment nor the keyring (the fake runner has no secret-tool) can
+	// supply the passphrase, so it has to be entered
+	t.Setenv(TOTPPassphraseEnv, "")
+	store := newTestTOTPStore(t)
+
+	seed := types.TOTPSeed{Secret: "JBSWY3DPEHPK3PXP"}
+	if err := store.Import("prd", seed); !errors.Is(err, ErrTOTPPassphraseNeeded) {
+		t.Fatalf("Expected ErrTOTPPassphraseNeeded without a keyring, got %v", err)
+	}
+
+	store.SetPassphrase("correct horse battery staple")
+	if err := store.Import("prd", seed); err != nil {
+		t.Fatalf("Failed to import seed: %v", err)
+	}
+
+	// A new process has to ask for it again
+	store = NewTOTPStore(store.path, coretest.NewFakeRunner())
+	store.iterations = 1
+	if !store.NeedsPassphrase() {
+		t.Errorf("Expected the passphrase to be needed")
+	}
+	if _, err := store.Seed("prd"); !errors.Is(err, ErrTOTPPassphraseNeeded) {
+		t.Errorf("Expected ErrTOTPPassphraseNeeded, got %v", err)
+	}
+
+	store.SetPassphrase("Tr0ub4dor&3")
+	if _, err := store.Seed("prd"); err == nil {
+		t.Errorf("Expected the wrong passphrase to be rejected")
+	}
+	if !store.NeedsPassphrase() {
+		t.Errorf("Expected a rejected passphrase to be asked for again")
+	}
+
+	store.SetPassphrase("correct horse battery staple")
+	if _, err := store.Seed("prd"); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if store.NeedsPassphrase() {
+		t.Errorf("Expected the store to stay unlocked")
+	}
+}
@@ -0,0 +1,104 @@
+package core
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alexmk92/aws-login/core/types"
+)
+
+func TestGenerateTOTP(t *testing.T) {
+	// Test vectors from RFC 6238 appendix B, the secrets are the ASCII seeds in base32
+	sha1Seed := types.TOTPSeed{Secret: "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ", Algorithm: "SHA1", Digits: 8, Period: 30}
+	sha256Seed := types.TOTPSeed{Secret: "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQGEZA", Algorithm: "SHA256", Digits: 8, Period: 30}
+	sha512Seed := types.TOTPSeed{Secret: "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQGEZDGNA", Algorithm: "SHA512", Digits: 8, Period: 30}
+
+	tests := []struct {
+		name     string
+		seed     types.TOTPSeed
+		unix     int64
+		expected string
+	}{
+		{name: "sha1 at 59", seed: sha1Seed, unix: 59, expected: "94287082"},
+		{name: "sha1 at 1111111109", seed: sha1Seed, unix: 1111111109, expected: "07081804"},
+		{name: "sha1 at 20000000000", seed: sha1Seed, unix: 20000000000, expected: "65353130"},
+		{name: "sha256 at 59", seed: sha256Seed, unix: 59, expected: "46119246"},
+		{name: "sha512 at 1234567890", seed: sha512Seed, unix: 1234567890, expected: "93441116"},
+		{name: "defaults to 6 digits", seed: types.TOTPSeed{Secret: sha1Seed.Secret}, unix: 59, expected: "287082"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, err := GenerateTOTP(tt.seed, time.Unix(tt.unix, 0))
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if code != tt.expected {
+				t.Errorf("Expected code '%s', got '%s'", tt.expected, code)
+			}
+		})
+	}
+}
+
+func TestParseTOTPSeed(t *testing.T) {
+	tests := []struct {
+		name        string
+		value       string
+		expected    types.TOTPSeed
+		expectError bool
+	}{
+		{
+			name:     "otpauth URI from an AWS QR code",
+			value:    "otpauth://totp/Amazon%20Web%20Services:alex@123456789012?secret=JBSWY3DPEHPK3PXP&issuer=Amazon%20Web%20Services",
+			expected: types.TOTPSeed{Secret: "JBSWY3DPEHPK3PXP", Algorithm: "SHA1", Digits: 6, Period: 30, Issuer: "Amazon Web Services", Account: "alex@123456789012"},
+		},
+		{
+			name:     "otpauth URI with parameters",
+			value:    "otpauth://totp/prd?secret=jbswy3dpehpk3pxp&algorithm=sha256&digits=8&period=60",
+			expected: types.TOTPSeed{Secret: "JBSWY3DPEHPK3PXP", Algorithm: "SHA256", Digits: 8, Period: 60, Account: "prd"},
+		},
+		{
+			name:     "bare secret with spaces",
+			value:    "jbsw y3dp ehpk 3pxp\n",
+			expected: types.TOTPSeed{Secret: "JBSWY3DPEHPK3PXP", Algorithm: "SHA1", Digits: 6, Period: 30},
+		},
+		{
+			name:        "HOTP is not supported",
+			value:       "otpauth://hotp/prd?secret=JBSWY3DPEHPK3PXP&counter=0",
+			expectError: true,
+		},
+		{
+			name:        "missing secret",
+			value:       "otpauth://totp/prd?issuer=AWS",
+			expectError: true,
+		},
+		{
+			name:        "secret is not base32",
+			value:       "not-a-secret!",
+			expectError: true,
+		},
+		{
+			name:        "unsupported algorithm",
+			value:       "otpauth://totp/prd?secret=JBSWY3DPEHPK3PXP&algorithm=MD5",
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			seed, err := ParseTOTPSeed(tt.value)
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("Expected error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if seed != tt.expected {
+				t.Errorf("Expected seed %+v, got %+v", tt.expected, seed)
+			}
+		})
+	}
+}
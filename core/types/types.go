@@ -1,5 +1,12 @@
 package types
 
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
 // When I'm designing packages, I like to keep the types in a separate file from the main code.
 // the only types that should be in the main code are the ones that correspond to the service,
 // definition, such as the AWSService sruct in @aws.go
@@ -21,8 +28,96 @@ package types
 // This holds the final status for the auth flow, it is used
 // to display the result to the user.
 type AuthFlowResult struct {
-	User    string
-	ECRAuth bool
+	User                string
+	ECRResults          []ECRLoginResult          // One per registry, empty when ECR login was skipped
+	CodeArtifactResults []CodeArtifactLoginResult // One per repository, empty when CodeArtifact was skipped
+	EKSResults          []EKSLoginResult          // One per cluster, empty when the kubeconfig wasn't updated
+}
+
+// ECRRegistry identifies a private ECR registry, every account has one per region
+type ECRRegistry struct {
+	AccountID string
+	Region    string
+}
+
+// Host returns the registry hostname docker logs in to
+func (r ECRRegistry) Host() string {
+	return fmt.Sprintf("%s.dkr.ecr.%s.amazonaws.com", r.AccountID, r.Region)
+}
+
+// CodeArtifactRepository is a package repository in a CodeArtifact domain, Format is
+// the package manager we configure for it (npm, pypi, maven or go)
+type CodeArtifactRepository struct {
+	Format     string
+	Domain     string
+	Repository string
+}
+
+// CodeArtifactLoginResult holds the outcome of configuring a single repository
+type CodeArtifactLoginResult struct {
+	Repository CodeArtifactRepository
+	Err        error
+}
+
+// ECRLoginResult holds the outcome of logging in to a single registry
+type ECRLoginResult struct {
+	Registry ECRRegistry
+	Target   string // The tool we logged in to, i.e. docker or helm
+	Err      error
+}
+
+// EKSCluster identifies an EKS cluster, an empty Region means the profile's region
+type EKSCluster struct {
+	Name   string
+	Region string
+}
+
+// EKSLoginResult holds the outcome of adding a single cluster to the kubeconfig
+type EKSLoginResult struct {
+	Cluster EKSCluster
+	Context string // The kubeconfig context, the cluster ARN like `aws eks update-kubeconfig`
+	Err     error
+}
+
+// ExecCredential is the document kubectl expects on stdout from an exec credential
+// plugin, see:
+// https://kubernetes.io/docs/reference/access-authn-authz/authentication/#client-go-credential-plugins
+type ExecCredential struct {
+	Kind       string               `json:"kind"`
+	APIVersion string               `json:"apiVersion"`
+	Spec       struct{}             `json:"spec"`
+	Status     ExecCredentialStatus `json:"status"`
+}
+
+type ExecCredentialStatus struct {
+	ExpirationTimestamp string `json:"expirationTimestamp"`
+	Token               string `json:"token"`
+}
+
+// LoginOptions holds any values that were supplied up front (for example via
+// CLI flags), every populated field allows the flow to skip the matching step.
+type LoginOptions struct {
+	Profile string
+	Role    string // Either a profile name with an assumable role, or a raw role ARN
+	MFACode string
+}
+
+// AssumableRole is a role the user can pick.  Several profiles may declare the same
+// ARN, so the role is identified by the profile that declares it, Profile is empty
+// for a raw role ARN that doesn't belong to a single profile.
+type AssumableRole struct {
+	Arn         string
+	Profile     string
+	AccountID   string
+	DisplayName string // The role name without its path, i.e. OrganizationAccountAccessRole
+}
+
+// RoleHop is a single AssumeRole call in a role chain, Profile is the profile that
+// declares the role.  A raw role ARN is assumed as the base profile, so Profile is
+// never empty.
+type RoleHop struct {
+	Profile string
+	RoleArn string
 }
 
 // Credentials represents AWS temporary credentials
@@ -39,34 +134,193 @@ type Credentials struct {
 	Profile         string `json:"Profile"`
 }
 
-// AssumeRoleResponse represents the response from aws sts assume-role
-// serialization doesn't just apply to primitive types, it applies
-// to nested structs as well, in this example we are serializing the
-// Credentials struct to have the json key "Credentials" whos
-// values will be derived from the Credentials struct rules above.
-type AssumeRoleResponse struct {
-	Credentials     Credentials `json:"Credentials"`
-	AssumedRoleUser struct {
-		AssumedRoleId string `json:"AssumedRoleId"`
-		Arn           string `json:"Arn"`
-	} `json:"AssumedRoleUser"`
+// CredentialProcessOutput is the document the AWS SDKs expect on stdout from a
+// credential_process, see:
+// https://docs.aws.amazon.com/sdkref/latest/guide/feature-process-credentials.html
+//
+// Expiration is omitted when empty, the SDKs then treat the credentials as non-expiring
+type CredentialProcessOutput struct {
+	Version         int    `json:"Version"`
+	AccessKeyId     string `json:"AccessKeyId"`
+	SecretAccessKey string `json:"SecretAccessKey"`
+	SessionToken    string `json:"SessionToken"`
+	Expiration      string `json:"Expiration,omitempty"`
 }
 
-// STSResponse represents the AWS STS get-session-token response
-type STSResponse struct {
-	Credentials Credentials `json:"Credentials"`
+// SessionFile is the document written to /tmp/aws-session.json for the shell helper
+// to source.  Embedding the credential process output means the two documents
+// can never drift apart, json flattens embedded structs into the parent object.
+type SessionFile struct {
+	CredentialProcessOutput
+	ProfileName string            `json:"ProfileName"`
+	Env         map[string]string `json:"Env,omitempty"` // Extra variables to export, i.e. GOPROXY
 }
 
 // StaticCredential represents a static AWS credential from the credentials file
 // including our custom fields added for this project (AssumeableRoleID and VaultKey)
+//
+// Profiles from ~/.aws/config are merged into the same struct, so standard keys such
+// as role_arn end up alongside (or instead of) our custom ones.
 type StaticCredential struct {
 	ProfileName     string
 	AccessKey       string
 	AccessSecret    string
 	AccountID       string
 	MfaSerial       string
-	AssumableRoleID string // ARN of the role that can be assumed by this profile
+	AssumableRoleID string // ARN of the role that can be assumed by this profile (assumable_role_id or role_arn)
 	VaultKey        string // Key in the 1Password vault for this profile (or whatever the password vault is)
+	SourceProfile   string // Profile whose credentials are used to assume AssumableRoleID
+	Region          string
+	ExternalID      string
+
+	// keepassxc_database = ~/vault.kdbx, the database the keepassxc driver reads the
+	// VaultKey entry from.  Falls back to AWS_LOGIN_KEEPASSXC_DATABASE.
+	KeePassXCDatabase string
+
+	// assumable_roles = int,stg-*,123456789012, globs the roles offered to this profile
+	// must match by profile name, ARN or account ID.  Empty allows every role.
+	AssumableRoles []string
+
+	// STS parameters, zero values fall back to the defaults (see SessionOptions)
+	DurationSeconds        int               // Lifetime of the assumed role session
+	SessionDurationSeconds int               // Lifetime of the MFA session from GetSessionToken
+	RoleSessionName        string            // May contain {user}, {host} and {profile} placeholders
+	SourceIdentity         string            // May contain the same placeholders as RoleSessionName
+	SessionTags            map[string]string // session_tags = Key=Value,Key=Value
+
+	// ecr_registries = ACCOUNT:REGION,ACCOUNT:REGION, when empty we log in to the
+	// profile's own account in its region
+	ECRRegistries []ECRRegistry
+	ECRTargets    []string // ecr_login_targets = docker,helm
+
+	// codeartifact_repositories = FORMAT:DOMAIN/REPOSITORY,..., the owner and region
+	// default to the profile's account and region
+	CodeArtifactRepositories []CodeArtifactRepository
+	CodeArtifactDomainOwner  string
+	CodeArtifactRegion       string
+	CodeArtifactGoNoSumDB    string // GONOSUMDB patterns for modules served by CodeArtifact
+
+	// npm is pointed at the repository for a single scope, the global registry is only
+	// replaced when the user opts in
+	CodeArtifactNpmScope          string // codeartifact_npm_scope = @acme
+	CodeArtifactNpmGlobalRegistry bool   // codeartifact_npm_global_registry = true
+
+	EKSClusters []EKSCluster // eks_clusters = NAME,NAME:REGION
+
+	// IAM Identity Center, either sso_session names an [sso-session] section or the
+	// legacy sso_start_url/sso_region keys are set on the profile itself.  The account
+	// and role are optional, without them the user picks one after logging in.
+	SSOSession   string
+	SSOStartURL  string
+	SSORegion    string
+	SSOAccountID string
+	SSORoleName  string
+}
+
+// UsesSSO reports whether the profile logs in through IAM Identity Center rather
+// than with access keys and MFA
+func (c StaticCredential) UsesSSO() bool {
+	return c.SSOSession != "" || c.SSOStartURL != ""
+}
+
+// SSORole is a role (permission set) the user can use in an account, the key
+// ACCOUNT_ID/ROLE_NAME takes the place of a role ARN for IAM Identity Center profiles
+type SSORole struct {
+	AccountID   string
+	AccountName string
+	RoleName    string
+}
+
+// Key returns the role as ACCOUNT_ID/ROLE_NAME, the format --role accepts
+func (r SSORole) Key() string {
+	return r.AccountID + "/" + r.RoleName
+}
+
+// SSOSession is an [sso-session name] section from the config file
+type SSOSession struct {
+	Name               string
+	StartURL           string
+	Region             string
+	RegistrationScopes []string
+}
+
+// TOTPSeed is an authenticator secret enrolled with `aws-login mfa import`, it is only
+// ever written to disk inside the encrypted TOTP store
+type TOTPSeed struct {
+	Secret    string `json:"secret"` // Base32, as shown by the QR code
+	Algorithm string `json:"algorithm"`
+	Digits    int    `json:"digits"`
+	Period    int    `json:"period"` // Seconds
+	Issuer    string `json:"issuer,omitempty"`
+	Account   string `json:"account,omitempty"`
+}
+
+// SessionOptions overrides the STS parameters configured on a profile (for example
+// via CLI flags), zero values leave the profile value in place.
+type SessionOptions struct {
+	DurationSeconds        int
+	SessionDurationSeconds int
+	RoleSessionName        string
+	ExternalID             string
+	SourceIdentity         string
+	Tags                   map[string]string
+}
+
+// Command describes an external process to run, Env holds extra KEY=VALUE pairs
+// that are appended to the current process environment.  A command running for
+// longer than a non-zero Timeout is killed.
+type Command struct {
+	Name    string
+	Args    []string
+	Stdin   string
+	Env     []string
+	Timeout time.Duration
+}
+
+// CommandResult holds the captured output of a finished command
+type CommandResult struct {
+	Stdout   string
+	Stderr   string
+	ExitCode int
+}
+
+// Runner executes external commands.  Every process we spawn (docker, op, etc.)
+// goes through a Runner so that the whole flow can be exercised in tests with
+// canned output instead of real binaries.
+//
+// A non-zero exit code is returned as an error, the result is still populated
+// so callers can inspect stderr.
+type Runner interface {
+	Run(cmd Command) (CommandResult, error)
+}
+
+// ErrCommandTimeout is wrapped by the error of a command that was killed because it
+// ran past its Timeout
+var ErrCommandTimeout = errors.New("timed out")
+
+// CommandError is returned by runners when a command fails to start or exits with
+// a non-zero status, the message is taken from stderr as that is where every CLI
+// we use explains what went wrong.
+type CommandError struct {
+	Command string
+	Result  CommandResult
+	Err     error
+}
+
+func (e *CommandError) Error() string {
+	if stderr := strings.TrimSpace(e.Result.Stderr); stderr != "" {
+		// Whatever a killed command printed doesn't explain why it stopped
+		if errors.Is(e.Err, ErrCommandTimeout) {
+			return fmt.Sprintf("%s: %v: %s", e.Command, e.Err, stderr)
+		}
+		return fmt.Sprintf("%s: %s", e.Command, stderr)
+	}
+
+	return fmt.Sprintf("%s: %v", e.Command, e.Err)
+}
+
+func (e *CommandError) Unwrap() error {
+	return e.Err
 }
 
 // Driver defines the interface for authentication drivers
@@ -77,3 +331,11 @@ type Driver interface {
 	GetMFACode() (string, error)
 	IsInstalled() bool
 }
+
+// UnlockableDriver is a driver that needs a password to unlock the vault before it can
+// yield codes.  The TUI prompts for the password once, it is only ever held in memory.
+type UnlockableDriver interface {
+	Driver
+	NeedsPassword() bool // True until Unlock is called, and again once the password is rejected
+	Unlock(password string)
+}
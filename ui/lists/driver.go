@@ -1,11 +1,14 @@
 package lists
 
 import (
+	"sync"
+
 	"github.com/charmbracelet/bubbles/list"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
 
 	"github.com/alexmk92/aws-login/core/auth_drivers"
+	"github.com/alexmk92/aws-login/core/types"
 )
 
 // DriverItem represents an item in the driver selection list
@@ -20,15 +23,23 @@ func (i DriverItem) Title() string       { return i.title }
 func (i DriverItem) Description() string { return i.description }
 func (i DriverItem) FilterValue() string { return i.title }
 
+// PluginDriversMsg carries the driver plugins once they have described themselves,
+// plugins can be slow to answer so the list is shown without them at first
+type PluginDriversMsg struct {
+	items []DriverItem
+}
+
 // DriverListModel handles the driver selection UI
 type DriverListModel struct {
 	list     list.Model
+	runner   types.Runner
 	choice   auth_drivers.AuthDriverName
 	selected bool
 }
 
-// NewDriverListModel creates a new driver selection model
-func NewDriverListModel() DriverListModel {
+// NewDriverListModel creates a new driver selection model, the runner is used to
+// check which driver CLIs are installed.  Plugins are added by the command from Init.
+func NewDriverListModel(runner types.Runner) DriverListModel {
 	items := []list.Item{
 		DriverItem{
 			title:       "Manual",
@@ -40,7 +51,31 @@ func NewDriverListModel() DriverListModel {
 			title:       "1Password",
 			description: "Use 1Password CLI (requires 1Password CLI)",
 			driver:      auth_drivers.AuthDriver1Password,
-			available:   auth_drivers.OnePasswordDriver{}.IsInstalled(),
+			available:   auth_drivers.NewOnePasswordDriver("", runner).IsInstalled(),
+		},
+		DriverItem{
+			title:       "Bitwarden",
+			description: "Use Bitwarden CLI (requires bw), asks for the master password if the vault is locked",
+			driver:      auth_drivers.AuthDriverBitwarden,
+			available:   auth_drivers.NewBitwardenDriver("", runner).IsInstalled(),
+		},
+		DriverItem{
+			title:       "pass",
+			description: "Use the password store (requires gopass, or pass with pass-otp)",
+			driver:      auth_drivers.AuthDriverPass,
+			available:   auth_drivers.NewPassDriver("", runner).IsInstalled(),
+		},
+		DriverItem{
+			title:       "KeePassXC",
+			description: "Use keepassxc-cli, asks for the database password once",
+			driver:      auth_drivers.AuthDriverKeePassXC,
+			available:   auth_drivers.NewKeePassXCDriver("", runner).IsInstalled(),
+		},
+		DriverItem{
+			title:       "Local TOTP",
+			description: "Generate codes from a seed imported with `aws-login mfa import`",
+			driver:      auth_drivers.AuthDriverTOTP,
+			available:   auth_drivers.NewTOTPDriver("", runner).IsInstalled(),
 		},
 	}
 
@@ -61,13 +96,36 @@ func NewDriverListModel() DriverListModel {
 	l.Styles.HelpStyle = list.Styles{}.HelpStyle.MarginLeft(2)
 
 	return DriverListModel{
-		list: l,
+		list:   l,
+		runner: runner,
 	}
 }
 
-// Init initializes the driver selection model
+// Init asks the external drivers installed as aws-login-driver-* executables to
+// describe themselves, all at once so one slow plugin doesn't hold up the others
 func (m DriverListModel) Init() tea.Cmd {
-	return nil
+	runner := m.runner
+	return func() tea.Msg {
+		discovered := auth_drivers.DiscoverPlugins()
+		items := make([]DriverItem, len(discovered))
+
+		var wg sync.WaitGroup
+		for i, plugin := range discovered {
+			wg.Go(func() {
+				driver := auth_drivers.NewPluginDriver(plugin, "", runner)
+				title, description := driver.Describe()
+				items[i] = DriverItem{
+					title:       title,
+					description: description,
+					driver:      auth_drivers.RegisterPlugin(plugin),
+					available:   driver.IsInstalled(),
+				}
+			})
+		}
+		wg.Wait()
+
+		return PluginDriversMsg{items: items}
+	}
 }
 
 // Update handles messages for the driver selection model
@@ -76,6 +134,14 @@ func (m DriverListModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	case tea.WindowSizeMsg:
 		m.list.SetWidth(msg.Width)
 		return m, nil
+	case PluginDriversMsg:
+		items := m.list.Items()
+		for _, item := range msg.items {
+			if item.available {
+				items = append(items, item)
+			}
+		}
+		return m, m.list.SetItems(items)
 	case tea.KeyMsg:
 		if msg.String() == "enter" {
 			if i, ok := m.list.SelectedItem().(DriverItem); ok {
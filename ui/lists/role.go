@@ -2,20 +2,20 @@ package lists
 
 import (
 	"fmt"
-	"strings"
 
 	"github.com/charmbracelet/bubbles/list"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
 
 	"github.com/alexmk92/aws-login/core"
+	"github.com/alexmk92/aws-login/core/types"
 )
 
 // RoleItem represents an item in the role selection list
 type RoleItem struct {
 	title       string
-	role        string // the actual ARN to assume
-	description string // the description to render in the list
+	role        types.AssumableRole // the role to assume, along with the profile that declares it
+	description string              // the description to render in the list
 }
 
 func (i RoleItem) Title() string       { return i.title }
@@ -25,7 +25,7 @@ func (i RoleItem) FilterValue() string { return i.title }
 // RoleListModel handles the role selection UI
 type RoleListModel struct {
 	list     list.Model
-	choice   string
+	choice   types.AssumableRole
 	selected bool
 }
 
@@ -37,21 +37,15 @@ func NewRoleListModel(awsService *core.AWSService, profile string) RoleListModel
 	items := []list.Item{
 		RoleItem{
 			title:       profile,
-			role:        "",
 			description: fmt.Sprintf("Continue as the current user: [%s]", profile),
 		},
 	}
 
-	// Add role items
+	// Add role items, titled by profile as several profiles may share a role
 	for _, role := range roles {
-		// Get the profile name that has this assumable_role_id
-		profileName := awsService.GetAssumedProfileName(role)
-		roleParts := strings.Split(role, ":")
-		formattedRole := roleParts[len(roleParts)-1]
-
 		items = append(items, RoleItem{
-			title:       profileName,
-			description: fmt.Sprintf("Assume: [%s]", formattedRole),
+			title:       role.Profile,
+			description: fmt.Sprintf("Assume: [%s] in [%s]", role.DisplayName, role.AccountID),
 			role:        role,
 		})
 	}
@@ -66,11 +60,36 @@ func NewRoleListModel(awsService *core.AWSService, profile string) RoleListModel
 
 	return RoleListModel{
 		list:     l,
-		choice:   "",
 		selected: false,
 	}
 }
 
+// NewSSORoleListModel creates a role selection model for an IAM Identity Center profile,
+// every account and role the user has been assigned is an item.  There is no option to
+// continue as the current user as there is no user without a role.
+func NewSSORoleListModel(roles []types.SSORole) RoleListModel {
+	items := make([]list.Item, len(roles))
+	for i, role := range roles {
+		items[i] = RoleItem{
+			title:       fmt.Sprintf("%s [%s]", role.AccountName, role.AccountID),
+			description: fmt.Sprintf("Role: [%s]", role.RoleName),
+			role:        types.AssumableRole{Arn: role.Key(), AccountID: role.AccountID, DisplayName: role.RoleName},
+		}
+	}
+
+	l := list.New(items, list.NewDefaultDelegate(), 80, 20)
+	l.Title = "🔐 Select Account and Role"
+	l.SetShowStatusBar(false)
+	l.SetFilteringEnabled(false)
+	l.Styles.Title = lipgloss.NewStyle().MarginLeft(2).Bold(true)
+	l.Styles.PaginationStyle = list.Styles{}.PaginationStyle.MarginLeft(2)
+	l.Styles.HelpStyle = list.Styles{}.HelpStyle.MarginLeft(2)
+
+	return RoleListModel{
+		list: l,
+	}
+}
+
 // Init initializes the role selection model
 func (m RoleListModel) Init() tea.Cmd {
 	return nil
@@ -112,7 +131,7 @@ func (m RoleListModel) View() string {
 	return box.Render(m.list.View())
 }
 
-// GetChoice returns the selected role (empty string for "None")
+// GetChoice returns the selected types.AssumableRole (the zero value for "None")
 func (m RoleListModel) GetChoice() interface{} {
 	return m.choice
 }
@@ -58,7 +58,7 @@ func (f *ListService) GetActiveModel(state types.AppState, profile string) (tea.
 		profileModel := NewProfileListModel(awsSvc)
 		model = profileModel
 	case types.StateDriverSelection:
-		driverModel := NewDriverListModel()
+		driverModel := NewDriverListModel(f.awsService.Runner())
 		model = driverModel
 	case types.StateRoleSelection:
 		awsSvc := f.awsService
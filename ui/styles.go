@@ -59,3 +59,16 @@ func NewMFAInput() textinput.Model {
 	ti.PlaceholderStyle = accentStyle.Copy().Faint(true)
 	return ti
 }
+
+// NewPasswordInput creates a masked input for unlocking a password vault
+func NewPasswordInput() textinput.Model {
+	ti := textinput.New()
+	ti.Focus()
+	ti.Width = 40
+	ti.Prompt = "Password: "
+	ti.EchoMode = textinput.EchoPassword
+	ti.EchoCharacter = '•'
+	ti.PromptStyle = brandStyle
+	ti.TextStyle = accentStyle
+	return ti
+}
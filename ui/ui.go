@@ -1,8 +1,11 @@
 package ui
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"math/rand"
+	"strings"
 	"time"
 
 	"github.com/charmbracelet/bubbles/spinner"
@@ -12,12 +15,17 @@ import (
 
 	"github.com/alexmk92/aws-login/core"
 	"github.com/alexmk92/aws-login/core/auth_drivers"
+	"github.com/alexmk92/aws-login/core/aws_client"
 	coreTypes "github.com/alexmk92/aws-login/core/types"
 	"github.com/alexmk92/aws-login/ui/lists"
 )
 
 const MAX_UI_WIDTH = 80
 
+// errSessionExpired is returned when the cached session the MFA prompt was skipped
+// for is gone by the time we come to use it
+var errSessionExpired = errors.New("the cached session has expired, a new MFA code is needed")
+
 // UIManager represents the main UI state machine with a simplified linear flow
 type UIManager struct {
 	// Core dependencies
@@ -29,8 +37,28 @@ type UIManager struct {
 	// Flow data
 	profile        string
 	authDriverName auth_drivers.AuthDriverName
-	selectedRole   string
+	selectedRole   coreTypes.AssumableRole
+	presetRole     string
 	mfaCode        string
+	driver         coreTypes.Driver // Set once a driver has yielded an MFA code
+
+	// A driver waiting for the vault password, it is only ever held in memory
+	lockedDriver  coreTypes.UnlockableDriver
+	passwordInput textinput.Model
+
+	// The pending IAM Identity Center login, shown until the user approves it
+	ssoAuthorization *aws_client.SSODeviceAuthorization
+
+	// The roles being assumed on the way to the selected role, and the one in progress
+	roleChain      []coreTypes.RoleHop
+	roleChainIndex int
+
+	// Retrying after STS rejected a reused MFA code
+	mfaRetryAt time.Time
+	mfaRetries int
+
+	// Set once a cached session expired mid-flow, so it isn't relied on again
+	cacheMissed bool
 
 	// UI components (created as needed)
 	profileModel *lists.ProfileListModel
@@ -52,6 +80,11 @@ type UIManager struct {
 	// Exit message
 	exitMessage string
 
+	// With --offer-console the success screen stays up while the console can be opened from it
+	offerConsole  bool
+	consoleStatus string
+	quitting      bool
+
 	// Viewport dimensions
 	width  int
 	height int
@@ -63,6 +96,7 @@ type FlowStep int
 const (
 	StepProfileSelection FlowStep = iota
 	StepDriverSelection
+	StepSSOAuthorization
 	StepRoleSelection
 	StepMFAInput
 	StepProcessing
@@ -80,8 +114,33 @@ type errorMsg error
 type doneMsg bool
 type quitMsg struct{}
 type processingTickMsg struct{}
+type mfaCodeReusedMsg struct{ err error }
+type mfaCountdownMsg struct{}
+type sessionExpiredMsg struct{}
+type driverLockedMsg struct {
+	driver coreTypes.UnlockableDriver
+	err    error // Set when the previous password was rejected
+}
+type ssoAuthorizationMsg struct {
+	authorization *aws_client.SSODeviceAuthorization
+}
+type ssoRolesMsg struct{ roles []coreTypes.SSORole }
+type consoleOpenedMsg struct {
+	url string
+	err error
+}
 
-func Start(awsService *core.AWSService, authDriverName auth_drivers.AuthDriverName) *UIManager {
+// roleHopMsg reports each role in a chain as it's assumed, it comes from the command
+// doing the work so the model is only ever changed in Update
+type roleHopMsg struct {
+	hops  []coreTypes.RoleHop
+	index int
+	next  <-chan roleHopMsg
+}
+
+// Start creates the UI manager, any values populated in options are treated as
+// already chosen and their steps are skipped.
+func Start(awsService *core.AWSService, authDriverName auth_drivers.AuthDriverName, options coreTypes.LoginOptions) *UIManager {
 	s := spinner.New()
 	s.Spinner = spinner.Dot
 	s.Style = lipgloss.NewStyle().Foreground(lipgloss.Color("205"))
@@ -122,6 +181,9 @@ func Start(awsService *core.AWSService, authDriverName auth_drivers.AuthDriverNa
 	ui := &UIManager{
 		awsService:          awsService,
 		authDriverName:      authDriverName,
+		profile:             options.Profile,
+		presetRole:          options.Role,
+		mfaCode:             options.MFACode,
 		sessionResult:       &coreTypes.AuthFlowResult{},
 		mfaInput:            NewMFAInput(),
 		spinner:             s,
@@ -136,6 +198,12 @@ func Start(awsService *core.AWSService, authDriverName auth_drivers.AuthDriverNa
 	return ui
 }
 
+// SetOfferConsole keeps the success screen open after a role login so the console
+// can be opened from it, otherwise the UI exits as soon as the session is ready
+func (u *UIManager) SetOfferConsole(offer bool) {
+	u.offerConsole = offer
+}
+
 // Init initializes the UI
 func (u *UIManager) Init() tea.Cmd {
 	return u.initCurrentStep()
@@ -207,6 +275,67 @@ func (u *UIManager) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	case stepCompleteMsg:
 		return u.handleStepComplete(msg)
 
+	case mfaCodeReusedMsg:
+		return u.handleMFACodeReused(msg.err)
+
+	case sessionExpiredMsg:
+		// The MFA prompt was skipped for the cached session, so go back and get a code.
+		// When the driver selection was skipped too, the code is asked for instead.
+		u.cacheMissed = true
+		if u.authDriverName == auth_drivers.AuthDriverUnknown {
+			u.authDriverName = auth_drivers.AuthDriverManual
+		}
+		if u.authDriverName == auth_drivers.AuthDriverManual {
+			u.step = errSessionExpired.Error()
+		}
+		u.currentStep = StepMFAInput
+		return u, u.initCurrentStep()
+
+	case ssoAuthorizationMsg:
+		// Show the code and open the browser, then wait for the user to approve it
+		u.ssoAuthorization = msg.authorization
+		return u, tea.Batch(u.spinner.Tick, u.waitForSSOLogin())
+
+	case lists.PluginDriversMsg:
+		if u.driverModel == nil {
+			return u, nil
+		}
+		updatedModel, cmd := u.driverModel.Update(msg)
+		*u.driverModel = updatedModel.(lists.DriverListModel)
+		return u, cmd
+
+	case ssoRolesMsg:
+		if len(msg.roles) == 0 {
+			return u.Update(errorMsg(fmt.Errorf("no accounts or roles have been assigned to you in IAM Identity Center")))
+		}
+		roleModel := lists.NewSSORoleListModel(msg.roles)
+		u.roleModel = &roleModel
+		return u, nil
+
+	case driverLockedMsg:
+		// Ask for the vault password, then fetch the code with the unlocked driver
+		u.lockedDriver = msg.driver
+		u.passwordInput = NewPasswordInput()
+		u.step = ""
+		if msg.err != nil {
+			u.step = msg.err.Error()
+		}
+		return u, textinput.Blink
+
+	case roleHopMsg:
+		u.roleChain = msg.hops
+		u.roleChainIndex = msg.index
+		u.step = fmt.Sprintf("Assuming role %d of %d...", msg.index+1, len(msg.hops))
+		return u, waitForRoleHop(msg.next)
+
+	case mfaCountdownMsg:
+		// Keep ticking until the authenticator has rolled over to a new code
+		if time.Until(u.mfaRetryAt) > 0 {
+			return u, mfaCountdown()
+		}
+		u.mfaRetryAt = time.Time{}
+		return u, u.retryWithFreshMFACode()
+
 	case errorMsg:
 		u.err = msg
 		u.currentStep = StepDone
@@ -217,9 +346,28 @@ func (u *UIManager) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	case doneMsg:
 		u.success = bool(msg)
 		u.currentStep = StepDone
+
+		// Role sessions can be opened in the console, when asked to we wait for a key
+		// instead of exiting
+		if u.success && u.offerConsole && u.awsService.CanOpenConsole() {
+			return u, nil
+		}
 		return u, func() tea.Msg { return quitMsg{} }
 
+	case consoleOpenedMsg:
+		switch {
+		case msg.err != nil && msg.url == "":
+			u.consoleStatus = errorStyle.Render(msg.err.Error())
+		case msg.err != nil:
+			// The browser couldn't be opened, the URL is the next best thing
+			u.consoleStatus = fmt.Sprintf("%s\n%s", errorStyle.Render(msg.err.Error()), msg.url)
+		default:
+			u.consoleStatus = successStyle.Render("✓ Opened the AWS console in your browser")
+		}
+		return u, nil
+
 	case quitMsg:
+		u.quitting = true
 		return u, tea.Quit
 
 	case tea.QuitMsg:
@@ -259,6 +407,23 @@ func (u *UIManager) View() string {
 		}
 		return body
 
+	case StepSSOAuthorization:
+		if u.ssoAuthorization == nil {
+			content := fmt.Sprintf("%s %s",
+				u.spinner.View(),
+				lightGrayStyle.Render("Starting IAM Identity Center login..."))
+			return u.renderTextWithTitle("🔐 JJ AWS Login", content)
+		}
+
+		content := fmt.Sprintf("%s\n\n%s\n\n%s\n%s\n\n%s %s",
+			infoStyle.Render("Approve the login in your browser, check it shows this code:"),
+			accentStyle.Render(u.ssoAuthorization.UserCode),
+			lightGrayStyle.Render("If the browser didn't open, visit:"),
+			u.ssoAuthorization.VerificationURIComplete,
+			u.spinner.View(),
+			pulseStyle.Render("Waiting for approval"))
+		return u.renderTextWithTitle("🔐 IAM Identity Center Login", content)
+
 	case StepRoleSelection:
 		var body string
 		if u.roleModel == nil {
@@ -269,6 +434,16 @@ func (u *UIManager) View() string {
 		return body
 
 	case StepMFAInput:
+		// The driver can yield codes once its vault is unlocked
+		if u.lockedDriver != nil {
+			content := fmt.Sprintf("%s\n\n%s\n\n%s\n\n%s",
+				infoStyle.Render(fmt.Sprintf("Enter the password to unlock %s", u.lockedDriver.Name())),
+				u.passwordInput.View(),
+				lightGrayStyle.Render("Press Enter to continue • Ctrl+C to cancel"),
+				errorStyle.Render(u.step))
+			return u.renderTextWithTitle("🔐 Unlock Password Vault", content)
+		}
+
 		// Check if we're using automatic MFA or manual input
 		if u.authDriverName != auth_drivers.AuthDriverManual {
 			// Show status message for automatic MFA providers
@@ -289,12 +464,20 @@ func (u *UIManager) View() string {
 
 	case StepProcessing:
 		stepMessage := u.step
+		if !u.mfaRetryAt.IsZero() {
+			remaining := int(time.Until(u.mfaRetryAt).Round(time.Second).Seconds())
+			stepMessage = fmt.Sprintf("MFA code already used, waiting %ds for a fresh code from %s...",
+				max(remaining, 0), u.driver.Name())
+		}
 		if stepMessage == "" {
 			stepMessage = u.processingMessages[u.currentMessageIndex]
 		}
 		content := fmt.Sprintf("%s %s",
 			u.spinner.View(),
 			lightGrayStyle.Render(stepMessage))
+		if len(u.roleChain) > 1 {
+			content = fmt.Sprintf("%s\n\n%s", content, u.renderRoleChain())
+		}
 		return u.renderTextWithTitle("🔐 JJ AWS Login", content)
 
 	case StepDone:
@@ -303,24 +486,89 @@ func (u *UIManager) View() string {
 				errorStyle.Render("✗"),
 				lightGrayStyle.Render(u.err.Error()))
 
+			// Typed errors know what went wrong and how to fix it
+			var loginErr *core.LoginError
+			if errors.As(u.err, &loginErr) && loginErr.Explanation() != "" {
+				content = fmt.Sprintf("%s\n\n%s\n%s",
+					content,
+					infoStyle.Render(loginErr.Explanation()),
+					pulseStyle.Render("→ "+loginErr.Suggestion()))
+			}
+
 			u.exitMessage = content
 		}
 		if u.success {
-			// Format ECR status
-			ecrStatus := "no"
-			ecrColor := errorStyle
-			if u.sessionResult.ECRAuth {
-				ecrStatus = "yes"
-				ecrColor = accentStyle
-			}
-
 			successLine := successStyle.Render("✓ Success")
-			content := fmt.Sprintf("%s - account [%s] - ecr [%s]",
+			content := fmt.Sprintf("%s - account [%s]",
 				successLine,
-				accentStyle.Render(u.profile),
-				ecrColor.Render(ecrStatus))
+				accentStyle.Render(u.profile))
 
-			u.exitMessage = content
+			// Format ECR status, one line per registry we attempted
+			if len(u.sessionResult.ECRResults) == 0 {
+				content += fmt.Sprintf(" - ecr [%s]", errorStyle.Render("no"))
+			}
+			for _, result := range u.sessionResult.ECRResults {
+				if result.Err != nil {
+					content += fmt.Sprintf("\n  %s %s [%s] %s",
+						errorStyle.Render("✗"),
+						result.Target,
+						result.Registry.Host(),
+						lightGrayStyle.Render(result.Err.Error()))
+				} else {
+					content += fmt.Sprintf("\n  %s %s [%s]",
+						successStyle.Render("✓"),
+						result.Target,
+						accentStyle.Render(result.Registry.Host()))
+				}
+			}
+
+			for _, result := range u.sessionResult.CodeArtifactResults {
+				repository := result.Repository.Domain + "/" + result.Repository.Repository
+				if result.Err != nil {
+					content += fmt.Sprintf("\n  %s %s [%s] %s",
+						errorStyle.Render("✗"),
+						result.Repository.Format,
+						repository,
+						lightGrayStyle.Render(result.Err.Error()))
+				} else {
+					content += fmt.Sprintf("\n  %s %s [%s]",
+						successStyle.Render("✓"),
+						result.Repository.Format,
+						accentStyle.Render(repository))
+				}
+			}
+
+			for _, result := range u.sessionResult.EKSResults {
+				if result.Err != nil {
+					content += fmt.Sprintf("\n  %s eks [%s] %s",
+						errorStyle.Render("✗"),
+						result.Cluster.Name,
+						lightGrayStyle.Render(result.Err.Error()))
+				} else {
+					content += fmt.Sprintf("\n  %s eks [%s]",
+						successStyle.Render("✓"),
+						accentStyle.Render(result.Cluster.Name))
+				}
+			}
+
+			// The console binding is only live while the screen is up, so the printed
+			// summary says how to get there once it's gone
+			if u.awsService.CanOpenConsole() {
+				u.exitMessage = content + "\n\n" + lightGrayStyle.Render(
+					"Open the AWS console with aws-login console, or log in with --offer-console and press c")
+			} else {
+				u.exitMessage = content
+			}
+
+			// Keep the summary on screen until the user is done with it, once we
+			// quit it is printed by FinalOutput instead
+			if !u.quitting && u.offerConsole && u.awsService.CanOpenConsole() {
+				if u.consoleStatus != "" {
+					content += "\n\n" + u.consoleStatus
+				}
+				content += "\n\n" + lightGrayStyle.Render("Press c to open the AWS console • any other key to exit")
+				return u.renderTextWithTitle("🔐 JJ AWS Login", content)
+			}
 		}
 
 		return ""
@@ -369,11 +617,31 @@ func (u *UIManager) FinalOutput() string {
 	return u.renderTextWithTitle("🔐 JJ AWS Login", u.exitMessage)
 }
 
+// Err returns the error that terminated the flow, if any
+func (u *UIManager) Err() error {
+	return u.err
+}
+
+// Succeeded returns true once the session has been established
+func (u *UIManager) Succeeded() bool {
+	return u.success
+}
+
 // initCurrentStep initializes the current step
 func (u *UIManager) initCurrentStep() tea.Cmd {
 
 	switch u.currentStep {
 	case StepProfileSelection:
+		// The profile was supplied up front, make sure it exists before moving on
+		if u.profile != "" {
+			if !u.awsService.IsSSOProfile(u.profile) {
+				if _, err := u.awsService.GetMFASerial(u.profile); err != nil {
+					return func() tea.Msg { return errorMsg(err) }
+				}
+			}
+			return func() tea.Msg { return stepCompleteMsg{step: StepProfileSelection, data: u.profile} }
+		}
+
 		profiles := u.awsService.GetValidProfiles()
 		profileModel := lists.NewProfileListModel(u.awsService)
 		u.profileModel = &profileModel
@@ -384,11 +652,50 @@ func (u *UIManager) initCurrentStep() tea.Cmd {
 		return nil
 
 	case StepDriverSelection:
-		driverModel := lists.NewDriverListModel()
+		// Skip the selection if the driver was configured, or if we already have
+		// an MFA code (or a cached session) in which case the driver would never be consulted
+		// IAM Identity Center profiles never need an MFA code from us either
+		if u.authDriverName != auth_drivers.AuthDriverUnknown || u.mfaCode != "" || u.awsService.HasCachedSession(u.profile, "", "") ||
+			u.awsService.IsSSOProfile(u.profile) {
+			return func() tea.Msg { return stepCompleteMsg{step: StepDriverSelection, data: u.authDriverName} }
+		}
+
+		driverModel := lists.NewDriverListModel(u.awsService.Runner())
 		u.driverModel = &driverModel
-		return nil
+		return driverModel.Init()
+
+	case StepSSOAuthorization:
+		// A cached token (or a cached session for the role) means the browser isn't needed
+		role, _ := u.awsService.ResolveRole(u.profile, u.presetRole)
+		if u.awsService.HasSSOToken(u.profile) || (role != "" && u.awsService.HasCachedSession(u.profile, role, u.profile)) {
+			return func() tea.Msg { return stepCompleteMsg{step: StepSSOAuthorization} }
+		}
+		return tea.Batch(u.spinner.Tick, u.startSSOLogin())
 
 	case StepRoleSelection:
+		// The role may be configured on an IAM Identity Center profile, so resolve it even
+		// when none was supplied
+		if u.presetRole == "" && u.awsService.IsSSOProfile(u.profile) {
+			role, err := u.awsService.ResolveAssumableRole(u.profile, "")
+			if err != nil {
+				return func() tea.Msg { return errorMsg(err) }
+			}
+			if role.Arn != "" {
+				u.selectedRole = role
+				return func() tea.Msg { return stepCompleteMsg{step: StepRoleSelection, data: u.selectedRole} }
+			}
+			return u.loadSSORoles()
+		}
+
+		if u.presetRole != "" {
+			role, err := u.awsService.ResolveAssumableRole(u.profile, u.presetRole)
+			if err != nil {
+				return func() tea.Msg { return errorMsg(err) }
+			}
+			u.selectedRole = role
+			return func() tea.Msg { return stepCompleteMsg{step: StepRoleSelection, data: u.selectedRole} }
+		}
+
 		// Check if there are any assumable roles
 		assumableRoles := u.awsService.GetAssumableRoles(u.profile)
 		if len(assumableRoles) == 0 {
@@ -401,6 +708,21 @@ func (u *UIManager) initCurrentStep() tea.Cmd {
 		return nil
 
 	case StepMFAInput:
+		// A cached session means STS won't need a code at all, and IAM Identity Center
+		// profiles were authenticated in the browser
+		cached := !u.cacheMissed && u.awsService.HasCachedSession(u.profile, u.selectedRole.Arn, u.selectedRole.Profile)
+		if cached || u.awsService.IsSSOProfile(u.profile) {
+			return func() tea.Msg { return stepCompleteMsg{step: StepMFAInput, data: ""} }
+		}
+
+		// The code was supplied up front, validate it rather than prompting
+		if u.mfaCode != "" {
+			if !u.awsService.ValidateMFACode(u.mfaCode) {
+				return func() tea.Msg { return errorMsg(fmt.Errorf("invalid MFA code - must be 6 digits")) }
+			}
+			return func() tea.Msg { return stepCompleteMsg{step: StepMFAInput, data: u.mfaCode} }
+		}
+
 		// Check if we can get MFA automatically
 		if u.authDriverName != auth_drivers.AuthDriverManual {
 			return u.tryAutoMFA()
@@ -466,7 +788,7 @@ func (u *UIManager) handleCurrentStep(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 		*u.roleModel = updatedModel.(lists.RoleListModel)
 
 		if u.roleModel.IsSelected() {
-			u.selectedRole = u.roleModel.GetChoice().(string)
+			u.selectedRole = u.roleModel.GetChoice().(coreTypes.AssumableRole)
 			return u, func() tea.Msg {
 				return stepCompleteMsg{step: StepRoleSelection, data: u.selectedRole}
 			}
@@ -474,12 +796,28 @@ func (u *UIManager) handleCurrentStep(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 		return u, cmd
 
 	case StepMFAInput:
+		if u.lockedDriver != nil {
+			if msg.String() == "enter" && u.passwordInput.Value() != "" {
+				driver := u.lockedDriver
+				driver.Unlock(u.passwordInput.Value())
+				u.lockedDriver = nil
+				u.passwordInput.Reset()
+				u.step = ""
+				return u, u.fetchMFACode(driver)
+			}
+
+			var cmd tea.Cmd
+			u.passwordInput, cmd = u.passwordInput.Update(msg)
+			return u, cmd
+		}
+
 		// Only handle manual input if using manual driver
 		if u.authDriverName == auth_drivers.AuthDriverManual {
 			if msg.String() == "enter" {
 				mfaCode := u.mfaInput.Value()
 				if u.awsService.ValidateMFACode(mfaCode) {
 					u.mfaCode = mfaCode
+					u.step = ""
 					return u, func() tea.Msg {
 						return stepCompleteMsg{step: StepMFAInput, data: u.mfaCode}
 					}
@@ -500,6 +838,14 @@ func (u *UIManager) handleCurrentStep(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 		// For automatic drivers, just ignore key input (they're handled by tryAutoMFA)
 		return u, nil
 
+	case StepDone:
+		if msg.String() == "c" {
+			u.consoleStatus = pulseStyle.Render("Opening the AWS console...")
+			return u, u.openConsole()
+		}
+		u.quitting = true
+		return u, tea.Quit
+
 	default:
 		return u, nil
 	}
@@ -516,12 +862,20 @@ func (u *UIManager) handleStepComplete(msg stepCompleteMsg) (tea.Model, tea.Cmd)
 
 	case StepDriverSelection:
 		u.currentStep = StepRoleSelection
+		if u.awsService.IsSSOProfile(u.profile) {
+			u.currentStep = StepSSOAuthorization
+		}
 		// Update the auth driver from the step completion data
 		if driver, ok := msg.data.(auth_drivers.AuthDriverName); ok {
 			u.authDriverName = driver
 		}
 		return u, u.initCurrentStep()
 
+	case StepSSOAuthorization:
+		u.ssoAuthorization = nil
+		u.currentStep = StepRoleSelection
+		return u, u.initCurrentStep()
+
 	case StepRoleSelection:
 		u.currentStep = StepMFAInput
 		return u, u.initCurrentStep()
@@ -535,55 +889,264 @@ func (u *UIManager) handleStepComplete(msg stepCompleteMsg) (tea.Model, tea.Cmd)
 	}
 }
 
+// openConsole signs the browser in to the AWS console as the active session
+func (u *UIManager) openConsole() tea.Cmd {
+	return func() tea.Msg {
+		consoleURL, err := u.awsService.ConsoleURL("")
+		if err != nil {
+			return consoleOpenedMsg{err: err}
+		}
+
+		return consoleOpenedMsg{url: consoleURL, err: u.awsService.OpenURL(consoleURL)}
+	}
+}
+
+// startSSOLogin starts the IAM Identity Center device authorization and opens the
+// browser on the approval page
+func (u *UIManager) startSSOLogin() tea.Cmd {
+	return func() tea.Msg {
+		authorization, err := u.awsService.StartSSOLogin(u.profile)
+		if err != nil {
+			return errorMsg(err)
+		}
+
+		// The URL is on screen too, so there's nothing to do if the browser won't open
+		_ = u.awsService.OpenURL(authorization.VerificationURIComplete)
+
+		return ssoAuthorizationMsg{authorization: authorization}
+	}
+}
+
+// waitForSSOLogin polls until the user approves the login in the browser
+func (u *UIManager) waitForSSOLogin() tea.Cmd {
+	return func() tea.Msg {
+		if err := u.awsService.WaitForSSOLogin(context.Background(), u.profile, u.ssoAuthorization); err != nil {
+			return errorMsg(err)
+		}
+
+		return stepCompleteMsg{step: StepSSOAuthorization}
+	}
+}
+
+// loadSSORoles lists the accounts and roles for the role selection step
+func (u *UIManager) loadSSORoles() tea.Cmd {
+	return func() tea.Msg {
+		roles, err := u.awsService.GetSSORoles(u.profile)
+		if err != nil {
+			return errorMsg(err)
+		}
+
+		return ssoRolesMsg{roles: roles}
+	}
+}
+
 // tryAutoMFA attempts to get MFA code automatically from the driver
 func (u *UIManager) tryAutoMFA() tea.Cmd {
 	return func() tea.Msg {
-		driver, err := auth_drivers.GetDriver(u.authDriverName, u.profile)
+		driver, err := auth_drivers.GetDriver(u.authDriverName, u.profile, u.awsService.Runner())
 		if err != nil {
 			return errorMsg(err)
 		}
 
+		return u.fetchMFACode(driver)()
+	}
+}
+
+// fetchMFACode gets the code from the driver, drivers with a locked vault ask for the
+// password first (and again if it was rejected)
+func (u *UIManager) fetchMFACode(driver coreTypes.Driver) tea.Cmd {
+	return func() tea.Msg {
+		unlockable, isUnlockable := driver.(coreTypes.UnlockableDriver)
+		if isUnlockable && unlockable.NeedsPassword() {
+			return driverLockedMsg{driver: unlockable}
+		}
+
 		mfaCode, err := u.awsService.GetMFACode(driver)
 		if err != nil {
+			if isUnlockable && unlockable.NeedsPassword() {
+				return driverLockedMsg{driver: unlockable, err: err}
+			}
 			return errorMsg(err)
 		}
 
+		u.driver = driver
 		u.mfaCode = mfaCode
 		return stepCompleteMsg{step: StepMFAInput, data: mfaCode}
 	}
 }
 
-// processAuthentication handles the final authentication process
-func (u *UIManager) processAuthentication() tea.Cmd {
+// handleMFACodeReused recovers from STS rejecting a code it has already seen, this
+// happens when two terminals log in within the same 30 second window.  Drivers that
+// yield codes wait for the next window and retry, everyone else is asked for a new code.
+func (u *UIManager) handleMFACodeReused(err error) (tea.Model, tea.Cmd) {
+	u.mfaCode = ""
+
+	if u.driver != nil && u.driver.YieldsMFACode() {
+		if u.mfaRetries >= core.MaxMFARetries {
+			return u.Update(errorMsg(err))
+		}
+
+		u.mfaRetries++
+		u.mfaRetryAt = time.Now().Add(core.TimeUntilNextMFACode(time.Now()))
+		return u, mfaCountdown()
+	}
+
+	// The code came from the user (or --mfa), so go back and ask for another one
+	var loginErr *core.LoginError
+	if errors.As(err, &loginErr) {
+		u.step = fmt.Sprintf("%s %s", loginErr.Explanation(), loginErr.Suggestion())
+	}
+	u.authDriverName = auth_drivers.AuthDriverManual
+	u.mfaInput.SetValue("")
+	u.currentStep = StepMFAInput
+	return u, u.initCurrentStep()
+}
+
+// retryWithFreshMFACode fetches a new code from the driver and re-runs authentication
+func (u *UIManager) retryWithFreshMFACode() tea.Cmd {
 	return func() tea.Msg {
-		// Get session token with MFA code
-		_, err := u.awsService.GetSessionToken(u.profile, u.mfaCode)
+		mfaCode, err := u.awsService.GetMFACode(u.driver)
 		if err != nil {
 			return errorMsg(err)
 		}
 
-		// If we have a role to assume, do that
-		if u.selectedRole != "" {
-			assumedProfileName := u.awsService.GetAssumedProfileName(u.selectedRole)
-			_, err := u.awsService.AssumeRole(assumedProfileName, u.selectedRole)
-			if err != nil {
-				return errorMsg(err)
-			}
+		u.mfaCode = mfaCode
+		return u.processAuthentication()()
+	}
+}
+
+// mfaCountdown ticks once a second so the countdown on the processing screen updates
+func mfaCountdown() tea.Cmd {
+	return tea.Tick(time.Second, func(t time.Time) tea.Msg {
+		return mfaCountdownMsg{}
+	})
+}
+
+// establishSession reuses cached sessions where possible, otherwise it gets a session
+// token with the MFA code and assumes the selected role (if any).  Each role in the
+// chain is reported on hops as it's assumed.
+func (u *UIManager) establishSession(hops chan<- roleHopMsg) error {
+	// IAM Identity Center hands out role credentials directly, there is no session
+	// token to get first
+	if u.awsService.IsSSOProfile(u.profile) {
+		restored, err := u.awsService.RestoreAssumedRole(u.profile, u.selectedRole.Arn, u.profile)
+		if err != nil || restored {
+			return err
+		}
+
+		_, err = u.awsService.SSOLogin(u.profile, u.selectedRole.Arn)
+		return err
+	}
+
+	assumedProfileName := ""
+	if u.selectedRole.Arn != "" {
+		assumedProfileName = u.selectedRole.Profile
+		// Roles passed as a raw ARN may not belong to a profile
+		if assumedProfileName == "" {
+			assumedProfileName = u.profile
+		}
 
+		restored, err := u.awsService.RestoreAssumedRole(u.profile, u.selectedRole.Arn, assumedProfileName)
+		if err != nil {
+			return err
+		}
+		if restored {
 			u.profile = assumedProfileName
+			return nil
+		}
+	}
+
+	restored, err := u.awsService.RestoreSession(u.profile)
+	if err != nil {
+		return err
+	}
+
+	if !restored {
+		// The session may have expired since the MFA prompt was skipped for it, STS
+		// must never be sent an empty code
+		if u.mfaCode == "" {
+			return errSessionExpired
+		}
+
+		// Get session token with MFA code
+		if _, err := u.awsService.GetSessionToken(u.profile, u.mfaCode); err != nil {
+			return err
+		}
+	}
+
+	// If we have a role to assume, do that, the processing screen lists each
+	// intermediate role as it's assumed
+	if u.selectedRole.Arn != "" {
+		progress := func(chain []coreTypes.RoleHop, index int) {
+			hops <- roleHopMsg{hops: chain, index: index}
+		}
+		_, err := u.awsService.AssumeRoleChain(assumedProfileName, u.selectedRole.Arn, progress)
+		if err != nil {
+			return err
+		}
+
+		u.profile = assumedProfileName
+	}
+
+	return nil
+}
+
+// renderRoleChain lists the hops of a role chain, ticking off the ones assumed so far
+func (u *UIManager) renderRoleChain() string {
+	lines := make([]string, 0, len(u.roleChain))
+	for i, hop := range u.roleChain {
+		switch {
+		case i < u.roleChainIndex:
+			lines = append(lines, successStyle.Render("✓ ")+lightGrayStyle.Render(hop.Profile))
+		case i == u.roleChainIndex:
+			lines = append(lines, pulseStyle.Render("→ "+hop.Profile))
+		default:
+			lines = append(lines, lightGrayStyle.Render("· "+hop.Profile))
+		}
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// processAuthentication handles the final authentication process
+func (u *UIManager) processAuthentication() tea.Cmd {
+	hops := make(chan roleHopMsg)
+
+	return tea.Batch(waitForRoleHop(hops), func() tea.Msg {
+		err := u.establishSession(hops)
+		close(hops)
+		if err != nil {
+			if core.IsErrorKind(err, core.ErrorKindMFACodeReused) {
+				return mfaCodeReusedMsg{err: err}
+			}
+			if errors.Is(err, errSessionExpired) {
+				return sessionExpiredMsg{}
+			}
+			return errorMsg(err)
 		}
 
 		// Set user to profile name for display purposes
 		u.sessionResult.User = u.profile
 
-		// Attempt ECR login
-		if err := u.awsService.LoginToECR(); err != nil {
-			u.sessionResult.ECRAuth = false
-			// not critical, continue with success
-		} else {
-			u.sessionResult.ECRAuth = true
-		}
+		// Attempt ECR login, failures are not critical and are reported per registry
+		u.sessionResult.ECRResults, _ = u.awsService.LoginToECR()
+		u.sessionResult.CodeArtifactResults, _ = u.awsService.LoginToCodeArtifact()
+		u.sessionResult.EKSResults, _ = u.awsService.UpdateKubeconfig()
 
 		return doneMsg(true)
+	})
+}
+
+// waitForRoleHop waits for the next role in the chain to be assumed, nothing is
+// returned once the session has been established
+func waitForRoleHop(hops <-chan roleHopMsg) tea.Cmd {
+	return func() tea.Msg {
+		msg, ok := <-hops
+		if !ok {
+			return nil
+		}
+
+		msg.next = hops
+		return msg
 	}
 }